@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry"
+)
+
+// runFunc runs a command with its positional arguments
+type runFunc = func(ctx context.Context, m *pantry.BasketManager, args []string) error
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+// listCommand prints the name of every basket
+func listCommand(fs *flag.FlagSet) runFunc {
+	asJSON := fs.Bool("json", false, "Print a JSON array of basket names")
+	return func(ctx context.Context, m *pantry.BasketManager, _ []string) error {
+		baskets, err := m.ListBaskets(ctx)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			if baskets == nil {
+				baskets = []string{}
+			}
+			return printJSON(baskets)
+		}
+		for _, name := range baskets {
+			fmt.Println(name)
+		}
+		return nil
+	}
+}
+
+// getCommand prints a basket, or the value at a path in it
+func getCommand(fs *flag.FlagSet) runFunc {
+	raw := fs.Bool("raw", false, "Print compact JSON, and strings without quotes")
+	path := fs.String("path", "", `jq-style path of the value to print, e.g. ".prices[0].product"`)
+	return func(ctx context.Context, m *pantry.BasketManager, args []string) error {
+		steps, err := parsePath(*path)
+		if err != nil {
+			return &usageError{message: err.Error()}
+		}
+		var data json.RawMessage
+		if err := m.GetSharded(ctx, args[0], &data); err != nil {
+			return err
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(data))
+		// Print numbers exactly as stored
+		dec.UseNumber()
+		var value any
+		if err := dec.Decode(&value); err != nil {
+			return fmt.Errorf("failed to decode basket %s: %w", args[0], err)
+		}
+		value, err = selectPath(value, steps)
+		if err != nil {
+			return err
+		}
+
+		if !*raw {
+			return printJSON(value)
+		}
+		if s, ok := value.(string); ok {
+			fmt.Println(s)
+			return nil
+		}
+		out, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+}
+
+// putCommand writes a JSON object read from a file or stdin to a basket
+func putCommand(fs *flag.FlagSet) runFunc {
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+	replace := fs.Bool("replace", false, "Replace the basket instead of merging the object into it")
+	return func(ctx context.Context, m *pantry.BasketManager, args []string) error {
+		name, file := args[0], args[1]
+		var (
+			data []byte
+			err  error
+		)
+		if file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(data, &object); err != nil {
+			return &usageError{message: fmt.Sprintf("%s is not a JSON object: %v", file, err)}
+		}
+
+		mode := pantry.WriteMerge
+		if *replace {
+			mode = pantry.WriteReplace
+		}
+		if err := m.PutSharded(ctx, name, object, mode); err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(map[string]any{"basket": name, "bytes": len(data)})
+		}
+		fmt.Printf("Stored %d bytes in basket %s\n", len(data), name)
+		return nil
+	}
+}
+
+// deleteCommand deletes a basket, and its parts if it is sharded
+func deleteCommand(fs *flag.FlagSet) runFunc {
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+	return func(ctx context.Context, m *pantry.BasketManager, args []string) error {
+		if err := m.DeleteSharded(ctx, args[0]); err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(map[string]any{"basket": args[0], "deleted": true})
+		}
+		fmt.Printf("Deleted basket %s\n", args[0])
+		return nil
+	}
+}
+
+// existsCommand reports whether a basket exists through its exit code
+func existsCommand(fs *flag.FlagSet) runFunc {
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+	quiet := fs.Bool("q", false, "Print nothing, only set the exit code")
+	return func(ctx context.Context, m *pantry.BasketManager, args []string) error {
+		exists, err := m.BasketExists(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		switch {
+		case *quiet:
+		case *asJSON:
+			if err := printJSON(map[string]any{"basket": args[0], "exists": exists}); err != nil {
+				return err
+			}
+		case exists:
+			fmt.Printf("Basket %s exists\n", args[0])
+		default:
+			fmt.Printf("Basket %s does not exist\n", args[0])
+		}
+		if !exists {
+			// The output already says so, only set the exit code
+			return exitCode(exitNotFound)
+		}
+		return nil
+	}
+}
+
+// copyCommand copies a basket to another name
+func copyCommand(fs *flag.FlagSet) runFunc {
+	return transferCommand(fs, false)
+}
+
+// renameCommand copies a basket to another name, then deletes it
+func renameCommand(fs *flag.FlagSet) runFunc {
+	return transferCommand(fs, true)
+}
+
+// transferCommand implements copy and rename
+func transferCommand(fs *flag.FlagSet, move bool) runFunc {
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+	force := fs.Bool("force", false, "Replace the destination basket if it exists")
+	return func(ctx context.Context, m *pantry.BasketManager, args []string) error {
+		src, dst := args[0], args[1]
+		if src == dst {
+			return &usageError{message: "source and destination are the same basket"}
+		}
+		// Check the destination before the slow sharded read of the source, so
+		// the window for another writer creating it is as short as possible.
+		// Pantry has no conditional writes, so it cannot be closed entirely
+		if !*force {
+			exists, err := m.BasketExists(ctx, dst)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return fmt.Errorf("basket %s already exists, use -force to replace it", dst)
+			}
+		}
+		var data json.RawMessage
+		if err := m.GetSharded(ctx, src, &data); err != nil {
+			return err
+		}
+		if err := m.PutSharded(ctx, dst, data, pantry.WriteReplace); err != nil {
+			return err
+		}
+		if move {
+			if err := m.DeleteSharded(ctx, src); err != nil {
+				return fmt.Errorf("copied to %s but failed to delete %s: %w", dst, src, err)
+			}
+		}
+
+		verb := "Copied"
+		if move {
+			verb = "Renamed"
+		}
+		if *asJSON {
+			return printJSON(map[string]any{"from": src, "to": dst, "deleted_source": move})
+		}
+		fmt.Printf("%s basket %s to %s\n", verb, src, dst)
+		return nil
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry/pantrytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// basket returns the contents of a basket of the fake Pantry, or "" if it
+// does not exist
+func basket(t *testing.T, srv *pantrytest.Server, name string) string {
+	t.Helper()
+	data, ok, err := srv.Basket(name)
+	require.NoError(t, err)
+	if !ok {
+		return ""
+	}
+	return string(data)
+}
+
+func TestExitCodes(t *testing.T) {
+	srv := newTestPantry(t)
+	require.NoError(t, srv.SetBasket("notes", map[string]any{"a": 1}))
+
+	assert.Equal(t, exitOK, run([]string{"exists", "notes"}))
+	assert.Equal(t, exitNotFound, run([]string{"exists", "-q", "missing"}))
+	assert.Equal(t, exitNotFound, run([]string{"exists", "-json", "missing"}))
+	assert.Equal(t, exitNotFound, run([]string{"get", "missing"}))
+	assert.Equal(t, exitNotFound, run([]string{"delete", "missing"}))
+
+	assert.Equal(t, exitUsage, run(nil))
+	assert.Equal(t, exitUsage, run([]string{"unknown"}))
+	assert.Equal(t, exitUsage, run([]string{"exists"}), "missing argument")
+	assert.Equal(t, exitUsage, run([]string{"exists", "-unknown", "notes"}))
+	assert.Equal(t, exitUsage, run([]string{"get", "-path", "prices", "notes"}), "invalid path")
+	assert.Equal(t, exitOK, run([]string{"help"}))
+
+	assert.Equal(t, exitFailure, run([]string{"get", "-path", ".b", "notes"}), "missing key")
+	srv.FailNext(1, http.StatusUnauthorized)
+	assert.Equal(t, exitFailure, run([]string{"exists", "notes"}))
+}
+
+func TestCopyRename(t *testing.T) {
+	const src = `{"date":"2025-06-18","prices":[{"product":"PAPA"}]}`
+	const other = `{"date":"2025-06-17"}`
+	setup := func(t *testing.T, dst bool) *pantrytest.Server {
+		srv := newTestPantry(t)
+		require.NoError(t, srv.SetBasket("src", json.RawMessage(src)))
+		if dst {
+			require.NoError(t, srv.SetBasket("dst", json.RawMessage(other)))
+		}
+		return srv
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		// dst is whether the destination exists before the command
+		dst  bool
+		code int
+		// wantSrc and wantDst are the baskets after the command, "" if missing
+		wantSrc, wantDst string
+	}{
+		{name: "copy", args: []string{"copy", "src", "dst"}, code: exitOK, wantSrc: src, wantDst: src},
+		{name: "copy over existing", args: []string{"copy", "src", "dst"}, dst: true, code: exitFailure, wantSrc: src, wantDst: other},
+		{name: "copy -force", args: []string{"copy", "-force", "src", "dst"}, dst: true, code: exitOK, wantSrc: src, wantDst: src},
+		{name: "rename", args: []string{"rename", "src", "dst"}, code: exitOK, wantDst: src},
+		{name: "rename over existing", args: []string{"rename", "src", "dst"}, dst: true, code: exitFailure, wantSrc: src, wantDst: other},
+		{name: "rename -force", args: []string{"rename", "-force", "-json", "src", "dst"}, dst: true, code: exitOK, wantDst: src},
+		{name: "missing source", args: []string{"rename", "missing", "dst"}, code: exitNotFound, wantSrc: src},
+		{name: "same basket", args: []string{"copy", "-force", "src", "src"}, code: exitUsage, wantSrc: src},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := setup(t, tt.dst)
+			assert.Equal(t, tt.code, run(tt.args))
+			assertJSON(t, tt.wantSrc, basket(t, srv, "src"), "src")
+			assertJSON(t, tt.wantDst, basket(t, srv, "dst"), "dst")
+		})
+	}
+}
+
+func TestCopyChecksDestinationFirst(t *testing.T) {
+	srv := newTestPantry(t)
+	require.NoError(t, srv.SetBasket("src", map[string]any{"a": 1}))
+	require.NoError(t, srv.SetBasket("dst", map[string]any{"b": 2}))
+
+	assert.Equal(t, exitFailure, run([]string{"copy", "src", "dst"}))
+	for _, r := range srv.Requests() {
+		assert.NotEqual(t, "src", r.Basket, "the source is not read when the destination exists")
+	}
+}
+
+// assertJSON checks that got holds the JSON document want, or is empty if
+// want is
+func assertJSON(t *testing.T, want, got, name string) {
+	t.Helper()
+	if want == "" {
+		assert.Empty(t, got, "%s does not exist", name)
+		return
+	}
+	assert.JSONEq(t, want, got, name)
+}
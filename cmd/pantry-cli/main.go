@@ -1,69 +1,194 @@
+// Command pantry-cli manages the baskets of a Pantry (https://getpantry.cloud/).
+//
+// Usage:
+//
+//	pantry-cli [-config file] [-pantry name] <command> [flags] [arguments]
+//
+// Flags go before the arguments, e.g. "pantry-cli get -path .prices[0] prices_2025_06_18".
+// The pantry is read from the PANTRY_* environment variables (PANTRY_API_KEY
+// or PANTRY_API_KEY_FILE, PANTRY_BASE_URL, ...), or selected with -pantry
+// from the config file given with -config (or PANTRY_CONFIG and PANTRY_NAME).
+// PANTRY_BASE_URL points the commands to another server, such as the one
+// started by serve-fake.
+//
+// Exit codes: 0 on success, 1 on failure, 2 on invalid usage and 3 when a
+// basket does not exist.
 package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/aliasthewho/price_tracker/internal/storage/pantry"
 )
 
-func main() {
-	// Load configuration from environment variables
-	cfg, err := pantry.NewConfigFromEnv()
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
-	}
+// Exit codes
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitNotFound = 3
+)
+
+// commandTimeout bounds every command, including the requests of copy and rename
+const commandTimeout = 2 * time.Minute
+
+// usageError is returned for invalid arguments
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+// exitCode is returned by commands that already reported the outcome and only
+// need to set the exit code
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit code %d", int(c))
+}
+
+// command is a pantry-cli subcommand
+type command struct {
+	// args describes the positional arguments in the usage line
+	args    string
+	summary string
+	// nargs is the number of positional arguments
+	nargs int
+	// flags registers the command's flags and returns the function running it
+	flags func(fs *flag.FlagSet) runFunc
+	// local commands do not talk to Pantry: they get no manager and no
+	// timeout
+	local bool
+}
 
-	// Create a new basket manager
-	manager := pantry.NewBasketManager(cfg)
+var commands = map[string]command{
+	"list":       {summary: "List all baskets", flags: listCommand},
+	"get":        {args: "<basket>", nargs: 1, summary: "Print the contents of a basket", flags: getCommand},
+	"put":        {args: "<basket> <file|->", nargs: 2, summary: "Write a JSON object to a basket, merging into existing contents (-replace replaces them)", flags: putCommand},
+	"delete":     {args: "<basket>", nargs: 1, summary: "Delete a basket", flags: deleteCommand},
+	"exists":     {args: "<basket>", nargs: 1, summary: "Exit with 0 if the basket exists and 3 if it does not", flags: existsCommand},
+	"copy":       {args: "<src> <dst>", nargs: 2, summary: "Copy a basket", flags: copyCommand},
+	"migrate":    {summary: "Rewrite the basket of every day to the current schema version", flags: migrateCommand},
+	"rename":     {args: "<src> <dst>", nargs: 2, summary: "Rename a basket", flags: renameCommand},
+	"serve-fake": {summary: "Serve a fake Pantry API for tests and offline development", flags: serveFakeCommand, local: true},
+}
 
-	// Create a basket name based on today's date
-	basketName := pantry.BasketName(time.Now())
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-	// Check if basket exists
-	exists, err := manager.BasketExists(context.Background(), basketName)
-	if err != nil {
-		log.Fatalf("Failed to check if basket exists: %v", err)
+// run runs the command line and returns the exit code
+func run(args []string) int {
+	global := flag.NewFlagSet("pantry-cli", flag.ContinueOnError)
+	global.Usage = usage
+	configPath := global.String("config", os.Getenv("PANTRY_CONFIG"), "JSON file of named pantries (env PANTRY_CONFIG)")
+	pantryName := global.String("pantry", os.Getenv("PANTRY_NAME"), "pantry of -config to use, its default if empty (env PANTRY_NAME)")
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
 	}
+	args = global.Args()
 
-	if exists {
-		fmt.Printf("Basket %s already exists\n", basketName)
-	} else {
-		// Create a new basket
-		if err := manager.CreateBasket(context.Background(), basketName); err != nil {
-			log.Fatalf("Failed to create basket: %v", err)
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage()
+		if len(args) == 0 {
+			return exitUsage
 		}
-		fmt.Printf("Created new basket: %s\n", basketName)
+		return exitOK
 	}
 
-	// Example data to store
-	data := map[string]interface{}{
-		"products": []map[string]interface{}{
-			{
-				"name":  "Example Product",
-				"price": 9.99,
-			},
-		},
-		"timestamp": time.Now().Format(time.RFC3339),
+	name := args[0]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "pantry-cli: unknown command %q\n\n", name)
+		usage()
+		return exitUsage
 	}
 
-	// Update the basket with data
-	if err := manager.UpdateBasket(context.Background(), basketName, data); err != nil {
-		log.Fatalf("Failed to update basket: %v", err)
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: pantry-cli %s\n\n%s\n", strings.TrimSpace(name+" [flags] "+cmd.args), cmd.summary)
+		fs.PrintDefaults()
+	}
+	runCmd := cmd.flags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() != cmd.nargs {
+		fmt.Fprintf(os.Stderr, "pantry-cli %s: expected %d argument(s), got %d\n", name, cmd.nargs, fs.NArg())
+		fs.Usage()
+		return exitUsage
 	}
 
-	fmt.Printf("Successfully updated basket %s with data\n", basketName)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var manager *pantry.BasketManager
+	if !cmd.local {
+		cfg, err := pantry.LoadConfig(*configPath, *pantryName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pantry-cli: %v\n", err)
+			return exitFailure
+		}
+		manager = pantry.NewBasketManager(cfg)
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+	}
+
+	err := runCmd(ctx, manager, fs.Args())
+	var usageErr *usageError
+	var code exitCode
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &code):
+		return int(code)
+	case errors.Is(err, pantry.ErrNotFound):
+		fmt.Fprintf(os.Stderr, "pantry-cli %s: %v\n", name, err)
+		return exitNotFound
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "pantry-cli %s: %v\n", name, err)
+		return exitUsage
+	default:
+		fmt.Fprintf(os.Stderr, "pantry-cli %s: %v\n", name, err)
+		return exitFailure
+	}
+}
 
-	// List all baskets
-	baskets, err := manager.ListBaskets(context.Background())
-	if err != nil {
-		log.Fatalf("Failed to list baskets: %v", err)
+// usage prints the list of commands
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	fmt.Println("\nAll baskets in your pantry:")
-	for _, b := range baskets {
-		fmt.Printf("- %s\n", b)
+	fmt.Fprintln(os.Stderr, "Usage: pantry-cli [-config file] [-pantry name] <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "\nGlobal flags:")
+	fmt.Fprintln(os.Stderr, "  -config    JSON file of named pantries (env PANTRY_CONFIG)")
+	fmt.Fprintln(os.Stderr, "  -pantry    Pantry of -config to use, its default if empty (env PANTRY_NAME)")
+	fmt.Fprintln(os.Stderr, "\nAvailable commands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
 	}
+	fmt.Fprintln(os.Stderr, "  help       Show help")
+	fmt.Fprintln(os.Stderr, "\nRun \"pantry-cli <command> -h\" for the flags of a command.")
+	fmt.Fprintln(os.Stderr, "Exit codes: 0 success, 1 failure, 2 invalid usage, 3 basket not found.")
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry"
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry/pantrytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPantry starts a fake Pantry and points run to it through the
+// environment. Tests using it cannot run in parallel.
+func newTestPantry(t *testing.T) *pantrytest.Server {
+	t.Helper()
+	srv := pantrytest.NewServer()
+	t.Cleanup(srv.Close)
+	t.Setenv(pantry.EnvBaseURL, srv.BaseURL())
+	t.Setenv(pantry.EnvAPIKey, pantrytest.DefaultKey)
+	t.Setenv(pantry.EnvAPIKeyFile, "")
+	t.Setenv(pantry.EnvBasketPrefix, "")
+	t.Setenv("PANTRY_CONFIG", "")
+	t.Setenv("PANTRY_NAME", "")
+	return srv
+}
+
+func TestMigrate(t *testing.T) {
+	srv := newTestPantry(t)
+	date := time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC)
+	name := pantry.BasketName(date)
+	// A basket written by the first release
+	data, err := os.ReadFile(filepath.Join("..", "..", "internal", "storage", "pantry", "testdata", "v1_baseline.json"))
+	require.NoError(t, err)
+	require.NoError(t, srv.SetBasket(name, json.RawMessage(data)))
+
+	assert.Equal(t, exitOK, run([]string{"migrate", "-dry-run"}))
+	stored, _, err := srv.Basket(name)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(data), string(stored), "-dry-run leaves the basket as it is")
+
+	assert.Equal(t, exitOK, run([]string{"migrate"}))
+	m := pantry.NewBasketManager(pantry.Config{APIKey: pantrytest.DefaultKey, BaseURL: srv.BaseURL()})
+	env, version, err := m.LoadEnvelope(context.Background(), date)
+	require.NoError(t, err)
+	assert.Equal(t, pantry.SchemaVersion, version)
+	require.Len(t, env.Data.Prices, 142)
+	for _, p := range env.Data.Prices {
+		assert.NotEmpty(t, p.Variety, "%s keeps its variety", p.Product)
+		assert.Positive(t, p.Avg, "%s keeps its price", p.Variety)
+	}
+	assert.Equal(t, "PAPA AMARILLA", env.Data.Prices[56].Variety)
+	assert.Equal(t, 2.6, env.Data.Prices[56].Avg)
+
+	// Migrating again has nothing to do
+	assert.Equal(t, exitOK, run([]string{"migrate"}))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry"
+)
+
+// migration is the outcome of migrating the basket of a day
+type migration struct {
+	Basket string `json:"basket"`
+	// From is the schema version the basket was stored in, 0 if unreadable
+	From     int    `json:"from"`
+	Migrated bool   `json:"migrated"`
+	Error    string `json:"error,omitempty"`
+}
+
+// migrateCommand rewrites the basket of every day to the current schema
+// version
+func migrateCommand(fs *flag.FlagSet) runFunc {
+	asJSON := fs.Bool("json", false, "Print the result of every basket as JSON")
+	dryRun := fs.Bool("dry-run", false, "Report the baskets to migrate without rewriting them")
+	return func(ctx context.Context, m *pantry.BasketManager, _ []string) error {
+		days, err := m.ListDays(ctx)
+		if err != nil {
+			return err
+		}
+
+		migrations := make([]migration, 0, len(days))
+		migrated, failed := 0, 0
+		for _, date := range days {
+			result := migration{Basket: m.DayBasket(date)}
+			env, stored, err := m.LoadEnvelope(ctx, date)
+			result.From = stored
+			if err == nil && stored < pantry.SchemaVersion && !*dryRun {
+				err = m.SaveEnvelope(ctx, env)
+			}
+			switch {
+			case err != nil:
+				result.Error = err.Error()
+				failed++
+			case stored < pantry.SchemaVersion:
+				result.Migrated = !*dryRun
+				migrated++
+			}
+			migrations = append(migrations, result)
+
+			if *asJSON {
+				continue
+			}
+			switch {
+			case err != nil:
+				fmt.Fprintf(os.Stderr, "Failed to migrate basket %s: %v\n", result.Basket, err)
+			case stored == pantry.SchemaVersion:
+			case *dryRun:
+				fmt.Printf("Would migrate basket %s from schema version %d\n", result.Basket, stored)
+			default:
+				fmt.Printf("Migrated basket %s from schema version %d\n", result.Basket, stored)
+			}
+		}
+
+		if *asJSON {
+			if err := printJSON(map[string]any{"schema_version": pantry.SchemaVersion, "dry_run": *dryRun, "baskets": migrations}); err != nil {
+				return err
+			}
+		} else {
+			verb := "Migrated"
+			if *dryRun {
+				verb = "Would migrate"
+			}
+			fmt.Printf("%s %d of %d baskets to schema version %d\n", verb, migrated, len(days), pantry.SchemaVersion)
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to migrate %d of %d baskets", failed, len(days))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathStep is a step of a jq-style path: an object key, or an array index if
+// key is empty
+type pathStep struct {
+	key   string
+	index int
+}
+
+func (s pathStep) String() string {
+	if s.key != "" {
+		return "." + s.key
+	}
+	return fmt.Sprintf("[%d]", s.index)
+}
+
+// parsePath parses a jq-style path such as ".prices[0].product". An empty
+// path or "." selects the whole basket. Negative indexes count from the end.
+func parsePath(path string) ([]pathStep, error) {
+	if path == "" || path == "." {
+		return nil, nil
+	}
+	if path[0] != '.' && path[0] != '[' {
+		return nil, fmt.Errorf("invalid path %q: must start with . or [", path)
+	}
+
+	var steps []pathStep
+	for rest := path; rest != ""; {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid path %q: empty key", path)
+			}
+			steps = append(steps, pathStep{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing ]", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %q: index %q is not an integer", path, rest[1:end])
+			}
+			steps = append(steps, pathStep{index: index})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %q: unexpected %q", path, rest[0])
+		}
+	}
+	return steps, nil
+}
+
+// selectPath returns the value at the path in a decoded JSON value
+func selectPath(value any, steps []pathStep) (any, error) {
+	at := ""
+	for _, step := range steps {
+		at += step.String()
+		switch v := value.(type) {
+		case map[string]any:
+			if step.key == "" {
+				return nil, fmt.Errorf("cannot index an object at %s", at)
+			}
+			next, ok := v[step.key]
+			if !ok {
+				return nil, fmt.Errorf("no key %q at %s", step.key, at)
+			}
+			value = next
+		case []any:
+			if step.key != "" {
+				return nil, fmt.Errorf("cannot read key %q of an array at %s", step.key, at)
+			}
+			index := step.index
+			if index < 0 {
+				index += len(v)
+			}
+			if index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("index %d out of range at %s (%d items)", step.index, at, len(v))
+			}
+			value = v[index]
+		default:
+			return nil, fmt.Errorf("cannot select %s of a %T", at, value)
+		}
+	}
+	return value, nil
+}
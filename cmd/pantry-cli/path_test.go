@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePath(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		path string
+		want []pathStep
+		err  string
+	}{
+		{path: ""},
+		{path: "."},
+		{path: ".date", want: []pathStep{{key: "date"}}},
+		{path: ".prices[0].product", want: []pathStep{{key: "prices"}, {index: 0}, {key: "product"}}},
+		{path: "[1]", want: []pathStep{{index: 1}}},
+		{path: ".prices[-1]", want: []pathStep{{key: "prices"}, {index: -1}}},
+		{path: ".matrix[0][2]", want: []pathStep{{key: "matrix"}, {index: 0}, {index: 2}}},
+		{path: ".precio-min", want: []pathStep{{key: "precio-min"}}},
+		{path: "prices", err: "must start with . or ["},
+		{path: ".prices..product", err: "empty key"},
+		{path: ".prices.", err: "empty key"},
+		{path: ".prices[0", err: "missing ]"},
+		{path: ".prices[x]", err: `index "x" is not an integer`},
+		{path: ".prices[]", err: `index "" is not an integer`},
+		{path: ".prices[0]product", err: `unexpected 'p'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+			steps, err := parsePath(tt.path)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, steps)
+		})
+	}
+}
+
+func TestSelectPath(t *testing.T) {
+	t.Parallel()
+	var basket any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"date": "2025-06-18",
+		"prices": [
+			{"product": "PAPA", "avg": 1.5},
+			{"product": "CEBOLLA", "avg": 2}
+		]
+	}`), &basket))
+
+	tests := []struct {
+		path string
+		want any
+		err  string
+	}{
+		{path: ".", want: basket},
+		{path: ".date", want: "2025-06-18"},
+		{path: ".prices[0].product", want: "PAPA"},
+		{path: ".prices[1].avg", want: 2.0},
+		{path: ".prices[-1].product", want: "CEBOLLA"},
+		{path: ".prices[-2].product", want: "PAPA"},
+		{path: ".volumes", err: `no key "volumes" at .volumes`},
+		{path: ".prices[2]", err: "index 2 out of range at .prices[2] (2 items)"},
+		{path: ".prices[-3]", err: "index -3 out of range at .prices[-3] (2 items)"},
+		{path: ".prices.product", err: `cannot read key "product" of an array at .prices.product`},
+		{path: "[0]", err: "cannot index an object at [0]"},
+		{path: ".date.year", err: "cannot select .date.year of a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			t.Parallel()
+			steps, err := parsePath(tt.path)
+			require.NoError(t, err)
+			got, err := selectPath(basket, steps)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry"
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry/pantrytest"
+)
+
+// serveFakeCommand serves a pantrytest fake until interrupted
+func serveFakeCommand(fs *flag.FlagSet) runFunc {
+	addr := fs.String("addr", "127.0.0.1:8081", "Address to listen on")
+	dir := fs.String("dir", "", "Directory to keep baskets in as <name>.json files (default: in memory)")
+	key := fs.String("key", pantrytest.DefaultKey, "API key the fake accepts")
+	maxSize := fs.Int("max-size", pantrytest.DefaultMaxBasketSize, "Largest basket accepted, in bytes")
+	rate := fs.Int("rate", 0, "Requests per second before answering 429 (0: no limit)")
+	return func(ctx context.Context, _ *pantry.BasketManager, _ []string) error {
+		backend := pantrytest.NewMemoryBackend()
+		if *dir != "" {
+			var err error
+			if backend, err = pantrytest.NewDirBackend(*dir); err != nil {
+				return err
+			}
+		}
+		handler := pantrytest.NewHandler(pantrytest.WithBackend(backend), pantrytest.WithKey(*key),
+			pantrytest.WithMaxBasketSize(*maxSize), pantrytest.WithRateLimit(*rate))
+
+		listener, err := net.Listen("tcp", *addr)
+		if err != nil {
+			return err
+		}
+		server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+		fmt.Printf("Serving a fake Pantry, use it with:\n\n")
+		fmt.Printf("  export PANTRY_BASE_URL=http://%s%s PANTRY_API_KEY=%s\n\n", listener.Addr(), pantrytest.BasePath, *key)
+
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Error shutting down the fake: %v", err)
+			}
+		}()
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	}
+}
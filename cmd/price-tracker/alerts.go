@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/alert"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// openAlerter loads the -alerts rules file. An empty path returns a nil
+// alerter, meaning alerts are disabled.
+func openAlerter(rulesPath, statePath string, store storage.Store) (*alert.Alerter, error) {
+	if rulesPath == "" {
+		return nil, nil
+	}
+	cfg, err := alert.LoadConfig(rulesPath)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.NeedsHistory() && store == nil {
+		return nil, errors.New("change and percent_change rules compare with stored days, set -store")
+	}
+	return alert.New(cfg, statePath)
+}
+
+// checkAlerts evaluates the alert rules against a fetched day and logs the
+// alerts sent. Failures are logged and do not fail the run: undelivered
+// alerts are retried on the next run.
+func checkAlerts(ctx context.Context, alerter *alert.Alerter, store storage.Store, day storage.DailyPrices) {
+	if alerter == nil || day.IsEmpty() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	sent, err := alerter.Run(ctx, day, store)
+	for _, a := range sent {
+		log.Printf("Alert %s: %s %s %s %g %s %g", a.Rule, a.Product, a.Variety, a.Metric, a.Value, a.Operator, a.Threshold)
+	}
+	if err != nil {
+		log.Printf("Failed to send alerts for %s: %v", day.Date, err)
+	}
+}
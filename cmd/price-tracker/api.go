@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/alert"
+	"github.com/aliasthewho/price_tracker/internal/server"
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// newAPIServer returns the REST API serving the store. POST /scrape fetches
+// the day like single-day mode, and checks the alert rules once it is stored.
+func newAPIServer(store storage.Store, sources []source.PriceSource, reports []source.ReportType, alerter *alert.Alerter, timezone string) (*server.Server, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+	return server.New(server.Config{
+		Store:    store,
+		Location: loc,
+		Scrape: func(ctx context.Context, date time.Time) (server.ScrapeResult, error) {
+			result := fetchAndStoreDay(ctx, sources, reports, store, date)
+			if result.Status == dayFailed {
+				return server.ScrapeResult{}, result.Err
+			}
+			if result.Status == dayStored && alerter != nil {
+				if day, err := store.LoadDay(ctx, date); err == nil {
+					checkAlerts(ctx, alerter, store, day)
+				}
+			}
+			return server.ScrapeResult{
+				Date:    date.Format(storage.DateLayout),
+				Status:  string(result.Status),
+				Records: result.Records,
+			}, nil
+		},
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// dayStatus describes the outcome of backfilling a single day
+type dayStatus string
+
+const (
+	// dayStored means prices were fetched and saved to the store
+	dayStored dayStatus = "stored"
+	// dayEmpty means EMMSA returned an empty table (Sundays, holidays)
+	dayEmpty dayStatus = "empty"
+	// dayFailed means fetching or storing the day returned an error
+	dayFailed dayStatus = "failed"
+	// daySkipped means the day was already stored by a previous run
+	daySkipped dayStatus = "skipped"
+)
+
+// backfillOptions configures a backfill run
+type backfillOptions struct {
+	// concurrency bounds the number of days processed in parallel
+	concurrency int
+	// force re-fetches days that are already stored
+	force bool
+	// reports are the report types fetched for every day
+	reports []source.ReportType
+	// export, if set, receives every stored and skipped day of the range
+	export *dayExporter
+}
+
+// dayResult holds the outcome of backfilling a single day
+type dayResult struct {
+	Date    time.Time
+	Status  dayStatus
+	Records int
+	Err     error
+}
+
+// backfillSummary collects the results of a backfill run, ordered by date
+type backfillSummary struct {
+	Results []dayResult
+}
+
+// count returns the number of days with the given status
+func (s backfillSummary) count(status dayStatus) int {
+	n := 0
+	for _, r := range s.Results {
+		if r.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// report logs one line per day that was not stored plus the overall totals
+func (s backfillSummary) report() {
+	for _, r := range s.Results {
+		switch r.Status {
+		case dayEmpty:
+			log.Printf("%s: empty (no prices published)", r.Date.Format("2006-01-02"))
+		case dayFailed:
+			log.Printf("%s: failed: %v", r.Date.Format("2006-01-02"), r.Err)
+		}
+	}
+	log.Printf("Backfill finished: %d days, %d stored, %d skipped, %d empty, %d failed",
+		len(s.Results), s.count(dayStored), s.count(daySkipped), s.count(dayEmpty), s.count(dayFailed))
+}
+
+// exitsWhenDone reports whether the tracker exits as soon as its run completes
+// instead of serving metrics until interrupted. A backfill does, unless -api
+// keeps the REST API up; -schedule cannot be combined with a backfill
+func exitsWhenDone(backfill, api bool) bool {
+	return backfill && !api
+}
+
+// parseRange parses the -from and -to flags. An empty -to defaults to today,
+// the current UTC day, which is passed in so that tests can fix it. Ranges
+// ending after today are rejected: no prices are published for them yet.
+func parseRange(fromStr, toStr string, today time.Time) (time.Time, time.Time, error) {
+	if fromStr == "" {
+		return time.Time{}, time.Time{}, errors.New("-from is required when -to is set")
+	}
+	from, err := time.Parse("2006-01-02", fromStr)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid -from date: %w", err)
+	}
+
+	today = today.UTC().Truncate(24 * time.Hour)
+	to := today
+	if toStr != "" {
+		to, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -to date: %w", err)
+		}
+	}
+
+	switch {
+	case to.After(today):
+		return time.Time{}, time.Time{}, fmt.Errorf("-to (%s) is in the future", to.Format("2006-01-02"))
+	case to.Before(from):
+		return time.Time{}, time.Time{}, fmt.Errorf("-to (%s) is before -from (%s)", to.Format("2006-01-02"), fromStr)
+	}
+	return from, to, nil
+}
+
+// daysInRange returns every day between from and to, both inclusive
+func daysInRange(from, to time.Time) []time.Time {
+	var days []time.Time
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		days = append(days, d)
+	}
+	return days
+}
+
+// runBackfill fetches every day in the range and saves one result per day
+// to the store.
+//
+// Days that are already stored are skipped unless opts.force is set, so
+// re-running the same range only fetches the missing days. Empty days are not
+// saved and are therefore retried on the next run, which also picks up prices
+// that EMMSA published late.
+//
+// With opts.export, stored and skipped days are written to the output in the
+// order they complete, which is not necessarily date order.
+func runBackfill(ctx context.Context, from, to time.Time, sources []source.PriceSource, store storage.Store, opts backfillOptions) (backfillSummary, error) {
+	if store == nil {
+		return backfillSummary{}, errors.New("backfill needs a storage backend, set -store")
+	}
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+
+	stored := make(map[time.Time]bool)
+	if !opts.force {
+		listCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		days, err := store.ListDays(listCtx)
+		cancel()
+		if err != nil {
+			return backfillSummary{}, fmt.Errorf("failed to list stored days: %w", err)
+		}
+		for _, d := range days {
+			stored[d] = true
+		}
+	}
+
+	days := daysInRange(from, to)
+	results := make([]dayResult, len(days))
+	log.Printf("Backfilling %d days from %s to %s (concurrency %d)",
+		len(days), from.Format("2006-01-02"), to.Format("2006-01-02"), opts.concurrency)
+
+	sem := make(chan struct{}, opts.concurrency)
+	var wg sync.WaitGroup
+	for i, day := range days {
+		if stored[day] {
+			results[i] = dayResult{Date: day, Status: daySkipped}
+			if opts.export != nil {
+				opts.export.export(ctx, day)
+			}
+			continue
+		}
+
+		// Stop launching new days once interrupted; in-flight days are
+		// cancelled through ctx. The check comes first because select picks
+		// randomly when a slot is free too.
+		if ctx.Err() != nil {
+			results[i] = dayResult{Date: day, Status: dayFailed, Err: ctx.Err()}
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i] = dayResult{Date: day, Status: dayFailed, Err: ctx.Err()}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, day time.Time) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = fetchAndStoreDay(ctx, sources, opts.reports, store, day)
+			if opts.export != nil && results[i].Status == dayStored {
+				opts.export.export(ctx, day)
+			}
+		}(i, day)
+	}
+	wg.Wait()
+
+	summary := backfillSummary{Results: results}
+	if opts.export != nil && opts.export.err != nil {
+		return summary, fmt.Errorf("failed to export the range: %w", opts.export.err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/aliasthewho/price_tracker/internal/storage/localfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource is a price source returning one record per day, except for the
+// days in empty and fail
+type fakeSource struct {
+	// empty days have no prices, fail days return an error
+	empty, fail map[string]bool
+	// fetch, if set, runs at the start of every fetch
+	fetch func(ctx context.Context) error
+
+	mu       sync.Mutex
+	fetched  []string
+	inFlight int
+	// maxInFlight is the largest number of concurrent fetches seen
+	maxInFlight int
+}
+
+func (f *fakeSource) Name() string { return "fake" }
+func (f *fakeSource) ReportTypes() []source.ReportType {
+	return []source.ReportType{source.ReportDailyPrices}
+}
+func (f *fakeSource) Close() error { return nil }
+
+func (f *fakeSource) FetchPrices(ctx context.Context, date time.Time) ([]source.PriceRecord, error) {
+	day := date.Format(storage.DateLayout)
+	f.mu.Lock()
+	f.fetched = append(f.fetched, day)
+	f.inFlight++
+	f.maxInFlight = max(f.maxInFlight, f.inFlight)
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.inFlight--
+		f.mu.Unlock()
+	}()
+
+	if f.fetch != nil {
+		if err := f.fetch(ctx); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case f.fail[day]:
+		return nil, errors.New("upstream error")
+	case f.empty[day]:
+		return nil, nil
+	}
+	return []source.PriceRecord{{Date: day, Source: "fake", Product: "PAPA", Avg: 1.5}}, nil
+}
+
+// fetchedDays returns the days fetched so far, in any order
+func (f *fakeSource) fetchedDays() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.fetched...)
+}
+
+// day returns the date of a YYYY-MM-DD string
+func day(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse(storage.DateLayout, s)
+	require.NoError(t, err)
+	return d
+}
+
+// statuses returns the status of every day of a summary
+func statuses(summary backfillSummary) []dayStatus {
+	var s []dayStatus
+	for _, r := range summary.Results {
+		s = append(s, r.Status)
+	}
+	return s
+}
+
+// storedDays lists the days of the store
+func storedDays(t *testing.T, store storage.Store) []string {
+	t.Helper()
+	days, err := store.ListDays(context.Background())
+	require.NoError(t, err)
+	var s []string
+	for _, d := range days {
+		s = append(s, d.Format(storage.DateLayout))
+	}
+	return s
+}
+
+func newTestStore(t *testing.T) storage.Store {
+	t.Helper()
+	store, err := localfs.New(t.TempDir())
+	require.NoError(t, err)
+	return store
+}
+
+func TestParseRange(t *testing.T) {
+	t.Parallel()
+	// Late in the evening in Lima, already the next day in UTC
+	now := time.Date(2025, 6, 20, 1, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		from, to string
+		wantFrom string
+		wantTo   string
+		err      string
+	}{
+		{name: "explicit range", from: "2025-05-30", to: "2025-06-02", wantFrom: "2025-05-30", wantTo: "2025-06-02"},
+		{name: "single day", from: "2025-06-01", to: "2025-06-01", wantFrom: "2025-06-01", wantTo: "2025-06-01"},
+		{name: "to defaults to today", from: "2025-06-18", wantFrom: "2025-06-18", wantTo: "2025-06-20"},
+		{name: "to is today", from: "2025-06-18", to: "2025-06-20", wantFrom: "2025-06-18", wantTo: "2025-06-20"},
+		{name: "reversed", from: "2025-06-18", to: "2025-06-17", err: "-to (2025-06-17) is before -from (2025-06-18)"},
+		{name: "future to", from: "2025-06-18", to: "2025-06-21", err: "-to (2025-06-21) is in the future"},
+		{name: "future from", from: "2025-07-01", err: "is before -from (2025-07-01)"},
+		{name: "missing from", to: "2025-06-18", err: "-from is required"},
+		{name: "invalid from", from: "18/06/2025", err: "invalid -from date"},
+		{name: "invalid to", from: "2025-06-18", to: "2025-06-31", err: "invalid -to date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := parseRange(tt.from, tt.to, now)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, day(t, tt.wantFrom), from)
+			assert.Equal(t, day(t, tt.wantTo), to)
+		})
+	}
+}
+
+func TestDaysInRange(t *testing.T) {
+	t.Parallel()
+	days := daysInRange(day(t, "2024-02-28"), day(t, "2024-03-01"))
+	assert.Equal(t, []time.Time{day(t, "2024-02-28"), day(t, "2024-02-29"), day(t, "2024-03-01")}, days)
+	assert.Equal(t, []time.Time{day(t, "2025-06-18")}, daysInRange(day(t, "2025-06-18"), day(t, "2025-06-18")))
+}
+
+func TestExitsWhenDone(t *testing.T) {
+	t.Parallel()
+	assert.True(t, exitsWhenDone(true, false), "a backfill exits when it completes")
+	assert.False(t, exitsWhenDone(true, true), "-api keeps serving after a backfill")
+	assert.False(t, exitsWhenDone(false, false), "a single day keeps serving metrics")
+}
+
+func TestRunBackfill(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	from, to := day(t, "2025-06-16"), day(t, "2025-06-19")
+	reports := []source.ReportType{source.ReportDailyPrices}
+
+	t.Run("Skips stored days", func(t *testing.T) {
+		t.Parallel()
+		store := newTestStore(t)
+		require.NoError(t, store.SaveDay(ctx, storage.DailyPrices{Date: "2025-06-17",
+			Prices: []source.PriceRecord{{Product: "CEBOLLA"}}}))
+		src := &fakeSource{empty: map[string]bool{"2025-06-18": true}}
+
+		summary, err := runBackfill(ctx, from, to, []source.PriceSource{src}, store, backfillOptions{reports: reports, concurrency: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []dayStatus{dayStored, daySkipped, dayEmpty, dayStored}, statuses(summary))
+		assert.ElementsMatch(t, []string{"2025-06-16", "2025-06-18", "2025-06-19"}, src.fetchedDays())
+		assert.Equal(t, []string{"2025-06-16", "2025-06-17", "2025-06-19"}, storedDays(t, store), "empty days are not stored")
+
+		stored, err := store.LoadDay(ctx, day(t, "2025-06-17"))
+		require.NoError(t, err)
+		assert.Equal(t, "CEBOLLA", stored.Prices[0].Product, "skipped days are left as they are")
+	})
+
+	t.Run("Resumes after a partial run", func(t *testing.T) {
+		t.Parallel()
+		store := newTestStore(t)
+		src := &fakeSource{fail: map[string]bool{"2025-06-17": true, "2025-06-19": true}}
+		opts := backfillOptions{reports: reports, concurrency: 2}
+
+		summary, err := runBackfill(ctx, from, to, []source.PriceSource{src}, store, opts)
+		require.NoError(t, err)
+		assert.Equal(t, []dayStatus{dayStored, dayFailed, dayStored, dayFailed}, statuses(summary))
+		assert.Equal(t, 2, summary.count(dayFailed))
+
+		// The second run only fetches the days that failed
+		src = &fakeSource{}
+		summary, err = runBackfill(ctx, from, to, []source.PriceSource{src}, store, opts)
+		require.NoError(t, err)
+		assert.Equal(t, []dayStatus{daySkipped, dayStored, daySkipped, dayStored}, statuses(summary))
+		assert.ElementsMatch(t, []string{"2025-06-17", "2025-06-19"}, src.fetchedDays())
+		assert.Equal(t, []string{"2025-06-16", "2025-06-17", "2025-06-18", "2025-06-19"}, storedDays(t, store))
+
+		// -force fetches them all again
+		src = &fakeSource{}
+		opts.force = true
+		summary, err = runBackfill(ctx, from, to, []source.PriceSource{src}, store, opts)
+		require.NoError(t, err)
+		assert.Equal(t, 4, summary.count(dayStored))
+		assert.Len(t, src.fetchedDays(), 4)
+	})
+
+	t.Run("Concurrency limit", func(t *testing.T) {
+		t.Parallel()
+		src := &fakeSource{fetch: func(context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}}
+		summary, err := runBackfill(ctx, day(t, "2025-06-01"), day(t, "2025-06-12"), []source.PriceSource{src}, newTestStore(t),
+			backfillOptions{reports: reports, concurrency: 3})
+		require.NoError(t, err)
+		assert.Equal(t, 12, summary.count(dayStored))
+		assert.LessOrEqual(t, src.maxInFlight, 3)
+		assert.Greater(t, src.maxInFlight, 1, "days are fetched in parallel")
+	})
+
+	t.Run("Stops on cancellation", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		// The first day is interrupted while it is being fetched
+		src := &fakeSource{fetch: func(ctx context.Context) error {
+			cancel()
+			<-ctx.Done()
+			return ctx.Err()
+		}}
+		store := newTestStore(t)
+
+		summary, err := runBackfill(ctx, from, to, []source.PriceSource{src}, store, backfillOptions{reports: reports, concurrency: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []dayStatus{dayFailed, dayFailed, dayFailed, dayFailed}, statuses(summary))
+		for _, r := range summary.Results {
+			assert.ErrorIs(t, r.Err, context.Canceled)
+		}
+		assert.Len(t, src.fetchedDays(), 1, "no day is started once cancelled")
+		assert.Empty(t, storedDays(t, store))
+	})
+
+	t.Run("Needs a store", func(t *testing.T) {
+		t.Parallel()
+		_, err := runBackfill(ctx, from, to, []source.PriceSource{&fakeSource{}}, nil, backfillOptions{reports: reports})
+		assert.ErrorContains(t, err, "needs a storage backend")
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/diff"
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// runDiffCommand implements "price-tracker diff": it loads two stored days
+// and reports the price changes between them
+func runDiffCommand(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fromStr := fs.String("from", "", "First day in YYYY-MM-DD format (default: the day before -to)")
+	toStr := fs.String("to", "", "Second day in YYYY-MM-DD format (default: today)")
+	format := fs.String("format", diff.FormatText, "Output format: text, json or csv")
+	sortOrder := fs.String("sort", string(diff.SortByChange), "Sort order: change (largest average moves first) or product")
+	all := fs.Bool("all", false, "Include unchanged varieties")
+	outputFile := fs.String("output", "", "Output file (default: stdout)")
+	storeBackend := fs.String("store", envOr("PRICE_TRACKER_STORE", ""), "Storage backend the days were saved to: pantry, file or sqlite (env PRICE_TRACKER_STORE)")
+	storePath := fs.String("store-path", envOr("PRICE_TRACKER_STORE_PATH", ""), "Directory of the file backend or database of the sqlite backend (env PRICE_TRACKER_STORE_PATH)")
+	pantryConfig := fs.String("pantry-config", envOr("PANTRY_CONFIG", ""), "JSON file of named pantries (default: read the pantry from PANTRY_* variables, env PANTRY_CONFIG)")
+	pantryName := fs.String("pantry-name", envOr("PANTRY_NAME", ""), "Pantry of -pantry-config to use (default: its default pantry, env PANTRY_NAME)")
+	var filter source.Filter
+	fs.Var((*stringList)(&filter.Products), "product", "Only compare this product, case and accent insensitive (repeatable)")
+	fs.Var((*stringList)(&filter.Varieties), "variety", "Only compare this variety, case and accent insensitive (repeatable)")
+	fs.Parse(args)
+
+	from, to, err := parseDiffDays(*fromStr, *toStr)
+	if err != nil {
+		return err
+	}
+	order := diff.SortOrder(*sortOrder)
+	if order != diff.SortByChange && order != diff.SortByProduct {
+		return fmt.Errorf("unknown sort order %q (available: change, product)", *sortOrder)
+	}
+
+	if *storeBackend == "" {
+		return errors.New("diff needs the storage backend the days were saved to, set -store")
+	}
+	store, err := openStore(storeOptions{
+		backend:      *storeBackend,
+		path:         *storePath,
+		pantryConfig: *pantryConfig,
+		pantryName:   *pantryName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	before, err := store.LoadDay(ctx, from)
+	if err != nil {
+		return fmt.Errorf("failed to load -from day: %w", err)
+	}
+	after, err := store.LoadDay(ctx, to)
+	if err != nil {
+		return fmt.Errorf("failed to load -to day: %w", err)
+	}
+	before.Prices = filter.Apply(before.Prices)
+	after.Prices = filter.Apply(after.Prices)
+
+	report := diff.CompareDays(before, after)
+	if !*all {
+		report = report.Without(diff.StatusUnchanged)
+	}
+	report.Sort(order)
+
+	if *outputFile == "" {
+		return diff.Write(os.Stdout, report, *format)
+	}
+	f, err := os.Create(*outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := diff.Write(f, report, *format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseDiffDays parses the -from and -to flags of the diff command
+func parseDiffDays(fromStr, toStr string) (time.Time, time.Time, error) {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if toStr != "" {
+		var err error
+		to, err = time.Parse(storage.DateLayout, toStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -to date: %w", err)
+		}
+	}
+
+	from := to.AddDate(0, 0, -1)
+	if fromStr != "" {
+		var err error
+		from, err = time.Parse(storage.DateLayout, fromStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -from date: %w", err)
+		}
+	}
+	return from, to, nil
+}
@@ -2,35 +2,156 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // embed the timezone database for -timezone in minimal containers
 
-	"github.com/aliasthewho/price_tracker/internal/metrics"
+	"github.com/aliasthewho/price_tracker/internal/alert"
 	scraper "github.com/aliasthewho/price_tracker/internal/api/emmsa"
-	"github.com/aliasthewho/price_tracker/internal/storage/pantry"
+	"github.com/aliasthewho/price_tracker/internal/export"
+	"github.com/aliasthewho/price_tracker/internal/metrics"
+	"github.com/aliasthewho/price_tracker/internal/scheduler"
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// version is the version of the tracker, set at build time with
+// -ldflags "-X main.version=v1.2.3". It is recorded in every Pantry basket.
+var version = "dev"
+
+// subcommands are run as "price-tracker <name> [flags]"; without one the
+// tracker fetches prices
+var subcommands = map[string]func(args []string) error{
+	"diff":  runDiffCommand,
+	"query": runQueryCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
 	// Parse command line flags
-	outputFile := flag.String("output", "", "Output JSON file (default: stdout)")
+	outputFile := flag.String("output", "", `Output file (default: stdout; in backfill mode, "-" writes the range to stdout)`)
+	outputFormat := flag.String("format", string(export.FormatJSON), "Output format: json, ndjson, csv, tsv or parquet")
+	decimalSep := flag.String("decimal-separator", ".", `Decimal separator of csv and tsv numbers: "." or "," (csv fields are then separated by ";")`)
 	dateStr := flag.String("date", "", "Date in YYYY-MM-DD format (default: today)")
-	enablePantry := flag.Bool("pantry", false, "Enable Pantry storage")
+	fromStr := flag.String("from", "", "Start of a backfill range in YYYY-MM-DD format (inclusive)")
+	toStr := flag.String("to", "", "End of a backfill range in YYYY-MM-DD format (inclusive, default: today)")
+	concurrency := flag.Int("concurrency", 4, "Maximum number of days fetched in parallel in backfill mode")
+	force := flag.Bool("force", false, "Re-fetch days that are already stored in backfill mode")
+	storeBackend := flag.String("store", envOr("PRICE_TRACKER_STORE", ""), "Storage backend: pantry, file or sqlite (default: none, env PRICE_TRACKER_STORE)")
+	storePath := flag.String("store-path", envOr("PRICE_TRACKER_STORE_PATH", ""), "Directory of the file backend or database of the sqlite backend (env PRICE_TRACKER_STORE_PATH)")
+	pantryConfig := flag.String("pantry-config", envOr("PANTRY_CONFIG", ""), "JSON file of named pantries (default: read the pantry from PANTRY_* variables, env PANTRY_CONFIG)")
+	pantryName := flag.String("pantry-name", envOr("PANTRY_NAME", ""), "Pantry of -pantry-config to use (default: its default pantry, env PANTRY_NAME)")
+	writeMode := flag.String("write-mode", writeReplace, "How to store a day that is already stored: replace, merge (pantry only) or skip-if-exists")
+	enablePantry := flag.Bool("pantry", false, "Enable Pantry storage (deprecated: use -store pantry)")
+	scheduleSpec := flag.String("schedule", "", `Run as a daemon on a daily "HH:MM" time or cron expression (e.g. "30 7 * * 1-6")`)
+	timezone := flag.String("timezone", scheduler.DefaultTimezone, "Timezone of -schedule and of the scheduled day")
+	retryInterval := flag.Duration("retry-interval", time.Hour, "Delay before retrying a failed or empty day in schedule mode (0 disables retries)")
+	stateFile := flag.String("state-file", "price-tracker-state.json", "File the scheduler state is persisted to")
+	sourceNames := flag.String("source", scraper.SourceName, "Comma-separated list of price sources to fetch from")
+	reportNames := flag.String("report", string(source.ReportDailyPrices), "Comma-separated list of reports to fetch: daily-prices, daily-volumes")
+	fetchAttempts := flag.Int("fetch-attempts", scraper.DefaultRetryPolicy().MaxAttempts, "Attempts per EMMSA request before giving up on transient failures")
+	fetchBackoff := flag.Duration("fetch-backoff", scraper.DefaultRetryPolicy().InitialBackoff, "Initial delay between EMMSA request attempts, doubled after every retry")
+	var filter source.Filter
+	flag.Var((*stringList)(&filter.Products), "product", "Only fetch prices of this product, case and accent insensitive (repeatable)")
+	flag.Var((*stringList)(&filter.Varieties), "variety", "Only fetch prices of this variety, case and accent insensitive (repeatable)")
+	alertsPath := flag.String("alerts", envOr("PRICE_TRACKER_ALERTS", ""), "JSON file of price alert rules and webhooks (default: no alerts, env PRICE_TRACKER_ALERTS)")
+	alertState := flag.String("alert-state", "price-tracker-alerts.json", "File the alerts already sent are persisted to")
 	debug := flag.Bool("debug", false, "Enable debug logging")
 	metricsAddr := flag.String("metrics-addr", ":2112", "The address to expose Prometheus metrics")
+	enableAPI := flag.Bool("api", false, "Serve the REST API on -metrics-addr (needs -store)")
+	showVersion := flag.Bool("v", false, "Show version")
 	flag.Parse()
 
-	// Start metrics server in a goroutine
+	if *showVersion {
+		fmt.Println("price-tracker", version)
+		return
+	}
+
+	// Set up logging
+	if *debug {
+		log.SetFlags(log.LstdFlags | log.Lshortfile)
+	} else {
+		log.SetFlags(log.LstdFlags)
+	}
+
+	output, err := parseOutputOptions(*outputFile, *outputFormat, *decimalSep)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Open the storage backend
+	if *enablePantry {
+		if *storeBackend != "" && *storeBackend != backendPantry {
+			log.Fatalf("-pantry cannot be combined with -store %s", *storeBackend)
+		}
+		*storeBackend = backendPantry
+	}
+	store, err := openStore(storeOptions{
+		backend:      *storeBackend,
+		path:         *storePath,
+		writeMode:    *writeMode,
+		pantryConfig: *pantryConfig,
+		pantryName:   *pantryName,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	if store != nil {
+		defer store.Close()
+	}
+
+	alerter, err := openAlerter(*alertsPath, *alertState, store)
+	if err != nil {
+		log.Fatalf("Failed to load alert rules: %v", err)
+	}
+
+	// Create the selected price sources
+	retryPolicy := scraper.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = *fetchAttempts
+	retryPolicy.InitialBackoff = *fetchBackoff
+	sources, err := newSourceRegistry(retryPolicy, filter).Open(*sourceNames)
+	if err != nil {
+		log.Fatalf("Failed to create price sources: %v", err)
+	}
+	defer source.CloseAll(sources)
+	reports, err := source.ParseReportTypes(*reportNames)
+	if err != nil {
+		log.Fatalf("Invalid -report: %v", err)
+	}
+	if err := checkReports(sources, reports); err != nil {
+		log.Fatalf("Invalid -report: %v", err)
+	}
+
+	// Start the metrics server, and the REST API next to it, in a goroutine
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	if *enableAPI {
+		api, err := newAPIServer(store, sources, reports, alerter, *timezone)
+		if err != nil {
+			log.Fatalf("Failed to start the API: %v", err)
+		}
+		api.Register(mux)
+	}
 	metricsServer := &http.Server{
 		Addr:    *metricsAddr,
-		Handler: promhttp.Handler(),
+		Handler: mux,
 	}
 
 	go func() {
@@ -40,149 +161,248 @@ func main() {
 		}
 	}()
 
-	// Set up logging
-	if *debug {
-		log.SetFlags(log.LstdFlags | log.Lshortfile)
+	// Stop on interrupt so the scheduler and the metrics server shut down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	backfill := *fromStr != "" || *toStr != ""
+	if *scheduleSpec != "" {
+		// Run the pipeline on a schedule until interrupted
+		if *dateStr != "" || *fromStr != "" || *toStr != "" {
+			log.Fatalf("-schedule cannot be combined with -date or -from/-to")
+		}
+		err := runSchedule(ctx, sources, store, scheduleOptions{
+			reports:       reports,
+			alerter:       alerter,
+			spec:          *scheduleSpec,
+			timezone:      *timezone,
+			retryInterval: *retryInterval,
+			stateFile:     *stateFile,
+			skipExisting:  *writeMode == writeSkipIfExists,
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatalf("Scheduler failed: %v", err)
+		}
+	} else if backfill {
+		// Backfill a range of days instead of a single date
+		if *dateStr != "" {
+			log.Fatalf("-date cannot be combined with -from/-to")
+		}
+		if *force && *writeMode == writeSkipIfExists {
+			log.Fatalf("-force cannot be combined with -write-mode %s", writeSkipIfExists)
+		}
+		from, to, err := parseRange(*fromStr, *toStr, time.Now())
+		if err != nil {
+			log.Fatalf("Invalid backfill range: %v", err)
+		}
+		opts := backfillOptions{
+			reports:     reports,
+			concurrency: *concurrency,
+			force:       *force,
+		}
+		closeOutput := func() error { return nil }
+		if *outputFile != "" && store != nil {
+			// Stream the range to the output as days are stored
+			w, closeFn, err := output.open(true)
+			if err != nil {
+				log.Fatalf("Failed to open output: %v", err)
+			}
+			opts.export, closeOutput = &dayExporter{store: store, w: w}, closeFn
+		}
+		summary, err := runBackfill(ctx, from, to, sources, store, opts)
+		if err := errors.Join(err, closeOutput()); err != nil {
+			log.Fatalf("Backfill failed: %v", err)
+		}
+		summary.report()
+		if opts.export != nil && !output.stdout() {
+			log.Printf("Range written to %s", output.path)
+		}
 	} else {
-		log.SetFlags(log.LstdFlags)
+		// Parse date
+		var date time.Time
+		if *dateStr == "" {
+			date = time.Now()
+		} else {
+			date, err = time.Parse("2006-01-02", *dateStr)
+			if err != nil {
+				log.Fatalf("Invalid date format: %v. Expected YYYY-MM-DD", err)
+			}
+		}
+
+		// Run the price scraping and keep the metrics server running in the background
+		runPriceScraping(ctx, date, sources, reports, store, alerter, output, *writeMode == writeSkipIfExists)
 	}
 
-	// Parse date
-	var date time.Time
-	var err error
-	if *dateStr == "" {
-		date = time.Now()
-	} else {
-		date, err = time.Parse("2006-01-02", *dateStr)
-		if err != nil {
-			log.Fatalf("Invalid date format: %v. Expected YYYY-MM-DD", err)
+	// Wait for interrupt signal to gracefully shutdown the server, unless a
+	// finished backfill has nothing left to serve
+	if !exitsWhenDone(backfill, *enableAPI) {
+		if *scheduleSpec == "" {
+			log.Println("Press Ctrl+C to exit")
 		}
+		<-ctx.Done()
+		log.Println("Shutting down...")
 	}
 
-	// Run the price scraping and keep the metrics server running in the background
-	runPriceScraping(date, *enablePantry, *outputFile)
-	
-	// Wait for interrupt signal to gracefully shutdown the server
-	log.Println("Press Ctrl+C to exit")
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
-	log.Println("Shutting down...")
-	
 	// Create a context with timeout for graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	
+
 	// Shutdown the metrics server
-	if err := metricsServer.Shutdown(ctx); err != nil {
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Error shutting down metrics server: %v", err)
 	}
 }
 
-func runPriceScraping(date time.Time, enablePantry bool, outputFile string) {
-	// Create a new EMMSA scraper
-	s, err := scraper.NewEMMSAScraper()
-	if err != nil {
-		log.Fatalf("Failed to create scraper: %v", err)
-	}
+// newSourceRegistry returns the registry of all price sources known to the tracker
+func newSourceRegistry(retryPolicy scraper.RetryPolicy, filter source.Filter) *source.Registry {
+	registry := source.NewRegistry()
+	registry.Register(scraper.SourceName, func() (source.PriceSource, error) {
+		return scraper.NewSource(scraper.WithRetryPolicy(retryPolicy), scraper.WithFilter(filter))
+	})
+	return registry
+}
 
-	// Scrape prices with metrics
-	startTime := time.Now()
-	prices, err := s.ScrapePrices(date)
-	duration := time.Since(startTime).Seconds()
-	
-	// Record metrics
-	status := "success"
-	if err != nil {
-		status = "error"
-	}
-	metrics.RecordPriceRequest(status, duration, "scrape")
-	if err != nil {
-		s.Close()
-		log.Fatalf("Failed to fetch prices: %v", err)
-	}
-	// Don't use defer with Fatalf as it won't run deferred functions
-	s.Close()
+// stringList is a flag.Value collecting every occurrence of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
 
-	// Prepare data for storage
-	data := map[string]interface{}{
-		"date":    date.Format("2006-01-02"),
-		"prices":  prices,
-		"fetched": time.Now().Format(time.RFC3339),
+func (l *stringList) Set(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return fmt.Errorf("value must not be empty")
 	}
+	*l = append(*l, value)
+	return nil
+}
 
-	// Save to Pantry if enabled
-	if enablePantry {
-		startTime := time.Now()
-		err = saveToPantry(date, data)
-		duration := time.Since(startTime).Seconds()
-		
-		// Record metrics
-		status := "success"
+func runPriceScraping(ctx context.Context, date time.Time, sources []source.PriceSource, reports []source.ReportType, store storage.Store, alerter *alert.Alerter, output outputOptions, skipExisting bool) {
+	if skipExisting && store != nil {
+		stored, ok, err := loadStoredDay(ctx, store, date)
 		if err != nil {
-			status = "error"
+			log.Fatalf("Failed to check for stored prices: %v", err)
 		}
-		metrics.RecordPantryOperation("save", status, duration)
-		
-		if err != nil {
-			log.Fatalf("Failed to save to Pantry: %v", err)
+		if ok {
+			log.Printf("Prices for %s are already stored, skipping the fetch", stored.Date)
+			if err := output.writeDay(stored); err != nil {
+				log.Fatalf("Failed to write prices: %v", err)
+			}
+			return
 		}
 	}
 
-	// Marshal prices to JSON
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+	data, err := scrapeDay(ctx, sources, reports, date)
 	if err != nil {
-		log.Fatalf("Failed to marshal prices to JSON: %v", err)
+		log.Fatalf("Failed to fetch prices: %v", err)
 	}
 
-	// Output results
-	if outputFile != "" {
-		// Write to file
-		err = os.WriteFile(outputFile, jsonData, 0o600) // Use 0o600 for octal literal
-		if err != nil {
-			log.Fatalf("Failed to write to file: %v", err)
+	// Save to the storage backend if enabled
+	if store != nil {
+		if err := saveDay(ctx, store, data); err != nil {
+			log.Fatalf("Failed to save prices: %v", err)
 		}
-		log.Printf("Prices written to %s", outputFile)
-	} else {
-		// Print to stdout
-		fmt.Println(string(jsonData))
+		log.Printf("Saved %d prices and %d volumes for %s", len(data.Prices), len(data.Volumes), data.Date)
+	}
+	checkAlerts(ctx, alerter, store, data)
+
+	// Output results to the file, or stdout
+	if err := output.writeDay(data); err != nil {
+		log.Fatalf("Failed to write prices: %v", err)
+	}
+	if !output.stdout() {
+		log.Printf("Prices written to %s", output.path)
 	}
 }
 
-func saveToPantry(date time.Time, data interface{}) error {
-	// Initialize Pantry config
-	cfg, err := pantry.NewConfigFromEnv()
-	if err != nil {
-		return fmt.Errorf("error loading Pantry config: %w", err)
+// checkReports returns an error if a report is not produced by any of the sources
+func checkReports(sources []source.PriceSource, reports []source.ReportType) error {
+	for _, report := range reports {
+		supported := false
+		for _, s := range sources {
+			if source.Supports(s, report) {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("no selected source produces the %s report", report)
+		}
 	}
+	return nil
+}
 
-	// Create a new context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// scrapeDay fetches the selected reports for a single day from every source
+// that produces them and records the request metrics. The day fails as a
+// whole if any source fails.
+func scrapeDay(ctx context.Context, sources []source.PriceSource, reports []source.ReportType, date time.Time) (storage.DailyPrices, error) {
+	day := storage.NewDailyPrices(date, nil)
+	for _, s := range sources {
+		for _, report := range reports {
+			if !source.Supports(s, report) {
+				continue
+			}
 
-	// Initialize BasketManager
-	manager := pantry.NewBasketManager(cfg)
-	basketName := pantry.BasketName(date)
+			startTime := time.Now()
+			var err error
+			switch report {
+			case source.ReportDailyPrices:
+				var records []source.PriceRecord
+				records, err = s.FetchPrices(ctx, date)
+				day.Prices = append(day.Prices, records...)
+			case source.ReportDailyVolumes:
+				volumeSource, ok := s.(source.VolumeSource)
+				if !ok {
+					return storage.DailyPrices{}, fmt.Errorf("%s: does not implement source.VolumeSource", s.Name())
+				}
+				var records []source.VolumeRecord
+				records, err = volumeSource.FetchVolumes(ctx, date)
+				day.Volumes = append(day.Volumes, records...)
+			}
+			duration := time.Since(startTime).Seconds()
 
-	// Check if basket exists
-	exists, err := manager.BasketExists(ctx, basketName)
-	if err != nil {
-		return fmt.Errorf("error checking if basket exists: %w", err)
+			// Record metrics
+			status := "success"
+			if err != nil {
+				status = "error"
+			}
+			metrics.RecordPriceRequest(status, duration, string(report))
+			if err != nil {
+				return storage.DailyPrices{}, fmt.Errorf("%s %s: %w", s.Name(), report, err)
+			}
+		}
 	}
+	return day, nil
+}
 
-	// Create basket if it doesn't exist
-	if !exists {
-		if err := manager.CreateBasket(ctx, basketName); err != nil {
-			return fmt.Errorf("error creating basket: %w", err)
-		}
-		log.Printf("Created new Pantry basket: %s", basketName)
+// fetchAndStoreDay fetches a single day from every source and saves it to the
+// store. Empty days are reported but not saved.
+func fetchAndStoreDay(ctx context.Context, sources []source.PriceSource, reports []source.ReportType, store storage.Store, date time.Time) dayResult {
+	result := dayResult{Date: date}
+
+	day, err := scrapeDay(ctx, sources, reports, date)
+	if err != nil {
+		result.Status, result.Err = dayFailed, err
+		return result
 	}
+	if day.IsEmpty() {
+		result.Status = dayEmpty
+		return result
+	}
+	result.Records = len(day.Prices) + len(day.Volumes)
 
-	// Update basket with data
-	if err := manager.UpdateBasket(ctx, basketName, data); err != nil {
-		return fmt.Errorf("error updating basket: %w", err)
+	if err := saveDay(ctx, store, day); err != nil {
+		result.Status, result.Err = dayFailed, err
+		return result
 	}
 
-	log.Printf("Successfully updated Pantry basket: %s", basketName)
-	return nil
+	result.Status = dayStored
+	return result
+}
+
+// saveDay saves the day to the store with a timeout
+func saveDay(ctx context.Context, store storage.Store, day storage.DailyPrices) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return store.SaveDay(ctx, day)
 }
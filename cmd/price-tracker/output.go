@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aliasthewho/price_tracker/internal/export"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// outputOptions are the -output, -format and -decimal-separator flags
+type outputOptions struct {
+	// path is the output file, stdout if empty or "-"
+	path    string
+	format  export.Format
+	decimal rune
+}
+
+// parseOutputOptions validates the output flags
+func parseOutputOptions(path, format, decimal string) (outputOptions, error) {
+	f, err := export.ParseFormat(format)
+	if err != nil {
+		return outputOptions{}, fmt.Errorf("invalid -format: %w", err)
+	}
+	sep, size := utf8.DecodeRuneInString(decimal)
+	if size == 0 || size != len(decimal) {
+		return outputOptions{}, fmt.Errorf("invalid -decimal-separator %q, expected a single character", decimal)
+	}
+	opts := outputOptions{path: path, format: f, decimal: sep}
+	// Validate the separator now rather than after the day is fetched
+	if _, err := export.NewWriter(io.Discard, f, export.Options{Decimal: sep}); err != nil {
+		return outputOptions{}, fmt.Errorf("invalid -decimal-separator: %w", err)
+	}
+	return opts, nil
+}
+
+// stdout reports whether the output goes to stdout
+func (o outputOptions) stdout() bool {
+	return o.path == "" || o.path == "-"
+}
+
+// open creates the output file and returns a writer in the output format.
+// The returned close function closes the writer, then the file.
+func (o outputOptions) open(multiple bool) (export.Writer, func() error, error) {
+	file := os.Stdout
+	if !o.stdout() {
+		var err error
+		file, err = os.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create %s: %w", o.path, err)
+		}
+	}
+	buf := bufio.NewWriter(file)
+	w, err := export.NewWriter(buf, o.format, export.Options{Decimal: o.decimal, Multiple: multiple})
+	if err != nil {
+		if !o.stdout() {
+			file.Close()
+		}
+		return nil, nil, err
+	}
+
+	closeOutput := func() error {
+		err := errors.Join(w.Close(), buf.Flush())
+		if !o.stdout() {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}
+	return w, closeOutput, nil
+}
+
+// writeDay writes a single day to the output
+func (o outputOptions) writeDay(day storage.DailyPrices) error {
+	w, closeOutput, err := o.open(false)
+	if err != nil {
+		return err
+	}
+	if err := w.WriteDay(day); err != nil {
+		_ = closeOutput() // the write error is reported instead
+		return err
+	}
+	return closeOutput()
+}
+
+// dayExporter writes backfilled days to the output as they complete, so a
+// large backfill is streamed instead of being held in memory
+type dayExporter struct {
+	store storage.Store
+	w     export.Writer
+
+	mu sync.Mutex
+	// err is the first load or write error; later days are not written
+	err error
+}
+
+// export loads a stored day and writes it to the output
+func (e *dayExporter) export(ctx context.Context, date time.Time) {
+	day, err := e.store.LoadDay(ctx, date)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return
+	}
+	if err != nil {
+		e.err = fmt.Errorf("failed to load %s: %w", date.Format(storage.DateLayout), err)
+		return
+	}
+	if err := e.w.WriteDay(day); err != nil {
+		e.err = fmt.Errorf("failed to write %s: %w", day.Date, err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/query"
+	"github.com/aliasthewho/price_tracker/internal/source"
+)
+
+// runQueryCommand implements "price-tracker query": it prints the price time
+// series of a date range loaded from the storage backend
+func runQueryCommand(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	fromStr := fs.String("from", "", "First day of the range in YYYY-MM-DD format (required)")
+	toStr := fs.String("to", "", "Last day of the range in YYYY-MM-DD format (default: today)")
+	field := fs.String("field", source.FieldAvg, "Price to read: min, max or avg")
+	interval := fs.String("interval", string(query.IntervalDay), "Point interval: day, week (starting on Monday) or month")
+	agg := fs.String("agg", string(query.AggregateMean), "Aggregation of weekly and monthly points: mean, min, max or last")
+	format := fs.String("format", query.FormatJSON, "Output format: json or csv")
+	outputFile := fs.String("output", "", "Output file (default: stdout)")
+	storeBackend := fs.String("store", envOr("PRICE_TRACKER_STORE", ""), "Storage backend the days were saved to: pantry, file or sqlite (env PRICE_TRACKER_STORE)")
+	storePath := fs.String("store-path", envOr("PRICE_TRACKER_STORE_PATH", ""), "Directory of the file backend or database of the sqlite backend (env PRICE_TRACKER_STORE_PATH)")
+	pantryConfig := fs.String("pantry-config", envOr("PANTRY_CONFIG", ""), "JSON file of named pantries (default: read the pantry from PANTRY_* variables, env PANTRY_CONFIG)")
+	pantryName := fs.String("pantry-name", envOr("PANTRY_NAME", ""), "Pantry of -pantry-config to use (default: its default pantry, env PANTRY_NAME)")
+	var filter source.Filter
+	fs.Var((*stringList)(&filter.Products), "product", "Only query this product, case and accent insensitive (repeatable)")
+	fs.Var((*stringList)(&filter.Varieties), "variety", "Only query this variety, case and accent insensitive (repeatable)")
+	fs.Parse(args)
+
+	if *fromStr == "" {
+		return errors.New("-from is required")
+	}
+	from, to, err := parseRange(*fromStr, *toStr, time.Now())
+	if err != nil {
+		return err
+	}
+	req := query.Request{
+		From:        from,
+		To:          to,
+		Filter:      filter,
+		Field:       *field,
+		Interval:    query.Interval(*interval),
+		Aggregation: query.Aggregation(*agg),
+	}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	if *format != query.FormatJSON && *format != query.FormatCSV {
+		return fmt.Errorf("unknown format %q (available: json, csv)", *format)
+	}
+
+	if *storeBackend == "" {
+		return errors.New("query needs the storage backend the days were saved to, set -store")
+	}
+	store, err := openStore(storeOptions{
+		backend:      *storeBackend,
+		path:         *storePath,
+		pantryConfig: *pantryConfig,
+		pantryName:   *pantryName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	result, err := query.Run(ctx, store, req)
+	if err != nil {
+		return err
+	}
+
+	if *outputFile == "" {
+		return query.Write(os.Stdout, result, *format)
+	}
+	f, err := os.Create(*outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := query.Write(f, result, *format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/alert"
+	"github.com/aliasthewho/price_tracker/internal/scheduler"
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// scheduleOptions configures schedule mode
+type scheduleOptions struct {
+	// spec is a daily "HH:MM" time or a cron expression
+	spec string
+	// timezone is the IANA timezone of spec and of the scheduled day
+	timezone string
+	// retryInterval is the delay before retrying a failed or empty day
+	retryInterval time.Duration
+	// stateFile is where the scheduler state is persisted
+	stateFile string
+	// reports are the report types fetched for every day
+	reports []source.ReportType
+	// alerter checks the alert rules after every stored day, nil if disabled
+	alerter *alert.Alerter
+	// skipExisting does not fetch days that are already stored
+	skipExisting bool
+}
+
+// runSchedule fetches and stores the current day on the schedule until ctx
+// is cancelled, retrying failed and empty days later in the same day.
+func runSchedule(ctx context.Context, sources []source.PriceSource, store storage.Store, opts scheduleOptions) error {
+	if store == nil {
+		return errors.New("schedule mode needs a storage backend, set -store")
+	}
+
+	loc, err := time.LoadLocation(opts.timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone: %w", err)
+	}
+	schedule, err := scheduler.ParseSchedule(opts.spec, loc)
+	if err != nil {
+		return err
+	}
+
+	s, err := scheduler.New(scheduler.Config{
+		Schedule:      schedule,
+		Location:      loc,
+		RetryInterval: opts.retryInterval,
+		StatePath:     opts.stateFile,
+		Job: func(ctx context.Context, day time.Time) error {
+			if opts.skipExisting {
+				_, ok, err := loadStoredDay(ctx, store, day)
+				if err != nil {
+					return fmt.Errorf("failed to check for stored prices: %w", err)
+				}
+				if ok {
+					log.Printf("Prices for %s are already stored, skipping the fetch", day.Format("2006-01-02"))
+					return nil
+				}
+			}
+			result := fetchAndStoreDay(ctx, sources, opts.reports, store, day)
+			switch result.Status {
+			case dayEmpty:
+				return scheduler.ErrEmpty
+			case dayFailed:
+				return result.Err
+			}
+			log.Printf("Stored %d records for %s", result.Records, day.Format("2006-01-02"))
+			if opts.alerter != nil {
+				stored, err := store.LoadDay(ctx, day)
+				if err != nil {
+					log.Printf("Failed to load %s for alerts: %v", day.Format("2006-01-02"), err)
+					return nil
+				}
+				checkAlerts(ctx, opts.alerter, store, stored)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Running on schedule %q (%s)", opts.spec, loc)
+	return s.Run(ctx)
+}
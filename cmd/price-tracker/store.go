@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/metrics"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/aliasthewho/price_tracker/internal/storage/localfs"
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry"
+	"github.com/aliasthewho/price_tracker/internal/storage/sqlite"
+)
+
+// Storage backends selectable with -store
+const (
+	backendPantry = "pantry"
+	backendFile   = "file"
+	backendSQLite = "sqlite"
+)
+
+// Default -store-path of the backends that need one
+const (
+	defaultFileStorePath   = "data"
+	defaultSQLiteStorePath = "prices.db"
+)
+
+// Write modes selectable with -write-mode
+const (
+	writeReplace      = "replace"
+	writeMerge        = "merge"
+	writeSkipIfExists = "skip-if-exists"
+)
+
+// envOr returns the value of the environment variable, or fallback if it is unset
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// storeOptions selects and configures the storage backend
+type storeOptions struct {
+	// backend is the -store backend, empty if results are not persisted
+	backend string
+	// path is the directory of the file backend or the database of the
+	// sqlite backend; empty selects the backend's default
+	path string
+	// writeMode is one of the -write-mode values, replace if empty
+	writeMode string
+	// pantryConfig is a file of named pantries, empty to read the pantry
+	// from the environment
+	pantryConfig string
+	// pantryName selects a pantry of pantryConfig, its default if empty
+	pantryName string
+}
+
+// openStore opens the selected storage backend. An empty backend returns a
+// nil store, meaning results are not persisted.
+//
+// Only the pantry backend can merge; skip-if-exists is left to the caller
+// and otherwise replaces.
+func openStore(opts storeOptions) (storage.Store, error) {
+	backend, path, writeMode := opts.backend, opts.path, opts.writeMode
+	switch writeMode {
+	case "", writeReplace, writeSkipIfExists:
+	case writeMerge:
+		if backend != backendPantry {
+			return nil, fmt.Errorf("-write-mode %s is only supported by the %s backend", writeMerge, backendPantry)
+		}
+	default:
+		return nil, fmt.Errorf("unknown write mode %q (available: %s, %s, %s)",
+			writeMode, writeReplace, writeMerge, writeSkipIfExists)
+	}
+
+	var (
+		store storage.Store
+		err   error
+	)
+	switch backend {
+	case "":
+		return nil, nil
+	case backendPantry:
+		cfg, cfgErr := pantry.LoadConfig(opts.pantryConfig, opts.pantryName)
+		if cfgErr != nil {
+			return nil, fmt.Errorf("error loading Pantry config: %w", cfgErr)
+		}
+		mode := pantry.WriteReplace
+		if writeMode == writeMerge {
+			mode = pantry.WriteMerge
+		}
+		store = pantry.NewBasketManager(cfg, pantry.WithWriteMode(mode), pantry.WithScraperVersion(version))
+	case backendFile:
+		if path == "" {
+			path = defaultFileStorePath
+		}
+		store, err = localfs.New(path)
+	case backendSQLite:
+		if path == "" {
+			path = defaultSQLiteStorePath
+		}
+		store, err = sqlite.Open(path)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (available: %s, %s, %s)",
+			backend, backendPantry, backendFile, backendSQLite)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStore{Store: store, backend: backend}, nil
+}
+
+// instrumentedStore records metrics for every operation of the wrapped store
+type instrumentedStore struct {
+	storage.Store
+	backend string
+}
+
+// record records the outcome of an operation started at startTime
+func (s *instrumentedStore) record(operation string, startTime time.Time, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	metrics.RecordStoreOperation(s.backend, operation, status, time.Since(startTime).Seconds())
+}
+
+func (s *instrumentedStore) SaveDay(ctx context.Context, day storage.DailyPrices) error {
+	startTime := time.Now()
+	err := s.Store.SaveDay(ctx, day)
+	s.record("save", startTime, err)
+	return err
+}
+
+func (s *instrumentedStore) LoadDay(ctx context.Context, date time.Time) (storage.DailyPrices, error) {
+	startTime := time.Now()
+	day, err := s.Store.LoadDay(ctx, date)
+	s.record("load", startTime, err)
+	return day, err
+}
+
+func (s *instrumentedStore) ListDays(ctx context.Context) ([]time.Time, error) {
+	startTime := time.Now()
+	days, err := s.Store.ListDays(ctx)
+	s.record("list", startTime, err)
+	return days, err
+}
+
+func (s *instrumentedStore) DeleteDay(ctx context.Context, date time.Time) error {
+	startTime := time.Now()
+	err := s.Store.DeleteDay(ctx, date)
+	s.record("delete", startTime, err)
+	return err
+}
+
+// loadStoredDay returns the day stored for the given date, and whether
+// there is one
+func loadStoredDay(ctx context.Context, store storage.Store, date time.Time) (storage.DailyPrices, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	day, err := store.LoadDay(ctx, date)
+	if errors.Is(err, storage.ErrNotFound) {
+		return storage.DailyPrices{}, false, nil
+	}
+	if err != nil {
+		return storage.DailyPrices{}, false, err
+	}
+	return day, true, nil
+}
@@ -0,0 +1,281 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/source/sourcetest"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/aliasthewho/price_tracker/internal/storage/localfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhook is a local HTTP stand-in for a webhook receiver
+type webhook struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	payloads []Payload
+	headers  []http.Header
+	status   int
+}
+
+func newWebhook(t *testing.T) *webhook {
+	t.Helper()
+	w := &webhook{status: http.StatusNoContent}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var payload Payload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.payloads = append(w.payloads, payload)
+		w.headers = append(w.headers, r.Header.Clone())
+		rw.WriteHeader(w.status)
+	}))
+	t.Cleanup(w.Close)
+	return w
+}
+
+// received returns the payloads posted so far
+func (w *webhook) received() []Payload {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Payload(nil), w.payloads...)
+}
+
+func (w *webhook) setStatus(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status = status
+}
+
+func day(date string, prices ...source.PriceRecord) storage.DailyPrices {
+	return storage.DailyPrices{Date: date, Prices: prices, Fetched: date + "T08:00:00-05:00"}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{
+		Webhooks: []Webhook{{Name: "buyers", URL: "ftp://example.com"}},
+		Rules: []Rule{
+			{Name: "a", Metric: "volume", Operator: ">", Threshold: 1},
+			{Name: "a", Metric: MetricPrice, Operator: "=>", Field: "median", Webhooks: []string{"ops"}},
+			{Metric: MetricChange, Operator: OpBelow, Window: -1},
+		},
+	}
+	err := cfg.Validate()
+	require.Error(t, err)
+	for _, want := range []string{
+		`webhook "buyers": url must be an http or https URL`,
+		`rule "a": unknown metric "volume"`,
+		`rule "a": duplicate name`,
+		`rule "a": unknown operator "=>"`,
+		`rule "a": unknown field "median"`,
+		`rule "a": unknown webhook "ops"`,
+		`rule #3: name is required`,
+		`rule "#3": window must not be negative`,
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+
+	assert.NoError(t, Config{}.Validate())
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"webhooks": [{"name": "buyers", "url": "http://localhost:9000/hook"}],
+		"rules": [{"name": "papa", "product": "papa", "metric": "percent_change", "operator": ">", "threshold": 15}]
+	}`), 0o600))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Len(t, cfg.Rules, 1)
+	assert.Equal(t, MetricPercentChange, cfg.Rules[0].Metric)
+	assert.True(t, cfg.NeedsHistory())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules": [{"name": "x", "treshold": 1}]}`), 0o600))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, `unknown field "treshold"`)
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+
+	base := day("2025-06-16",
+		sourcetest.Price("2025-06-16", "PAPA", "PAPA BLANCA", 0.80, 1.20, 1.00),
+		sourcetest.Price("2025-06-16", "LIMÓN", "LIMON SUTIL", 3.80, 4.20, 4.00),
+	)
+	today := day("2025-06-17",
+		sourcetest.Price("2025-06-17", "PAPA", "PAPA BLANCA", 1.00, 1.40, 1.20),
+		sourcetest.Price("2025-06-17", "PAPA", "PAPA AMARILLA", 2.80, 3.20, 3.00),
+		sourcetest.Price("2025-06-17", "LIMON", "LIMON SUTIL", 2.80, 3.20, 3.00),
+	)
+	today.Prices[1].Missing = []string{"max"}
+
+	rules := []Rule{
+		{Name: "papa-jump", Product: "papa", Variety: "papa blanca", Metric: MetricPercentChange, Operator: OpAbove, Threshold: 15},
+		{Name: "limon-drop", Product: "limon", Metric: MetricChange, Operator: OpBelowOrEqual, Threshold: -1},
+		{Name: "papa-expensive", Product: "papa", Field: source.FieldMax, Metric: MetricPrice, Operator: OpAboveOrEqual, Threshold: 1.4},
+	}
+	alerts := Evaluate(rules, today, map[int]storage.DailyPrices{1: base})
+	require.Len(t, alerts, 3)
+
+	assert.Equal(t, "papa-jump", alerts[0].Rule)
+	assert.Equal(t, 20.0, alerts[0].Value)
+	assert.Equal(t, 1.2, alerts[0].Price)
+	assert.Equal(t, "2025-06-16", alerts[0].BaseDate)
+	require.NotNil(t, alerts[0].BasePrice)
+	assert.Equal(t, 1.0, *alerts[0].BasePrice)
+
+	assert.Equal(t, "limon-drop", alerts[1].Rule)
+	assert.Equal(t, -1.0, alerts[1].Value)
+
+	// The missing max of PAPA AMARILLA does not fire
+	assert.Equal(t, "papa-expensive", alerts[2].Rule)
+	assert.Equal(t, "PAPA BLANCA", alerts[2].Variety)
+	assert.Equal(t, 1.4, alerts[2].Value)
+
+	// Change rules without a base day do not fire
+	assert.Len(t, Evaluate(rules, today, nil), 1)
+}
+
+func TestAlerterRun(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	store, err := localfs.New(t.TempDir())
+	require.NoError(t, err)
+	// Saturday's prices; Sunday has none, so Monday is compared with Saturday
+	require.NoError(t, store.SaveDay(ctx, day("2025-06-14", sourcetest.Price("2025-06-14", "PAPA", "PAPA BLANCA", 0.80, 1.20, 1.00))))
+
+	buyers, ops := newWebhook(t), newWebhook(t)
+	cfg := Config{
+		Webhooks: []Webhook{
+			{Name: "buyers", URL: buyers.URL, Headers: map[string]string{"Authorization": "Bearer secret"}},
+			{Name: "ops", URL: ops.URL},
+		},
+		Rules: []Rule{
+			{Name: "papa-jump", Product: "papa", Metric: MetricPercentChange, Operator: OpAbove, Threshold: 15},
+			{Name: "papa-level", Product: "papa", Metric: MetricPrice, Operator: OpAbove, Threshold: 1.1, Webhooks: []string{"buyers"}},
+		},
+	}
+	statePath := filepath.Join(t.TempDir(), "alerts-state.json")
+	alerter, err := New(cfg, statePath)
+	require.NoError(t, err)
+
+	monday := day("2025-06-16", sourcetest.Price("2025-06-16", "PAPA", "PAPA BLANCA", 1.00, 1.40, 1.20))
+	sent, err := alerter.Run(ctx, monday, store)
+	require.NoError(t, err)
+	require.Len(t, sent, 2)
+
+	require.Len(t, buyers.received(), 1)
+	assert.Equal(t, "2025-06-16", buyers.received()[0].Date)
+	assert.Len(t, buyers.received()[0].Alerts, 2)
+	assert.Equal(t, "Bearer secret", buyers.headers[0].Get("Authorization"))
+	require.Len(t, ops.received(), 1)
+	assert.Len(t, ops.received()[0].Alerts, 1, "papa-level only notifies buyers")
+
+	t.Run("Deduplicates", func(t *testing.T) {
+		sent, err := alerter.Run(ctx, monday, store)
+		require.NoError(t, err)
+		assert.Empty(t, sent)
+		assert.Len(t, buyers.received(), 1)
+		assert.Len(t, ops.received(), 1)
+	})
+
+	t.Run("Retries failed webhooks only", func(t *testing.T) {
+		require.NoError(t, store.SaveDay(ctx, monday))
+		ops.setStatus(http.StatusBadGateway)
+		tuesday := day("2025-06-17", sourcetest.Price("2025-06-17", "PAPA", "PAPA BLANCA", 1.30, 1.70, 1.50))
+
+		sent, err := alerter.Run(ctx, tuesday, store)
+		require.ErrorContains(t, err, "webhook ops: unexpected status 502")
+		require.Len(t, sent, 1, "the level alert is still active, only the jump is new")
+		assert.Len(t, buyers.received(), 2)
+
+		ops.setStatus(http.StatusOK)
+		sent, err = alerter.Run(ctx, tuesday, store)
+		require.NoError(t, err)
+		assert.Empty(t, sent, "buyers already received the alert")
+		assert.Len(t, buyers.received(), 2)
+		assert.Len(t, ops.received(), 3)
+	})
+
+	t.Run("Rearms level alerts", func(t *testing.T) {
+		wednesday := day("2025-06-18", sourcetest.Price("2025-06-18", "PAPA", "PAPA BLANCA", 0.80, 1.20, 1.00))
+		_, err := alerter.Run(ctx, wednesday, nil)
+		require.ErrorContains(t, err, "need a storage backend")
+
+		require.NoError(t, store.SaveDay(ctx, day("2025-06-17", sourcetest.Price("2025-06-17", "PAPA", "PAPA BLANCA", 1.30, 1.70, 1.50))))
+		sent, err := alerter.Run(ctx, wednesday, store)
+		require.NoError(t, err)
+		assert.Empty(t, sent)
+
+		thursday := day("2025-06-19", sourcetest.Price("2025-06-19", "PAPA", "PAPA BLANCA", 0.95, 1.35, 1.15))
+		require.NoError(t, store.SaveDay(ctx, wednesday))
+		sent, err = alerter.Run(ctx, thursday, store)
+		require.NoError(t, err)
+		require.Len(t, sent, 1)
+		assert.Equal(t, "papa-level", sent[0].Rule)
+	})
+
+	state, err := LoadState(statePath)
+	require.NoError(t, err)
+	assert.NotEmpty(t, state.Sent)
+}
+
+func TestAlerterPrune(t *testing.T) {
+	t.Parallel()
+
+	statePath := filepath.Join(t.TempDir(), "alerts-state.json")
+	require.NoError(t, SaveState(statePath, State{Sent: map[string]Sent{
+		"old|emmsa|papa|papa blanca|2025-04-01":  {Rule: "old", Day: "2025-04-01"},
+		"jump|emmsa|papa|papa blanca|2025-04-01": {Rule: "jump", Day: "2025-04-01"},
+		"jump|emmsa|papa|papa blanca|2025-06-10": {Rule: "jump", Day: "2025-06-10"},
+		"level|emmsa|papa|papa blanca":           {Rule: "level", Day: "2025-04-01"},
+	}}))
+
+	cfg := Config{
+		Webhooks: []Webhook{{Name: "buyers", URL: "http://127.0.0.1:1"}},
+		Rules: []Rule{
+			{Name: "jump", Metric: MetricPercentChange, Operator: OpAbove, Threshold: 50},
+			{Name: "level", Product: "papa", Metric: MetricPrice, Operator: OpAbove, Threshold: 100},
+		},
+	}
+	alerter, err := New(cfg, statePath, WithHTTPClient(&http.Client{Timeout: time.Second}))
+	require.NoError(t, err)
+	store, err := localfs.New(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = alerter.Run(context.Background(), day("2025-06-17"), store)
+	require.NoError(t, err)
+
+	state, err := LoadState(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"jump|emmsa|papa|papa blanca|2025-06-10", "level|emmsa|papa|papa blanca"}, sortedKeys(state.Sent))
+}
+
+func sortedKeys(m map[string]Sent) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,292 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/metrics"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// maxBaseGap is how many days before the rule window a base day may be, so
+// that a change is not measured against a stale day after a gap in history
+const maxBaseGap = 7
+
+// changeRetention is how many days sent change alerts are remembered, long
+// enough to cover re-runs and retries of recent days
+const changeRetention = 31
+
+// Sent records the delivery of an alert
+type Sent struct {
+	Rule string `json:"rule"`
+	// Day is the day the alert was raised for, in YYYY-MM-DD format
+	Day string `json:"day"`
+	// Webhooks are the names of the webhooks the alert was delivered to
+	Webhooks []string `json:"webhooks"`
+}
+
+// State remembers the alerts already sent, keyed by Alert.Key
+type State struct {
+	Sent map[string]Sent `json:"sent"`
+}
+
+// LoadState reads the state file. A missing file yields an empty state.
+func LoadState(path string) (State, error) {
+	state := State{Sent: make(map[string]Sent)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read alert state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to decode alert state: %w", err)
+	}
+	if state.Sent == nil {
+		state.Sent = make(map[string]Sent)
+	}
+	return state, nil
+}
+
+// SaveState writes the state file atomically
+func SaveState(path string, state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert state: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write alert state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write alert state: %w", err)
+	}
+	return nil
+}
+
+// Payload is the JSON body posted to webhooks
+type Payload struct {
+	// Date is the day the alerts were raised for, in YYYY-MM-DD format
+	Date   string  `json:"date"`
+	Alerts []Alert `json:"alerts"`
+}
+
+// Option configures an Alerter
+type Option func(*Alerter)
+
+// WithHTTPClient sets the client used to call webhooks
+func WithHTTPClient(client *http.Client) Option {
+	return func(a *Alerter) {
+		a.client = client
+	}
+}
+
+// Alerter evaluates the rules of a Config after every fetched day and
+// delivers the new alerts to the webhooks.
+//
+// The zero value is not usable, use New instead.
+type Alerter struct {
+	cfg       Config
+	statePath string
+	client    *http.Client
+}
+
+// New validates the configuration and returns an Alerter persisting what
+// was sent to statePath
+func New(cfg Config, statePath string, opts ...Option) (*Alerter, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid alert rules: %w", err)
+	}
+	if statePath == "" {
+		return nil, errors.New("alert state path not set")
+	}
+	a := &Alerter{
+		cfg:       cfg,
+		statePath: statePath,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a, nil
+}
+
+// Run evaluates the rules against the day and posts the alerts that were not
+// sent before, returning the alerts delivered to at least one webhook.
+//
+// Change rules load their base days from store. An alert is remembered per
+// webhook once the webhook accepted it with a 2xx status, so a failed
+// delivery is retried on the next run without notifying the other webhooks
+// again.
+func (a *Alerter) Run(ctx context.Context, day storage.DailyPrices, store storage.Store) ([]Alert, error) {
+	date, err := day.Day()
+	if err != nil {
+		return nil, err
+	}
+	state, err := LoadState(a.statePath)
+	if err != nil {
+		return nil, err
+	}
+
+	bases, err := a.baseDays(ctx, store, date)
+	if err != nil {
+		return nil, err
+	}
+	ev := evaluate(a.cfg.Rules, day, bases)
+	for _, key := range ev.cleared {
+		delete(state.Sent, key)
+	}
+
+	// Collect the alerts each webhook has not received yet
+	pending := make(map[string][]Alert, len(a.cfg.Webhooks))
+	for _, alert := range ev.firing {
+		sent := state.Sent[alert.Key()]
+		for _, hook := range a.targets(alert.Rule) {
+			if !slices.Contains(sent.Webhooks, hook) {
+				pending[hook] = append(pending[hook], alert)
+			}
+		}
+	}
+
+	var delivered []Alert
+	var errs []error
+	for _, hook := range a.cfg.Webhooks {
+		alerts := pending[hook.Name]
+		if len(alerts) == 0 {
+			continue
+		}
+		if err := a.post(ctx, hook, Payload{Date: day.Date, Alerts: alerts}); err != nil {
+			metrics.RecordAlertDelivery("error")
+			errs = append(errs, err)
+			continue
+		}
+		metrics.RecordAlertDelivery("success")
+
+		for _, alert := range alerts {
+			key := alert.Key()
+			sent, ok := state.Sent[key]
+			if !ok {
+				sent = Sent{Rule: alert.Rule, Day: alert.Date}
+				delivered = append(delivered, alert)
+				metrics.RecordAlertSent(alert.Rule)
+			}
+			sent.Webhooks = append(sent.Webhooks, hook.Name)
+			state.Sent[key] = sent
+		}
+	}
+
+	a.prune(state, date)
+	if err := SaveState(a.statePath, state); err != nil {
+		errs = append(errs, err)
+	}
+	return delivered, errors.Join(errs...)
+}
+
+// targets returns the names of the webhooks a rule notifies
+func (a *Alerter) targets(rule string) []string {
+	for _, r := range a.cfg.Rules {
+		if r.Name == rule && len(r.Webhooks) > 0 {
+			return r.Webhooks
+		}
+	}
+	names := make([]string, len(a.cfg.Webhooks))
+	for i, w := range a.cfg.Webhooks {
+		names[i] = w.Name
+	}
+	return names
+}
+
+// baseDays returns the base day of every change rule window: the latest
+// stored day at least window days before date, and no more than maxBaseGap
+// days older than that. Windows without such a day are left out.
+func (a *Alerter) baseDays(ctx context.Context, store storage.Store, date time.Time) (map[int]storage.DailyPrices, error) {
+	bases := make(map[int]storage.DailyPrices)
+	if !a.cfg.NeedsHistory() {
+		return bases, nil
+	}
+	if store == nil {
+		return nil, errors.New("change alert rules need a storage backend, set -store")
+	}
+
+	days, err := store.ListDays(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored days: %w", err)
+	}
+	for _, rule := range a.cfg.Rules {
+		window := rule.window()
+		if _, done := bases[window]; done || !rule.isChange() {
+			continue
+		}
+		target := date.AddDate(0, 0, -window)
+		oldest := target.AddDate(0, 0, -maxBaseGap)
+		for i := len(days) - 1; i >= 0; i-- {
+			if days[i].After(target) {
+				continue
+			}
+			if days[i].Before(oldest) {
+				break
+			}
+			base, err := store.LoadDay(ctx, days[i])
+			if err != nil {
+				return nil, fmt.Errorf("failed to load base day: %w", err)
+			}
+			bases[window] = base
+			break
+		}
+	}
+	return bases, nil
+}
+
+// prune forgets alerts of rules that no longer exist and change alerts older
+// than changeRetention days
+func (a *Alerter) prune(state State, date time.Time) {
+	rules := make(map[string]Rule, len(a.cfg.Rules))
+	for _, r := range a.cfg.Rules {
+		rules[r.Name] = r
+	}
+	cutoff := date.AddDate(0, 0, -changeRetention).Format(storage.DateLayout)
+	for key, sent := range state.Sent {
+		rule, ok := rules[sent.Rule]
+		if !ok || (rule.isChange() && sent.Day < cutoff) {
+			delete(state.Sent, key)
+		}
+	}
+}
+
+// post sends the payload to a webhook
+func (a *Alerter) post(ctx context.Context, hook Webhook, payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alerts: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", hook.Name, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "price-tracker")
+	for name, value := range hook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", hook.Name, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body) // drain for connection reuse
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s: unexpected status %d", hook.Name, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package alert
+
+import (
+	"strings"
+
+	"github.com/aliasthewho/price_tracker/internal/diff"
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// Alert is a rule that fired for a price
+type Alert struct {
+	Rule      string   `json:"rule"`
+	Date      string   `json:"date"`
+	Source    string   `json:"source"`
+	Product   string   `json:"product"`
+	Variety   string   `json:"variety"`
+	Field     string   `json:"field"`
+	Metric    Metric   `json:"metric"`
+	Operator  Operator `json:"operator"`
+	Threshold float64  `json:"threshold"`
+	// Value is the metric value that crossed the threshold
+	Value float64 `json:"value"`
+	// Price is the watched price on Date
+	Price float64 `json:"price"`
+	// BaseDate and BasePrice are the day and price a change was measured
+	// against, unset for price alerts
+	BaseDate  string   `json:"base_date,omitempty"`
+	BasePrice *float64 `json:"base_price,omitempty"`
+}
+
+// Key identifies the alert in the dedup state. Price alerts are keyed by
+// rule and variety, so they are sent once when the price crosses the
+// threshold and again only after it crossed back. Change alerts also include
+// the day, so they are sent at most once per day.
+func (a Alert) Key() string {
+	key := strings.Join([]string{a.Rule, a.Source, source.FoldName(a.Product), source.FoldName(a.Variety)}, "|")
+	if a.Metric != MetricPrice {
+		key += "|" + a.Date
+	}
+	return key
+}
+
+// evaluation is the outcome of checking the rules against a day
+type evaluation struct {
+	// firing are the alerts raised, once per key
+	firing []Alert
+	// cleared are the keys of price alerts whose price is quoted but does
+	// not cross the threshold
+	cleared []string
+}
+
+// Evaluate returns the alerts the rules raise for the day. Change rules are
+// measured against bases, the base day of every rule window; rules whose
+// window has no base day do not fire.
+func Evaluate(rules []Rule, day storage.DailyPrices, bases map[int]storage.DailyPrices) []Alert {
+	return evaluate(rules, day, bases).firing
+}
+
+func evaluate(rules []Rule, day storage.DailyPrices, bases map[int]storage.DailyPrices) evaluation {
+	var ev evaluation
+	seen := make(map[string]bool)
+	fire := func(a Alert) {
+		if key := a.Key(); !seen[key] {
+			seen[key] = true
+			ev.firing = append(ev.firing, a)
+		}
+	}
+
+	for _, rule := range rules {
+		filter := rule.filter()
+		prices := filter.Apply(day.Prices)
+
+		if !rule.isChange() {
+			for _, p := range prices {
+				if p.IsMissing(rule.field()) {
+					continue
+				}
+				a := newAlert(rule, day.Date, p.Source, p.Product, p.Variety)
+				a.Price = p.Price(rule.field())
+				a.Value = a.Price
+				if rule.Operator.compare(a.Value, rule.Threshold) {
+					fire(a)
+				} else {
+					ev.cleared = append(ev.cleared, a.Key())
+				}
+			}
+			continue
+		}
+
+		base, ok := bases[rule.window()]
+		if !ok {
+			continue
+		}
+		for _, c := range diff.Compare(filter.Apply(base.Prices), prices).Changes {
+			d := deltaField(c, rule.field())
+			if d == nil {
+				continue
+			}
+			value := d.Change
+			if rule.Metric == MetricPercentChange {
+				if d.Percent == nil {
+					continue
+				}
+				value = *d.Percent
+			}
+			if !rule.Operator.compare(value, rule.Threshold) {
+				continue
+			}
+			a := newAlert(rule, day.Date, c.Source, c.Product, c.Variety)
+			basePrice := d.From
+			a.Value, a.Price = value, d.To
+			a.BaseDate, a.BasePrice = base.Date, &basePrice
+			fire(a)
+		}
+	}
+	return ev
+}
+
+func newAlert(rule Rule, date, source, product, variety string) Alert {
+	return Alert{
+		Rule:      rule.Name,
+		Date:      date,
+		Source:    source,
+		Product:   product,
+		Variety:   variety,
+		Field:     rule.field(),
+		Metric:    rule.Metric,
+		Operator:  rule.Operator,
+		Threshold: rule.Threshold,
+	}
+}
+
+// deltaField returns the min, max or avg delta of a change
+func deltaField(c diff.Change, field string) *diff.Delta {
+	switch field {
+	case source.FieldMin:
+		return c.Min
+	case source.FieldMax:
+		return c.Max
+	}
+	return c.Avg
+}
@@ -0,0 +1,227 @@
+// Package alert evaluates price alert rules against a fetched day and posts
+// the alerts that fire to JSON webhooks, remembering what was already sent
+// so that repeated runs do not notify twice.
+//
+// Example rules file:
+//
+//	{
+//	  "webhooks": [{"name": "buyers", "url": "https://example.com/hooks/prices"}],
+//	  "rules": [
+//	    {"name": "papa-jump", "product": "papa", "variety": "papa blanca",
+//	     "metric": "percent_change", "operator": ">", "threshold": 15},
+//	    {"name": "limon-expensive", "product": "limon",
+//	     "metric": "price", "field": "max", "operator": ">=", "threshold": 6}
+//	  ]
+//	}
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+)
+
+// Metric is the value a rule compares against its threshold
+type Metric string
+
+const (
+	// MetricPrice is the price on the day, for alerts on absolute levels
+	MetricPrice Metric = "price"
+	// MetricChange is the price change over the rule window, in currency units
+	MetricChange Metric = "change"
+	// MetricPercentChange is the price change over the rule window, in percent
+	MetricPercentChange Metric = "percent_change"
+)
+
+// Operator compares a metric to the rule threshold
+type Operator string
+
+// Supported operators, written as in the rules file
+const (
+	OpAbove        Operator = ">"
+	OpAboveOrEqual Operator = ">="
+	OpBelow        Operator = "<"
+	OpBelowOrEqual Operator = "<="
+)
+
+// compare reports whether value op threshold holds
+func (op Operator) compare(value, threshold float64) bool {
+	switch op {
+	case OpAbove:
+		return value > threshold
+	case OpAboveOrEqual:
+		return value >= threshold
+	case OpBelow:
+		return value < threshold
+	case OpBelowOrEqual:
+		return value <= threshold
+	}
+	return false
+}
+
+// DefaultWindow is the number of days a change is measured over when a rule
+// does not set one (day over day)
+const DefaultWindow = 1
+
+// Rule raises an alert when the metric of a matching price crosses the threshold
+type Rule struct {
+	// Name identifies the rule in alerts and in the dedup state; required
+	// and unique
+	Name string `json:"name"`
+	// Product and Variety select the prices the rule applies to, case and
+	// accent insensitive. Empty matches every product or variety.
+	Product string `json:"product,omitempty"`
+	Variety string `json:"variety,omitempty"`
+	// Field is the price watched: min, max or avg (default avg)
+	Field string `json:"field,omitempty"`
+	// Metric is the value compared: price, change or percent_change
+	Metric Metric `json:"metric"`
+	// Operator is one of >, >=, < and <=
+	Operator  Operator `json:"operator"`
+	Threshold float64  `json:"threshold"`
+	// Window is the number of days a change is measured over (default 1).
+	// The change is measured against the latest stored day at least Window
+	// days before, so a Monday is compared with the Saturday.
+	Window int `json:"window,omitempty"`
+	// Webhooks lists the names of the webhooks notified, all of them if empty
+	Webhooks []string `json:"webhooks,omitempty"`
+}
+
+// field returns the watched price field, defaulting to avg
+func (r Rule) field() string {
+	if r.Field == "" {
+		return source.FieldAvg
+	}
+	return r.Field
+}
+
+// window returns the change window, defaulting to DefaultWindow
+func (r Rule) window() int {
+	if r.Window < 1 {
+		return DefaultWindow
+	}
+	return r.Window
+}
+
+// isChange reports whether the rule compares two days
+func (r Rule) isChange() bool {
+	return r.Metric == MetricChange || r.Metric == MetricPercentChange
+}
+
+// filter returns the product and variety filter of the rule
+func (r Rule) filter() source.Filter {
+	var f source.Filter
+	if r.Product != "" {
+		f.Products = []string{r.Product}
+	}
+	if r.Variety != "" {
+		f.Varieties = []string{r.Variety}
+	}
+	return f
+}
+
+// Webhook is an HTTP endpoint alerts are posted to as JSON
+type Webhook struct {
+	// Name is referenced by Rule.Webhooks; required and unique
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Headers are added to every request, e.g. an Authorization header
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Config is the content of an alert rules file
+type Config struct {
+	Webhooks []Webhook `json:"webhooks"`
+	Rules    []Rule    `json:"rules"`
+}
+
+// LoadConfig reads and validates a JSON rules file
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read alert rules: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("failed to decode alert rules: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, fmt.Errorf("invalid alert rules: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the rules and webhooks, returning every problem found
+func (c Config) Validate() error {
+	var errs []error
+	webhooks := make(map[string]bool, len(c.Webhooks))
+	for i, w := range c.Webhooks {
+		switch {
+		case w.Name == "":
+			errs = append(errs, fmt.Errorf("webhook %d: name is required", i+1))
+		case webhooks[w.Name]:
+			errs = append(errs, fmt.Errorf("webhook %q: duplicate name", w.Name))
+		}
+		webhooks[w.Name] = true
+		if !strings.HasPrefix(w.URL, "http://") && !strings.HasPrefix(w.URL, "https://") {
+			errs = append(errs, fmt.Errorf("webhook %q: url must be an http or https URL", w.Name))
+		}
+	}
+	if len(c.Rules) > 0 && len(c.Webhooks) == 0 {
+		errs = append(errs, errors.New("no webhook configured"))
+	}
+
+	rules := make(map[string]bool, len(c.Rules))
+	for i, r := range c.Rules {
+		name := r.Name
+		switch {
+		case name == "":
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Errorf("rule %s: name is required", name))
+		case rules[name]:
+			errs = append(errs, fmt.Errorf("rule %q: duplicate name", name))
+		}
+		rules[name] = true
+
+		switch r.Metric {
+		case MetricPrice, MetricChange, MetricPercentChange:
+		default:
+			errs = append(errs, fmt.Errorf("rule %q: unknown metric %q (available: price, change, percent_change)", name, r.Metric))
+		}
+		switch r.Operator {
+		case OpAbove, OpAboveOrEqual, OpBelow, OpBelowOrEqual:
+		default:
+			errs = append(errs, fmt.Errorf("rule %q: unknown operator %q (available: >, >=, <, <=)", name, r.Operator))
+		}
+		if !source.IsPriceField(r.field()) {
+			errs = append(errs, fmt.Errorf("rule %q: unknown field %q (available: min, max, avg)", name, r.Field))
+		}
+		if r.Window < 0 {
+			errs = append(errs, fmt.Errorf("rule %q: window must not be negative", name))
+		}
+		for _, w := range r.Webhooks {
+			if !webhooks[w] {
+				errs = append(errs, fmt.Errorf("rule %q: unknown webhook %q", name, w))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NeedsHistory reports whether a rule compares against previous days, which
+// requires a storage backend
+func (c Config) NeedsHistory() bool {
+	for _, r := range c.Rules {
+		if r.isChange() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package scraper
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/metrics"
+)
+
+// ErrCircuitOpen is returned when the circuit breaker refuses to send a
+// request because EMMSA failed too many times in a row
+var ErrCircuitOpen = errors.New("circuit breaker open: EMMSA is failing, not sending requests")
+
+// BreakerState is the state of a CircuitBreaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets every request through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects every request until the cooldown has passed
+	BreakerOpen
+	// BreakerHalfOpen lets requests through to probe whether EMMSA recovered
+	BreakerHalfOpen
+)
+
+// String returns the name of the state
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreaker stops sending requests to EMMSA after a number of
+// consecutive transient failures, and lets requests through again once a
+// cooldown has passed. It is safe for concurrent use.
+//
+// The zero value is not usable, use NewCircuitBreaker instead.
+type CircuitBreaker struct {
+	mu sync.Mutex
+	// threshold is the number of consecutive failures that opens the breaker
+	threshold int
+	// cooldown is how long the breaker stays open before probing again
+	cooldown time.Duration
+	// failures is the current number of consecutive failures
+	failures int
+	// state is the current state
+	state BreakerState
+	// openedAt is when the breaker last opened
+	openedAt time.Time
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+// NewCircuitBreaker creates a breaker that opens after threshold consecutive
+// failures and probes again after cooldown. A threshold below 1 disables it.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// State returns the current state of the breaker
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow returns ErrCircuitOpen if requests are currently rejected
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen {
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(BreakerHalfOpen)
+	}
+	return nil
+}
+
+// Success records a request that reached EMMSA and closes the breaker
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.setState(BreakerClosed)
+}
+
+// Failure records a transient failure, opening the breaker once the
+// threshold is reached or if the half-open probe failed
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.threshold < 1 {
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(BreakerOpen)
+	}
+}
+
+// setState changes the state and publishes it as a metric. Callers hold b.mu.
+func (b *CircuitBreaker) setState(state BreakerState) {
+	b.state = state
+	metrics.SetCircuitBreakerState(int(state))
+}
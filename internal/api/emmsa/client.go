@@ -1,7 +1,7 @@
 package scraper
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -11,11 +11,22 @@ import (
 	"strings"
 	"time"
 
-	"github.com/PuerkitoBio/goquery"
+	"github.com/aliasthewho/price_tracker/internal/metrics"
+	"github.com/aliasthewho/price_tracker/internal/retry"
+	"github.com/aliasthewho/price_tracker/internal/source"
 )
 
 const (
-	emmsaAPIURL = "https://old.emmsa.com.pe/emmsa_spv/app/reportes/ajax/rpt07_gettable_new_web.php"
+	// defaultBaseURL is the scheme and host of the EMMSA site
+	defaultBaseURL = "https://old.emmsa.com.pe"
+	// reportPath is the endpoint returning the report tables
+	reportPath = "/emmsa_spv/app/reportes/ajax/rpt07_gettable_new_web.php"
+	// refererPath is the page the report endpoint is normally called from
+	refererPath = "/emmsa_spv/rpEstadistica/rpt_precios-diarios-web.php"
+	// defaultUserAgent mimics the browser the request headers were copied from
+	defaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.5 Safari/605.1.15"
+	// defaultTimeout is the timeout of a single request attempt
+	defaultTimeout = 30 * time.Second
 )
 
 // EMMSAPrice represents the price data from EMMSA
@@ -26,98 +37,323 @@ type EMMSAPrice struct {
 	PrecioMin  float64 `json:"precio_min"`
 	PrecioMax  float64 `json:"precio_max"`
 	PrecioProm float64 `json:"precio_prom"`
+	// Missing lists the JSON names of the prices EMMSA did not quote ("-" or
+	// blank cells), which are left at zero
+	Missing []string `json:"missing,omitempty"`
 }
 
+// Default circuit breaker settings used by NewEMMSAScraper
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = time.Minute
+)
+
 // EMMSAScraper handles fetching price data from the EMMSA API
 type EMMSAScraper struct {
 	httpClient *http.Client
+	// baseURL is the scheme and host of the EMMSA site
+	baseURL string
+	// userAgent is sent as the User-Agent header
+	userAgent string
+	// logger receives progress and retry messages
+	logger *log.Logger
+	// retry controls how transient failures are retried
+	retry RetryPolicy
+	// breaker stops requests after repeated transient failures
+	breaker *CircuitBreaker
+	// filter selects the products and varieties returned by default
+	filter source.Filter
+}
+
+// ScrapeOptions holds per-call options of ScrapePricesContext. A nil
+// *ScrapeOptions uses the scraper defaults.
+type ScrapeOptions struct {
+	// Timeout bounds the whole call, including retries. Zero means no
+	// limit other than the context deadline.
+	Timeout time.Duration
+	// MaxAttempts overrides the number of attempts of the retry policy
+	// when greater than zero
+	MaxAttempts int
+	// Filter selects the products and varieties to return. The zero Filter
+	// uses the filter the scraper was created with.
+	Filter source.Filter
+	// Stats, if set, receives the parse stats of the response, including
+	// the rows that were skipped and why
+	Stats *ParseStats
 }
 
-// NewEMMSAScraper creates a new EMMSA scraper
-func NewEMMSAScraper() (*EMMSAScraper, error) {
+// NewEMMSAScraper creates a new EMMSA scraper.
+//
+// Without options it talks to the live EMMSA site with a 30-second timeout
+// per attempt, DefaultRetryPolicy and a circuit breaker that opens after five
+// consecutive transient failures.
+//
+// Example:
+//
+//	s, err := NewEMMSAScraper(
+//	    WithBaseURL(server.URL),
+//	    WithTimeout(5*time.Second),
+//	)
+func NewEMMSAScraper(opts ...Option) (*EMMSAScraper, error) {
+	cfg := config{
+		baseURL:   defaultBaseURL,
+		userAgent: defaultUserAgent,
+		logger:    log.Default(),
+		retry:     DefaultRetryPolicy(),
+		breaker:   NewCircuitBreaker(defaultBreakerThreshold, defaultBreakerCooldown),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	u, err := url.Parse(cfg.baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q", cfg.baseURL)
+	}
+
+	httpClient := cfg.httpClient
+	switch {
+	case httpClient == nil:
+		timeout := cfg.timeout
+		if timeout == 0 {
+			timeout = defaultTimeout
+		}
+		httpClient = &http.Client{Timeout: timeout}
+	case cfg.timeout != 0:
+		client := *httpClient
+		client.Timeout = cfg.timeout
+		httpClient = &client
+	}
+
+	if cfg.breaker == nil {
+		cfg.breaker = NewCircuitBreaker(0, 0)
+	}
+	if cfg.logger == nil {
+		cfg.logger = log.New(io.Discard, "", 0)
+	}
+
 	return &EMMSAScraper{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(cfg.baseURL, "/"),
+		userAgent:  cfg.userAgent,
+		logger:     cfg.logger,
+		retry:      cfg.retry,
+		breaker:    cfg.breaker,
+		filter:     cfg.filter,
 	}, nil
 }
 
-// parsePriceTable parses the HTML table from the API response
-func parsePriceTable(html []byte, date time.Time) ([]EMMSAPrice, error) {
-	log.Printf("Parsing price table for date: %s", date.Format("2006-01-02"))
-	log.Printf("Response length: %d bytes", len(html))
+// priceColumns are the columns required in the daily prices table
+var priceColumns = []column{colProduct, colVariety, colMin, colMax, colAvg}
 
-	// Parse the HTML document
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+// parsePriceTable parses the HTML table from the API response. Columns are
+// located by their header, and a *SchemaError is returned if any of them is
+// missing. Prices are parsed with parseNumber; rows with a price that is not
+// a number are skipped and their FieldErrors recorded in the stats.
+func parsePriceTable(logger *log.Logger, html []byte, date time.Time) ([]EMMSAPrice, ParseStats, error) {
+	var stats ParseStats
+	rows, err := tableRows(html, ReportDailyPrices, priceColumns, &stats)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+		return nil, stats, err
 	}
 
 	var prices []EMMSAPrice
-
-	// Find all table rows
-	doc.Find("table tr").Each(func(i int, s *goquery.Selection) {
-		// Skip header row
-		if i == 0 {
-			return
+	for _, row := range rows {
+		price := EMMSAPrice{
+			Date:     date.Format("2006-01-02"),
+			Product:  row.value(colProduct),
+			Variedad: row.value(colVariety),
 		}
+		missing, errs := parseNumbers(row, []numberField{
+			{"precio_min", colMin, &price.PrecioMin},
+			{"precio_max", colMax, &price.PrecioMax},
+			{"precio_prom", colAvg, &price.PrecioProm},
+		})
 
-		// Extract data from each cell
-		cells := s.Find("td")
-		if cells.Length() < 5 { // Ensure we have enough cells
-			return
+		// Skip rows with invalid price data
+		if len(errs) > 0 {
+			stats.skipInvalid(row, errs)
+			continue
 		}
+		price.Missing = missing
 
-		// Extract text from each cell
-		product := strings.TrimSpace(cells.Eq(0).Text())
-		variedad := strings.TrimSpace(cells.Eq(1).Text())
-		precioMinStr := strings.TrimSpace(cells.Eq(2).Text())
-		precioMaxStr := strings.TrimSpace(cells.Eq(3).Text())
-		precioPromStr := strings.TrimSpace(cells.Eq(4).Text())
+		prices = append(prices, price)
+	}
+	stats.Parsed = len(prices)
 
-		// Convert price strings to float64 (handle potential errors)
-		precioMin, err1 := strconv.ParseFloat(precioMinStr, 64)
-		precioMax, err2 := strconv.ParseFloat(precioMaxStr, 64)
-		precioProm, err3 := strconv.ParseFloat(precioPromStr, 64)
+	logger.Printf("Parsed price table for date %s: %s", date.Format("2006-01-02"), stats)
+	return prices, stats, nil
+}
 
-		// Skip rows with invalid price data
-		if err1 != nil || err2 != nil || err3 != nil {
-			log.Printf("Skipping row with invalid price data: %s, %s, %s",
-				precioMinStr, precioMaxStr, precioPromStr)
-			return
-		}
+// ScrapePrices fetches the daily prices from EMMSA API.
+//
+// It is equivalent to ScrapePricesContext with a background context and
+// default options.
+func (s *EMMSAScraper) ScrapePrices(date time.Time) ([]EMMSAPrice, error) {
+	return s.ScrapePricesContext(context.Background(), date, nil)
+}
 
-		price := EMMSAPrice{
-			Date:       date.Format("2006-01-02"),
-			Product:    product,
-			Variedad:   variedad,
-			PrecioMin:  precioMin,
-			PrecioMax:  precioMax,
-			PrecioProm: precioProm,
+// ScrapePricesContext fetches the daily prices from EMMSA API.
+//
+// Transient failures are retried according to the scraper's RetryPolicy, and
+// ErrCircuitOpen is returned without sending a request while the circuit
+// breaker is open. Cancelling ctx aborts the in-flight request as well as
+// any wait between retries.
+func (s *EMMSAScraper) ScrapePricesContext(ctx context.Context, date time.Time, opts *ScrapeOptions) ([]EMMSAPrice, error) {
+	return scrapeReport(ctx, s, ReportDailyPrices, date, opts, parsePriceTable, func(p EMMSAPrice) (string, string) {
+		return p.Product, p.Variedad
+	})
+}
+
+// scrapeReport fetches and parses a report, keeping the rows that pass the
+// filter. names returns the product and variety of a row.
+//
+// A filter the report form can express is sent upstream as vprod/vvari, but
+// EMMSA only matches its own spelling: "LIMON" returns no rows when the site
+// lists "LIMÓN". A filtered request without rows is therefore sent again
+// unfiltered, and the filter is always applied to the parsed rows.
+func scrapeReport[T any](ctx context.Context, s *EMMSAScraper, report ReportType, date time.Time, opts *ScrapeOptions,
+	parse func(*log.Logger, []byte, time.Time) ([]T, ParseStats, error), names func(T) (string, string)) ([]T, error) {
+	if opts == nil {
+		opts = &ScrapeOptions{}
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	filter := opts.Filter
+	if filter.IsZero() {
+		filter = s.filter
+	}
+
+	vprod, vvari := upstreamFilter(filter)
+	body, err := s.fetchReport(ctx, report, date, vprod, vvari, opts.MaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	rows, stats, err := parse(s.logger, body, date)
+	if err == nil && len(rows) == 0 && (vprod != "" || vvari != "") {
+		s.logger.Printf("No %s matched vprod %q and vvari %q, fetching the full table", report, vprod, vvari)
+		if body, err = s.fetchReport(ctx, report, date, "", "", opts.MaxAttempts); err != nil {
+			return nil, err
 		}
+		rows, stats, err = parse(s.logger, body, date)
+	}
+	s.recordStats(report, stats, opts)
+	if err != nil || filter.IsZero() {
+		return rows, err
+	}
 
-		prices = append(prices, price)
-	})
+	kept := rows[:0]
+	for _, row := range rows {
+		if filter.Match(names(row)) {
+			kept = append(kept, row)
+		}
+	}
+	return kept, nil
+}
 
-	return prices, nil
+// recordStats publishes the parse stats as metrics and to opts.Stats
+func (s *EMMSAScraper) recordStats(report ReportType, stats ParseStats, opts *ScrapeOptions) {
+	skipped := make(map[string]int)
+	for reason, n := range stats.SkippedByReason() {
+		skipped[string(reason)] = n
+	}
+	metrics.RecordParsedRows(report.String(), stats.Parsed, skipped)
+	if opts != nil && opts.Stats != nil {
+		*opts.Stats = stats
+	}
 }
 
-// ScrapePrices fetches the daily prices from EMMSA API
-func (s *EMMSAScraper) ScrapePrices(date time.Time) ([]EMMSAPrice, error) {
+// fetchReport requests the HTML table of a report for the given day, with
+// the given vprod and vvari form values
+func (s *EMMSAScraper) fetchReport(ctx context.Context, report ReportType, date time.Time, vprod, vvari string, maxAttempts int) ([]byte, error) {
 	// Format the date as dd/mm/yyyy for the API
 	formattedDate := date.Format("02/01/2006")
-	log.Printf("Fetching prices for date: %s", formattedDate)
+	s.logger.Printf("Fetching %s for date: %s", report, formattedDate)
 
 	// Prepare form data
 	formData := url.Values{
-		"vid_tipo": {"1"}, // 1 = Precios Diarios
-		"vprod":    {""},  // Empty for all products
-		"vvari":    {""},  // Empty for all varieties
+		"vid_tipo": {strconv.Itoa(int(report))},
+		"vprod":    {vprod}, // Empty for all products
+		"vvari":    {vvari}, // Empty for all varieties
 		"vfecha":   {formattedDate},
 	}
+	return s.postWithRetry(ctx, formData, maxAttempts)
+}
+
+// upstreamFilter returns the vprod and vvari form values for the filter.
+// The report form takes a single product and variety, so filters with
+// several names are left empty and only applied client-side.
+func upstreamFilter(filter source.Filter) (vprod, vvari string) {
+	if len(filter.Products) != 1 || len(filter.Varieties) > 1 {
+		return "", ""
+	}
+	vprod = strings.ToUpper(strings.TrimSpace(filter.Products[0]))
+	if len(filter.Varieties) == 1 {
+		vvari = strings.ToUpper(strings.TrimSpace(filter.Varieties[0]))
+	}
+	return vprod, vvari
+}
+
+// postWithRetry sends the form, retrying transient failures with jittered
+// exponential backoff while the circuit breaker allows it. A maxAttempts of
+// zero uses the retry policy.
+func (s *EMMSAScraper) postWithRetry(ctx context.Context, formData url.Values, maxAttempts int) ([]byte, error) {
+	if maxAttempts <= 0 {
+		maxAttempts = s.retry.Attempts()
+	}
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		if err := s.breaker.Allow(); err != nil {
+			if lastErr != nil {
+				return nil, fmt.Errorf("%w (last error: %v)", err, lastErr)
+			}
+			return nil, err
+		}
+
+		body, err := s.post(ctx, formData)
+		if err == nil {
+			s.breaker.Success()
+			metrics.RecordPriceAttempt("success")
+			return body, nil
+		}
+
+		if ctx.Err() != nil {
+			// The caller gave up, which says nothing about EMMSA
+			metrics.RecordPriceAttempt("error")
+			return nil, err
+		}
+		if !isRetryable(err) {
+			// EMMSA answered, so the site itself is up
+			s.breaker.Success()
+			metrics.RecordPriceAttempt("error")
+			return nil, err
+		}
+		s.breaker.Failure()
+		metrics.RecordPriceAttempt("retryable_error")
+		lastErr = err
+
+		if attempt >= maxAttempts {
+			return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := s.retry.Backoff(attempt)
+		s.logger.Printf("EMMSA request failed (attempt %d/%d), retrying in %s: %v",
+			attempt, maxAttempts, delay.Round(time.Millisecond), err)
+		metrics.RecordPriceRetry()
+		if err := retry.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
 
+// post sends a single request to the EMMSA API and returns the response body
+func (s *EMMSAScraper) post(ctx context.Context, formData url.Values) ([]byte, error) {
 	// Create a new request
-	req, err := http.NewRequest("POST", emmsaAPIURL, strings.NewReader(formData.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+reportPath, strings.NewReader(formData.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
@@ -126,30 +362,29 @@ func (s *EMMSAScraper) ScrapePrices(date time.Time) ([]EMMSAPrice, error) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
 	req.Header.Set("Accept", "text/html, */*; q=0.01")
 	req.Header.Set("Accept-Language", "en-GB,en-US;q=0.9,en;q=0.8")
-	req.Header.Set("Origin", "https://old.emmsa.com.pe")
-	req.Header.Set("Referer", "https://old.emmsa.com.pe/emmsa_spv/rpEstadistica/rpt_precios-diarios-web.php")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.5 Safari/605.1.15")
+	req.Header.Set("Origin", s.baseURL)
+	req.Header.Set("Referer", s.baseURL+refererPath)
+	req.Header.Set("User-Agent", s.userAgent)
 
 	// Send the request
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error sending request: %w", err)
+		return nil, &retry.TransportError{Err: fmt.Errorf("error sending request: %w", err)}
 	}
 	defer resp.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response: %w", err)
+		return nil, &retry.TransportError{Err: fmt.Errorf("error reading response: %w", err)}
 	}
 
 	// Check if the response is successful
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
-	// Parse the HTML response
-	return parsePriceTable(body, date)
+	return body, nil
 }
 
 // Close releases any resources used by the scraper
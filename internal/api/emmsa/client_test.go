@@ -1,65 +1,268 @@
 package scraper
 
 import (
-	"encoding/json"
-	"os"
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/api/emmsa/emmsatest"
+	"github.com/aliasthewho/price_tracker/internal/source"
 )
 
-func TestEMMSAScraper(t *testing.T) {
-	// Create a new scraper
-	s, err := NewEMMSAScraper()
+// live enables the tests that hit the real EMMSA site
+var live = flag.Bool("live", false, "run tests against the live EMMSA site")
+
+func TestFakeServerMatchesScraper(t *testing.T) {
+	if reportPath != emmsatest.ReportPath {
+		t.Errorf("emmsatest.ReportPath = %q, want %q", emmsatest.ReportPath, reportPath)
+	}
+	if emmsatest.ReportDailyPrices != int(ReportDailyPrices) || emmsatest.ReportDailyVolumes != int(ReportDailyVolumes) {
+		t.Error("emmsatest report types do not match ReportType")
+	}
+}
+
+func TestScrapePricesFakeServer(t *testing.T) {
+	srv := emmsatest.NewServer()
+	defer srv.Close()
+	if err := srv.SetDayFile(fixtureDate, filepath.Join("testdata", "normal_day.html")); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewEMMSAScraper(
+		WithBaseURL(srv.URL),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+	)
 	if err != nil {
 		t.Fatalf("Failed to create scraper: %v", err)
 	}
 	defer s.Close()
 
-	// Test with a recent date
-	t.Run("ScrapeRecentPrices", func(t *testing.T) {
-		t.Log("Testing price scraping for a recent date")
+	t.Run("NormalDay", func(t *testing.T) {
+		prices, err := s.ScrapePrices(fixtureDate)
+		if err != nil {
+			t.Fatalf("Failed to scrape prices: %v", err)
+		}
+		if len(prices) != 142 {
+			t.Fatalf("Got %d prices, want 142", len(prices))
+		}
+		for _, p := range prices {
+			if p.Date != "2025-06-17" || p.Product == "" {
+				t.Fatalf("Unexpected price: %+v", p)
+			}
+		}
+	})
 
-		// Use a date from the last 7 days
-		date := time.Now().AddDate(0, 0, -1)
-		prices, err := s.ScrapePrices(date)
+	t.Run("Stats", func(t *testing.T) {
+		var stats ParseStats
+		prices, err := s.ScrapePricesContext(context.Background(), fixtureDate, &ScrapeOptions{Stats: &stats})
+		if err != nil {
+			t.Fatalf("Failed to scrape prices: %v", err)
+		}
+		if stats.Parsed != len(prices) || len(stats.Skipped) != 0 {
+			t.Errorf("Unexpected stats: %s", stats)
+		}
+	})
 
-		// Check for errors
+	t.Run("EmptyDay", func(t *testing.T) {
+		prices, err := s.ScrapePrices(fixtureDate.AddDate(0, 0, 1))
 		if err != nil {
 			t.Fatalf("Failed to scrape prices: %v", err)
 		}
+		if len(prices) != 0 {
+			t.Errorf("Got %d prices for a day without data", len(prices))
+		}
+	})
 
-		// Basic validation of the results
+	t.Run("RecoversFromOutage", func(t *testing.T) {
+		srv.FailNext(2, http.StatusServiceUnavailable)
+		before := len(srv.Requests())
+		prices, err := s.ScrapePrices(fixtureDate)
+		if err != nil {
+			t.Fatalf("Failed to scrape prices: %v", err)
+		}
 		if len(prices) == 0 {
-			t.Error("No prices returned from the API")
-			return
+			t.Error("No prices returned after the server recovered")
+		}
+		if got := len(srv.Requests()) - before; got != 3 {
+			t.Errorf("Sent %d requests, want 3", got)
 		}
+	})
 
-		t.Logf("Successfully retrieved %d price entries\n", len(prices))
+	t.Run("GivesUp", func(t *testing.T) {
+		srv.FailNext(3, http.StatusBadGateway)
+		_, err := s.ScrapePrices(fixtureDate)
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+			t.Fatalf("Expected a 502 StatusError, got %v", err)
+		}
+	})
 
-		// Convert to pretty-printed JSON
-		jsonData, err := json.MarshalIndent(prices, "", "  ")
-		if err != nil {
-			t.Fatalf("Failed to marshal prices to JSON: %v", err)
+	requests := srv.Requests()
+	if got := requests[0].Date; got != "17/06/2025" {
+		t.Errorf("Sent vfecha %q, want 17/06/2025", got)
+	}
+	if got := requests[0].Form.Get("vid_tipo"); got != "1" {
+		t.Errorf("Sent vid_tipo %q, want 1", got)
+	}
+}
+
+// TestEMMSAScraper fetches yesterday's prices from the live EMMSA site. It
+// only runs with -live: go test ./internal/api/emmsa -run TestEMMSAScraper -live
+func TestEMMSAScraper(t *testing.T) {
+	if !*live {
+		t.Skip("skipping live EMMSA test, run with -live to enable it")
+	}
+
+	s, err := NewEMMSAScraper()
+	if err != nil {
+		t.Fatalf("Failed to create scraper: %v", err)
+	}
+	defer s.Close()
+
+	date := time.Now().AddDate(0, 0, -1)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	prices, err := s.ScrapePricesContext(ctx, date, nil)
+	if err != nil {
+		t.Fatalf("Failed to scrape prices: %v", err)
+	}
+
+	// EMMSA publishes no prices on some days, which is not a failure
+	t.Logf("Retrieved %d price entries for %s", len(prices), date.Format("2006-01-02"))
+	for i, p := range prices {
+		if i >= 5 {
+			break
 		}
+		t.Logf("Entry %d: %+v", i+1, p)
+	}
+}
+
+func TestScrapePricesFilter(t *testing.T) {
+	srv := emmsatest.NewServer()
+	defer srv.Close()
+	if err := srv.SetDayFile(fixtureDate, filepath.Join("testdata", "normal_day.html")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		filter    source.Filter
+		wantVprod string
+		wantVvari string
+	}{
+		{name: "single product", filter: source.Filter{Products: []string{"papa"}}, wantVprod: "PAPA"},
+		{name: "product and variety", filter: source.Filter{Products: []string{" papa "}, Varieties: []string{"papa amarilla"}}, wantVprod: "PAPA", wantVvari: "PAPA AMARILLA"},
+		{name: "several products", filter: source.Filter{Products: []string{"papa", "cebolla"}}},
+		{name: "variety only", filter: source.Filter{Varieties: []string{"papa amarilla"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewEMMSAScraper(WithBaseURL(srv.URL), WithFilter(tt.filter))
+			if err != nil {
+				t.Fatalf("Failed to create scraper: %v", err)
+			}
+			before := len(srv.Requests())
 
-		// Write to a file
-		filename := "emmsa_prices.json"
-		err = os.WriteFile(filename, jsonData, 0644)
+			prices, err := s.ScrapePrices(fixtureDate)
+			if err != nil {
+				t.Fatalf("Failed to scrape prices: %v", err)
+			}
+			if len(prices) == 0 {
+				t.Fatal("No prices matched the filter")
+			}
+			for _, p := range prices {
+				if !tt.filter.Match(p.Product, p.Variedad) {
+					t.Errorf("Price does not match the filter: %+v", p)
+				}
+			}
+
+			if n := len(srv.Requests()) - before; n != 1 {
+				t.Errorf("Sent %d requests, want 1", n)
+			}
+			req := srv.Requests()[before]
+			if got := req.Form.Get("vprod"); got != tt.wantVprod {
+				t.Errorf("Sent vprod %q, want %q", got, tt.wantVprod)
+			}
+			if got := req.Form.Get("vvari"); got != tt.wantVvari {
+				t.Errorf("Sent vvari %q, want %q", got, tt.wantVvari)
+			}
+		})
+	}
+
+	t.Run("accented names fall back to the full table", func(t *testing.T) {
+		accented := emmsatest.NewServer()
+		defer accented.Close()
+		accented.SetDay(fixtureDate, []byte(`<table>
+	<thead><tr><th>PRODUCTO</th><th>VARIEDAD</th><th>PRECIO MIN</th><th>PRECIO MAX</th><th>PRECIO PROM</th></tr></thead>
+	<tbody>
+		<tr><td>LIMÓN</td><td>LIMÓN SUTIL</td><td>2.00</td><td>2.50</td><td>2.25</td></tr>
+		<tr><td>PAPA</td><td>PAPA AMARILLA</td><td>3.00</td><td>3.40</td><td>3.20</td></tr>
+	</tbody>
+</table>`))
+
+		s, err := NewEMMSAScraper(WithBaseURL(accented.URL), WithFilter(source.Filter{Products: []string{"limon"}}))
+		if err != nil {
+			t.Fatalf("Failed to create scraper: %v", err)
+		}
+		prices, err := s.ScrapePrices(fixtureDate)
 		if err != nil {
-			t.Fatalf("Failed to write JSON to file: %v", err)
+			t.Fatalf("Failed to scrape prices: %v", err)
+		}
+		if len(prices) != 1 || prices[0].Product != "LIMÓN" {
+			t.Errorf("Got prices %+v, want the LIMÓN row", prices)
 		}
 
-		t.Logf("First 5 entries (full data saved to %s):\n", filename)
+		// EMMSA has no "LIMON", so the filtered request returns no rows
+		reqs := accented.Requests()
+		if len(reqs) != 2 {
+			t.Fatalf("Sent %d requests, want 2", len(reqs))
+		}
+		if got := reqs[0].Form.Get("vprod"); got != "LIMON" {
+			t.Errorf("First request sent vprod %q, want LIMON", got)
+		}
+		if got := reqs[1].Form.Get("vprod"); got != "" {
+			t.Errorf("Fallback request sent vprod %q, want it empty", got)
+		}
+	})
 
-		// Print first 5 entries to console
-		for i, p := range prices {
-			if i >= 5 {
-				break
-			}
-			entry, _ := json.MarshalIndent(p, "", "  ")
-			t.Logf("Entry %d:\n%s\n", i+1, string(entry))
+	t.Run("empty day is fetched unfiltered once", func(t *testing.T) {
+		s, err := NewEMMSAScraper(WithBaseURL(srv.URL), WithFilter(source.Filter{Products: []string{"papa"}}))
+		if err != nil {
+			t.Fatalf("Failed to create scraper: %v", err)
+		}
+		before := len(srv.Requests())
+		prices, err := s.ScrapePrices(fixtureDate.AddDate(0, 0, 1))
+		if err != nil {
+			t.Fatalf("Failed to scrape prices: %v", err)
+		}
+		if len(prices) != 0 {
+			t.Errorf("Got %d prices for an empty day", len(prices))
+		}
+		if n := len(srv.Requests()) - before; n != 2 {
+			t.Errorf("Sent %d requests, want 2", n)
 		}
+	})
 
-		t.Logf("\nFull data has been saved to %s", filename)
+	t.Run("per-call filter overrides the scraper's", func(t *testing.T) {
+		s, err := NewEMMSAScraper(WithBaseURL(srv.URL), WithFilter(source.Filter{Products: []string{"papa"}}))
+		if err != nil {
+			t.Fatalf("Failed to create scraper: %v", err)
+		}
+		prices, err := s.ScrapePricesContext(context.Background(), fixtureDate, &ScrapeOptions{
+			Filter: source.Filter{Products: []string{"CEBOLLA"}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to scrape prices: %v", err)
+		}
+		for _, p := range prices {
+			if p.Product != "CEBOLLA" {
+				t.Errorf("Unexpected product %q", p.Product)
+			}
+		}
 	})
 }
@@ -0,0 +1,221 @@
+// Package emmsatest provides a fake EMMSA server for tests that must not
+// depend on the live site.
+//
+// Example:
+//
+//	srv := emmsatest.NewServer()
+//	defer srv.Close()
+//	srv.SetDay(date, html)
+//	s, err := scraper.NewEMMSAScraper(scraper.WithBaseURL(srv.URL))
+package emmsatest
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ReportPath is the endpoint the EMMSA scraper posts report requests to
+const ReportPath = "/emmsa_spv/app/reportes/ajax/rpt07_gettable_new_web.php"
+
+// EmptyTable is what EMMSA answers for a day without prices
+const EmptyTable = `<table class="table table-bordered table-striped" id="tblResultados">
+	<thead>
+		<tr><th>PRODUCTO</th><th>VARIEDAD</th><th>PRECIO MIN</th><th>PRECIO MAX</th><th>PRECIO PROM</th></tr>
+	</thead>
+	<tbody>
+		<tr><td colspan="5" align="center">No se encontraron registros</td></tr>
+	</tbody>
+</table>`
+
+// dateLayout is the format of the vfecha form field
+const dateLayout = "02/01/2006"
+
+// Report types, sent as the vid_tipo form field
+const (
+	// ReportDailyPrices is the daily prices report
+	ReportDailyPrices = 1
+	// ReportDailyVolumes is the daily volumes report
+	ReportDailyVolumes = 2
+)
+
+// pageKey identifies the page served for a report and day
+type pageKey struct {
+	report string
+	date   string
+}
+
+// Request is a report request received by the server
+type Request struct {
+	// Date is the requested day, as sent in the vfecha field (dd/mm/yyyy)
+	Date string
+	// Form holds all the posted form fields
+	Form url.Values
+	// Header holds the request headers
+	Header http.Header
+}
+
+// Server is a fake EMMSA report endpoint serving one page per report type
+// and day. Days without a page answer with EmptyTable, like the real site.
+//
+// Like the real site, non-empty vprod and vvari fields keep only the rows
+// whose product and variety are spelled exactly like them, so "LIMON" does
+// not match "LIMÓN"; a request matching no rows gets EmptyTable.
+// It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	pages    map[pageKey][]byte
+	failures []int
+	requests []Request
+}
+
+// NewServer starts a fake EMMSA server. Callers must Close it.
+func NewServer() *Server {
+	s := &Server{pages: make(map[pageKey][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// SetDay sets the daily prices table served for the given day
+func (s *Server) SetDay(date time.Time, html []byte) {
+	s.SetReport(ReportDailyPrices, date, html)
+}
+
+// SetDayFile serves the contents of an HTML fixture as the daily prices of
+// the given day
+func (s *Server) SetDayFile(date time.Time, path string) error {
+	return s.SetReportFile(ReportDailyPrices, date, path)
+}
+
+// SetReport sets the HTML table served for a report type and day
+func (s *Server) SetReport(report int, date time.Time, html []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages[pageKey{strconv.Itoa(report), date.Format(dateLayout)}] = html
+}
+
+// SetReportFile serves the contents of an HTML fixture for a report type and day
+func (s *Server) SetReportFile(report int, date time.Time, path string) error {
+	html, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read fixture: %w", err)
+	}
+	s.SetReport(report, date, html)
+	return nil
+}
+
+// FailNext makes the next n requests fail with the given status code
+func (s *Server) FailNext(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// Requests returns the report requests received so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != ReportPath {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	date := r.PostForm.Get("vfecha")
+	s.requests = append(s.requests, Request{Date: date, Form: r.PostForm, Header: r.Header.Clone()})
+	var status int
+	if len(s.failures) > 0 {
+		status, s.failures = s.failures[0], s.failures[1:]
+	}
+	page, ok := s.pages[pageKey{r.PostForm.Get("vid_tipo"), date}]
+	s.mu.Unlock()
+
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		http.Error(w, "invalid vfecha", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+	if ok {
+		page = filterRows(page, r.PostForm.Get("vprod"), r.PostForm.Get("vvari"))
+	}
+	if page == nil {
+		page = []byte(EmptyTable)
+	}
+	w.Write(page)
+}
+
+// filterRows keeps the data rows of the page whose PRODUCTO and VARIEDAD
+// cells equal vprod and vvari, an empty value matching every row. It returns
+// nil if no data row is left and the page unchanged if it is not a table
+// with those columns.
+func filterRows(page []byte, vprod, vvari string) []byte {
+	if vprod == "" && vvari == "" {
+		return page
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return page
+	}
+
+	columns := map[string]int{}
+	doc.Find("tr").First().ChildrenFiltered("th").Each(func(i int, th *goquery.Selection) {
+		columns[strings.TrimSpace(th.Text())] = i
+	})
+	product, okProduct := columns["PRODUCTO"]
+	variety, okVariety := columns["VARIEDAD"]
+	if !okProduct || !okVariety {
+		return page
+	}
+
+	kept := 0
+	doc.Find("tr").Each(func(_ int, tr *goquery.Selection) {
+		cells := tr.ChildrenFiltered("td")
+		if cells.Length() <= max(product, variety) {
+			return
+		}
+		if (vprod != "" && strings.TrimSpace(cells.Eq(product).Text()) != vprod) ||
+			(vvari != "" && strings.TrimSpace(cells.Eq(variety).Text()) != vvari) {
+			tr.Remove()
+			return
+		}
+		kept++
+	})
+	if kept == 0 {
+		return nil
+	}
+	html, err := goquery.OuterHtml(doc.Find("table").First())
+	if err != nil {
+		return page
+	}
+	return []byte(html)
+}
@@ -0,0 +1,108 @@
+package emmsatest
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func post(t *testing.T, srv *Server, date string) (int, string) {
+	t.Helper()
+	resp, err := http.PostForm(srv.URL+ReportPath, url.Values{"vid_tipo": {"1"}, "vfecha": {date}})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+	srv := NewServer()
+	defer srv.Close()
+
+	day := time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, srv.SetDayFile(day, filepath.Join("..", "testdata", "normal_day.html")))
+
+	status, body := post(t, srv, "17/06/2025")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "tblResultados")
+	assert.NotEqual(t, EmptyTable, body)
+
+	status, body = post(t, srv, "18/06/2025")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, EmptyTable, body, "unknown days are empty")
+
+	srv.SetReport(ReportDailyVolumes, day, []byte("<table>volumes</table>"))
+	resp, err := http.PostForm(srv.URL+ReportPath, url.Values{"vid_tipo": {"2"}, "vfecha": {"17/06/2025"}})
+	require.NoError(t, err)
+	volumes, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "<table>volumes</table>", string(volumes), "pages are served per report type")
+
+	srv.FailNext(2, http.StatusBadGateway)
+	status, _ = post(t, srv, "17/06/2025")
+	assert.Equal(t, http.StatusBadGateway, status)
+	status, _ = post(t, srv, "17/06/2025")
+	assert.Equal(t, http.StatusBadGateway, status)
+	status, _ = post(t, srv, "17/06/2025")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = post(t, srv, "2025-06-17")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	requests := srv.Requests()
+	require.Len(t, requests, 7)
+	assert.Equal(t, "18/06/2025", requests[1].Date)
+	assert.Equal(t, "1", requests[1].Form.Get("vid_tipo"))
+}
+
+func TestServerFilter(t *testing.T) {
+	t.Parallel()
+	srv := NewServer()
+	defer srv.Close()
+	day := time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, srv.SetDayFile(day, filepath.Join("..", "testdata", "normal_day.html")))
+
+	filtered := func(vprod, vvari string) string {
+		t.Helper()
+		resp, err := http.PostForm(srv.URL+ReportPath, url.Values{"vid_tipo": {"1"}, "vfecha": {"17/06/2025"},
+			"vprod": {vprod}, "vvari": {vvari}})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	body := filtered("LIMON", "")
+	assert.Contains(t, body, "LIMON CITRICO BOLSA")
+	assert.NotContains(t, body, "ACELGA")
+
+	body = filtered("LIMON", "LIMON CITRICO CAJON")
+	assert.Contains(t, body, "LIMON CITRICO CAJON")
+	assert.NotContains(t, body, "LIMON CITRICO BOLSA")
+
+	assert.Equal(t, EmptyTable, filtered("LIMÓN", ""), "names must be spelled exactly")
+	assert.Equal(t, EmptyTable, filtered("limon", ""), "names are case-sensitive")
+	assert.Contains(t, filtered("", ""), "ACELGA", "empty fields keep every row")
+}
+
+func TestServerUnknownPath(t *testing.T) {
+	t.Parallel()
+	srv := NewServer()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Empty(t, srv.Requests())
+}
@@ -0,0 +1,189 @@
+package scraper
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// currencyMarks are the currency prefixes and suffixes EMMSA may put around
+// prices, longest first
+var currencyMarks = []string{"US$", "S/.", "S/", "PEN", "$"}
+
+// placeholders are the cell texts EMMSA uses for a value that was not quoted
+var placeholders = map[string]bool{
+	"":     true,
+	"-":    true,
+	"--":   true,
+	"---":  true,
+	"–":    true,
+	"—":    true,
+	"*":    true,
+	"n/d":  true,
+	"n.d.": true,
+	"nd":   true,
+	"s/d":  true,
+	"s/p":  true,
+}
+
+// FieldError describes a table cell that could not be parsed as a number
+type FieldError struct {
+	// Field is the JSON name of the field the cell was parsed into
+	Field string `json:"field"`
+	// Text is the cell text as sent by EMMSA
+	Text string `json:"text"`
+	// Reason explains why the text is not a number
+	Reason string `json:"reason"`
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: cannot parse %q: %s", e.Field, e.Text, e.Reason)
+}
+
+// parseNumber parses a price or volume as formatted by EMMSA.
+//
+// It accepts currency marks ("S/ 3.20"), thousands separators ("1,250.00",
+// "1.250,00", "1 250"), and decimal commas ("2,50"). A single separator
+// followed by exactly three digits is read as a thousands separator if it is
+// a comma ("1,250") and as a decimal point if it is a dot ("1.250"), which is
+// how EMMSA writes prices. Placeholders such as "-", "n/d" and blank cells
+// report missing instead of an error.
+//
+// Besides the currency marks, only digits, the separators and a leading sign
+// are accepted, so strconv.ParseFloat syntax such as "NaN", "Inf", "1e9" and
+// "0x1p3" is an error rather than a price.
+func parseNumber(text string) (value float64, missing bool, err error) {
+	s := strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		return r
+	}, text))
+	if placeholders[strings.ToLower(s)] {
+		return 0, true, nil
+	}
+
+	for _, mark := range currencyMarks {
+		if len(s) > len(mark) && strings.EqualFold(s[:len(mark)], mark) {
+			s = s[len(mark):]
+			break
+		}
+		if len(s) > len(mark) && strings.EqualFold(s[len(s)-len(mark):], mark) {
+			s = s[:len(s)-len(mark)]
+			break
+		}
+	}
+	// Spaces may separate the currency mark or group thousands
+	s = strings.ReplaceAll(s, " ", "")
+	if s == "" {
+		return 0, false, fmt.Errorf("no digits")
+	}
+
+	if err := checkCharacters(s); err != nil {
+		return 0, false, err
+	}
+
+	normalized, err := normalizeSeparators(s)
+	if err != nil {
+		return 0, false, err
+	}
+	value, err = strconv.ParseFloat(normalized, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false, fmt.Errorf("not a number")
+	}
+	return value, false, nil
+}
+
+// checkCharacters reports an error if s has anything but digits, thousands
+// and decimal separators and a leading sign
+func checkCharacters(s string) error {
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9', r == ',', r == '.':
+		case (r == '-' || r == '+') && i == 0:
+		default:
+			return fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return nil
+}
+
+// normalizeSeparators rewrites a number with thousands and decimal
+// separators into the format accepted by strconv.ParseFloat
+func normalizeSeparators(s string) (string, error) {
+	commas, dots := strings.Count(s, ","), strings.Count(s, ".")
+
+	var thousands, decimal string
+	switch {
+	case commas > 0 && dots > 0:
+		// The last separator is the decimal one: "1,250.00" or "1.250,00"
+		if strings.LastIndex(s, ",") > strings.LastIndex(s, ".") {
+			thousands, decimal = ".", ","
+		} else {
+			thousands, decimal = ",", "."
+		}
+	case commas > 1:
+		thousands = ","
+	case commas == 1:
+		if len(s)-strings.Index(s, ",")-1 == 3 {
+			thousands = ","
+		} else {
+			decimal = ","
+		}
+	case dots > 1:
+		thousands = "."
+	}
+
+	if thousands != "" {
+		intPart := s
+		if decimal != "" {
+			if strings.Count(s, decimal) > 1 {
+				return "", fmt.Errorf("more than one decimal separator")
+			}
+			intPart = s[:strings.LastIndex(s, decimal)]
+		}
+		groups := strings.Split(strings.TrimPrefix(intPart, "-"), thousands)
+		if len(groups[0]) == 0 || len(groups[0]) > 3 {
+			return "", fmt.Errorf("misplaced thousands separator")
+		}
+		for _, g := range groups[1:] {
+			if len(g) != 3 {
+				return "", fmt.Errorf("misplaced thousands separator")
+			}
+		}
+		s = strings.ReplaceAll(s, thousands, "")
+	}
+	if decimal == "," {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return s, nil
+}
+
+// numberField is a numeric cell of a row and the field it is parsed into
+type numberField struct {
+	// name is the JSON name of the field
+	name string
+	col  column
+	dst  *float64
+}
+
+// parseNumbers parses the numeric cells of a row into their fields. It
+// returns the names of the fields with a placeholder and an error for every
+// cell that is not a number.
+func parseNumbers(row tableRow, fields []numberField) (missing []string, errs []FieldError) {
+	for _, f := range fields {
+		text := row.value(f.col)
+		value, isMissing, err := parseNumber(text)
+		switch {
+		case err != nil:
+			errs = append(errs, FieldError{Field: f.name, Text: text, Reason: err.Error()})
+		case isMissing:
+			missing = append(missing, f.name)
+		default:
+			*f.dst = value
+		}
+	}
+	return missing, errs
+}
@@ -0,0 +1,77 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    float64
+		missing bool
+		err     bool
+	}{
+		{text: "1.35", want: 1.35},
+		{text: " 3.30 ", want: 3.3},
+		{text: "6", want: 6},
+		{text: "1,250.00", want: 1250},
+		{text: "1.250,00", want: 1250},
+		{text: "1,250", want: 1250},
+		{text: "1.250", want: 1.25},
+		{text: "1,250,000", want: 1250000},
+		{text: "1 250,5", want: 1250.5},
+		{text: "2,50", want: 2.5},
+		{text: "2,5", want: 2.5},
+		{text: "S/ 3.20", want: 3.2},
+		{text: "S/.3.20", want: 3.2},
+		{text: "s/ 1,250.00", want: 1250},
+		{text: "3.20 PEN", want: 3.2},
+		{text: " 3.10", want: 3.1},
+		{text: "-", missing: true},
+		{text: "—", missing: true},
+		{text: "", missing: true},
+		{text: "  ", missing: true},
+		{text: "N/D", missing: true},
+		{text: "1.2O", err: true},
+		{text: "1,2,3", err: true},
+		{text: "12,50,00", err: true},
+		{text: "1.250.00,5,0", err: true},
+		{text: "S/", err: true},
+		{text: "abc", err: true},
+		{text: "-3.20", want: -3.2},
+		{text: "+3.20", want: 3.2},
+		{text: "NaN", err: true},
+		{text: "nan", err: true},
+		{text: "Inf", err: true},
+		{text: "-Inf", err: true},
+		{text: "infinity", err: true},
+		{text: "1e9", err: true},
+		{text: "1E9", err: true},
+		{text: "0x1p3", err: true},
+		{text: "0x10", err: true},
+		{text: "1_000", err: true},
+		{text: "--3", err: true},
+		{text: "3-", err: true},
+		{text: "+-3", err: true},
+		{text: "S/ NaN", err: true},
+		{text: strings.Repeat("9", 400), err: true},
+	}
+
+	for _, tt := range tests {
+		got, missing, err := parseNumber(tt.text)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseNumber(%q) = %v, expected an error", tt.text, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseNumber(%q) returned error: %v", tt.text, err)
+			continue
+		}
+		if missing != tt.missing || got != tt.want {
+			t.Errorf("parseNumber(%q) = %v (missing %v), want %v (missing %v)", tt.text, got, missing, tt.want, tt.missing)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package scraper
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+)
+
+// Option configures an EMMSAScraper created by NewEMMSAScraper
+type Option func(*config)
+
+// config collects the options before the scraper is built
+type config struct {
+	baseURL    string
+	httpClient *http.Client
+	userAgent  string
+	timeout    time.Duration
+	logger     *log.Logger
+	retry      RetryPolicy
+	breaker    *CircuitBreaker
+	filter     source.Filter
+}
+
+// WithBaseURL sets the scheme and host requests are sent to, e.g. the URL
+// of an httptest.Server. The EMMSA report paths are appended to it.
+func WithBaseURL(baseURL string) Option {
+	return func(c *config) {
+		c.baseURL = baseURL
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to send requests
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.httpClient = client
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request
+func WithUserAgent(userAgent string) Option {
+	return func(c *config) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithTimeout sets the timeout of a single request attempt. It also applies
+// to a client set with WithHTTPClient, which is copied rather than modified.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeout = timeout
+	}
+}
+
+// WithLogger sets the logger the scraper reports progress and retries to
+func WithLogger(logger *log.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithRetryPolicy sets how transient failures are retried
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *config) {
+		c.retry = policy
+	}
+}
+
+// WithCircuitBreaker sets the circuit breaker guarding the requests. Pass a
+// breaker with a threshold of 0 to disable it.
+func WithCircuitBreaker(breaker *CircuitBreaker) Option {
+	return func(c *config) {
+		c.breaker = breaker
+	}
+}
+
+// WithFilter restricts the scraped prices to the given products and
+// varieties, unless a call passes its own ScrapeOptions.Filter
+func WithFilter(filter source.Filter) Option {
+	return func(c *config) {
+		c.filter = filter
+	}
+}
@@ -0,0 +1,101 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewEMMSAScraperOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != reportPath {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("User-Agent"); got != "price-tracker-test" {
+			t.Errorf("unexpected User-Agent %q", got)
+		}
+		if got := r.FormValue("vfecha"); got != "17/06/2025" {
+			t.Errorf("unexpected vfecha %q", got)
+		}
+		w.Write([]byte(sampleTable))
+	}))
+	defer server.Close()
+
+	s, err := NewEMMSAScraper(WithBaseURL(server.URL+"/"), WithUserAgent("price-tracker-test"), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("Failed to create scraper: %v", err)
+	}
+	if s.httpClient.Timeout != time.Second {
+		t.Errorf("expected a 1s timeout, got %s", s.httpClient.Timeout)
+	}
+
+	prices, err := s.ScrapePricesContext(context.Background(), time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(prices) != 1 {
+		t.Errorf("expected 1 price, got %d", len(prices))
+	}
+}
+
+func TestNewEMMSAScraperInvalidBaseURL(t *testing.T) {
+	if _, err := NewEMMSAScraper(WithBaseURL("not a url")); err == nil {
+		t.Fatal("expected an error for an invalid base URL")
+	}
+}
+
+func TestWithTimeoutCopiesClient(t *testing.T) {
+	client := &http.Client{Timeout: time.Minute}
+	s, err := NewEMMSAScraper(WithHTTPClient(client), WithTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("Failed to create scraper: %v", err)
+	}
+	if client.Timeout != time.Minute {
+		t.Error("the caller's client must not be modified")
+	}
+	if s.httpClient.Timeout != time.Second {
+		t.Errorf("expected a 1s timeout, got %s", s.httpClient.Timeout)
+	}
+}
+
+func TestScrapePricesContextCancellation(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	s := newTestScraper(t, server)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := s.ScrapePricesContext(ctx, time.Now(), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancellation took %s", elapsed)
+	}
+}
+
+func TestScrapePricesContextTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	// Backoff longer than the call timeout: the wait between retries is aborted
+	s := newTestScraper(t, server, WithRetryPolicy(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Minute}))
+	_, err := s.ScrapePricesContext(context.Background(), time.Now(), &ScrapeOptions{Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// update regenerates the golden files: go test ./internal/api/emmsa -update
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// fixtureDate is the day the HTML fixtures were recorded for
+var fixtureDate = time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC)
+
+// TestParsePriceTableGolden parses every testdata/*.html fixture and compares
+// the result with the matching .golden.json file
+func TestParsePriceTableGolden(t *testing.T) {
+	testGolden(t, "testdata", func(html []byte) (any, error) {
+		prices, _, err := parsePriceTable(log.New(io.Discard, "", 0), html, fixtureDate)
+		if prices == nil {
+			prices = []EMMSAPrice{}
+		}
+		return prices, err
+	})
+}
+
+// TestParseVolumeTableGolden does the same for the volume fixtures in
+// testdata/volumes
+func TestParseVolumeTableGolden(t *testing.T) {
+	testGolden(t, filepath.Join("testdata", "volumes"), func(html []byte) (any, error) {
+		volumes, _, err := parseVolumeTable(log.New(io.Discard, "", 0), html, fixtureDate)
+		if volumes == nil {
+			volumes = []EMMSAVolume{}
+		}
+		return volumes, err
+	})
+}
+
+// testGolden parses every *.html fixture of dir and compares the JSON result
+// with the matching .golden.json file. Parse errors are part of the golden
+// output, so fixtures of layouts that must be rejected are covered too.
+func testGolden(t *testing.T, dir string, parse func(html []byte) (any, error)) {
+	fixtures, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatalf("No fixtures found in %s", dir)
+	}
+
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".html")
+		t.Run(name, func(t *testing.T) {
+			html, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := parse(html)
+			if err != nil {
+				parsed = map[string]string{"error": err.Error()}
+			}
+			got, err := json.MarshalIndent(parsed, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join(dir, name+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Failed to read golden file (run with -update to create it): %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Parsed %s does not match %s (run with -update if the change is expected)\ngot:\n%s", fixture, golden, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package scraper
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+)
+
+// ReportType is a report served by the EMMSA report endpoint, sent as the
+// vid_tipo form field
+type ReportType int
+
+const (
+	// ReportDailyPrices is the "Precios Diarios" report of min, max and
+	// average prices per variety
+	ReportDailyPrices ReportType = 1
+	// ReportDailyVolumes is the "Volumen de Ingreso" report of the tonnes of
+	// each variety that entered the market
+	ReportDailyVolumes ReportType = 2
+)
+
+// String returns the name of the report, matching the source.ReportType names
+func (r ReportType) String() string {
+	switch r {
+	case ReportDailyPrices:
+		return string(source.ReportDailyPrices)
+	case ReportDailyVolumes:
+		return string(source.ReportDailyVolumes)
+	default:
+		return "report " + strconv.Itoa(int(r))
+	}
+}
+
+// EMMSAVolume represents the volume data from EMMSA
+type EMMSAVolume struct {
+	Date     string `json:"date"`
+	Product  string `json:"product"`
+	Variedad string `json:"variedad"`
+	// Volumen is the volume that entered the market, in tonnes
+	Volumen float64 `json:"volumen"`
+	// Missing lists "volumen" if EMMSA did not publish the volume
+	Missing []string `json:"missing,omitempty"`
+}
+
+// ScrapeVolumes fetches the daily volumes from EMMSA API.
+//
+// It is equivalent to ScrapeVolumesContext with a background context and
+// default options.
+func (s *EMMSAScraper) ScrapeVolumes(date time.Time) ([]EMMSAVolume, error) {
+	return s.ScrapeVolumesContext(context.Background(), date, nil)
+}
+
+// ScrapeVolumesContext fetches the daily volumes from EMMSA API, with the
+// same retry, circuit breaker and filtering behaviour as ScrapePricesContext.
+func (s *EMMSAScraper) ScrapeVolumesContext(ctx context.Context, date time.Time, opts *ScrapeOptions) ([]EMMSAVolume, error) {
+	return scrapeReport(ctx, s, ReportDailyVolumes, date, opts, parseVolumeTable, func(v EMMSAVolume) (string, string) {
+		return v.Product, v.Variedad
+	})
+}
+
+// volumeColumns are the columns required in the daily volumes table
+var volumeColumns = []column{colProduct, colVariety, colVolume}
+
+// parseVolumeTable parses the volume table from the API response, locating
+// the product, variety and volume (in tonnes) columns by their header
+func parseVolumeTable(logger *log.Logger, html []byte, date time.Time) ([]EMMSAVolume, ParseStats, error) {
+	var stats ParseStats
+	rows, err := tableRows(html, ReportDailyVolumes, volumeColumns, &stats)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	var volumes []EMMSAVolume
+	for _, row := range rows {
+		volume := EMMSAVolume{
+			Date:     date.Format("2006-01-02"),
+			Product:  row.value(colProduct),
+			Variedad: row.value(colVariety),
+		}
+		missing, errs := parseNumbers(row, []numberField{{"volumen", colVolume, &volume.Volumen}})
+		if len(errs) > 0 {
+			stats.skipInvalid(row, errs)
+			continue
+		}
+		volume.Missing = missing
+		volumes = append(volumes, volume)
+	}
+	stats.Parsed = len(volumes)
+
+	logger.Printf("Parsed volume table for date %s: %s", date.Format("2006-01-02"), stats)
+	return volumes, stats, nil
+}
@@ -0,0 +1,58 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/retry"
+)
+
+// RetryPolicy controls how failed EMMSA requests are retried.
+//
+// Only transient failures are retried: transport errors, timeouts, 429 and
+// 5xx responses. Other 4xx responses fail immediately.
+type RetryPolicy = retry.Policy
+
+// DefaultRetryPolicy returns the retry policy used by NewEMMSAScraper
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// StatusError is returned when EMMSA answers with a non-200 status code
+type StatusError struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// Body is the response body, which usually explains the failure
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// isRetryable reports whether a failed request may succeed if retried. An
+// attempt that hit the client timeout is retried; the caller giving up is
+// checked on its context by postWithRetry.
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// Any other transport failure (connection reset, unexpected EOF, ...)
+	return retry.IsTransport(err)
+}
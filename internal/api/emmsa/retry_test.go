@@ -0,0 +1,182 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sampleTable is a minimal EMMSA response with one valid row
+const sampleTable = `<table>
+<tr><th>Producto</th><th>Variedad</th><th>Min</th><th>Max</th><th>Prom</th></tr>
+<tr><td>PAPA</td><td>PAPA BLANCA</td><td>1.20</td><td>1.50</td><td>1.35</td></tr>
+</table>`
+
+// newTestScraper returns a scraper pointed at the server with fast retries
+func newTestScraper(t *testing.T, server *httptest.Server, opts ...Option) *EMMSAScraper {
+	t.Helper()
+	s, err := NewEMMSAScraper(append([]Option{
+		WithBaseURL(server.URL),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, Multiplier: 2}),
+	}, opts...)...)
+	if err != nil {
+		t.Fatalf("Failed to create scraper: %v", err)
+	}
+	return s
+}
+
+func TestScrapePricesRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantErr      bool
+		wantAttempts int32
+	}{
+		{name: "success", statuses: []int{200}, wantAttempts: 1},
+		{name: "retries 5xx", statuses: []int{502, 503, 200}, wantAttempts: 3},
+		{name: "retries 429", statuses: []int{429, 200}, wantAttempts: 2},
+		{name: "gives up", statuses: []int{500, 500, 500}, wantErr: true, wantAttempts: 3},
+		{name: "no retry on 4xx", statuses: []int{404}, wantErr: true, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := attempts.Add(1)
+				status := tt.statuses[n-1]
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					w.Write([]byte(sampleTable))
+				}
+			}))
+			defer server.Close()
+
+			s := newTestScraper(t, server)
+			prices, err := s.ScrapePrices(time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC))
+
+			if tt.wantErr && err == nil {
+				t.Fatal("expected an error")
+			}
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(prices) != 1 {
+					t.Errorf("expected 1 price, got %d", len(prices))
+				}
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.wantAttempts, got)
+			}
+		})
+	}
+}
+
+func TestScrapePricesCircuitBreaker(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	breaker := NewCircuitBreaker(2, time.Minute)
+	s := newTestScraper(t, server, WithCircuitBreaker(breaker))
+	date := time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC)
+
+	// The second failed attempt opens the breaker and stops the retries
+	_, err := s.ScrapePrices(date)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("expected 2 attempts, got %d", got)
+	}
+
+	// While open, no request is sent at all
+	if _, err := s.ScrapePrices(date); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("expected no new attempt while open, got %d", got)
+	}
+
+	// After the cooldown a probe is let through and reopens the breaker on failure
+	breaker.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := s.ScrapePrices(date); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen after failed probe, got %v", err)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("expected a single probe attempt, got %d", got)
+	}
+	if breaker.State() != BreakerOpen {
+		t.Errorf("expected breaker to be open, got %s", breaker.State())
+	}
+}
+
+// slowServer answers with sampleTable, after hanging until the client gives
+// up on the first slow attempts
+func slowServer(t *testing.T, slow int32, attempts *atomic.Int32) *httptest.Server {
+	t.Helper()
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= slow {
+			<-release
+			return
+		}
+		w.Write([]byte(sampleTable))
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	return server
+}
+
+func TestScrapePricesTimeout(t *testing.T) {
+	date := time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC)
+
+	t.Run("retries attempts that time out", func(t *testing.T) {
+		var attempts atomic.Int32
+		s := newTestScraper(t, slowServer(t, 1, &attempts), WithTimeout(50*time.Millisecond))
+		prices, err := s.ScrapePrices(date)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(prices) != 1 || attempts.Load() != 2 {
+			t.Errorf("expected 1 price after 2 attempts, got %d after %d", len(prices), attempts.Load())
+		}
+	})
+
+	t.Run("timeouts open the circuit breaker", func(t *testing.T) {
+		var attempts atomic.Int32
+		breaker := NewCircuitBreaker(2, time.Minute)
+		s := newTestScraper(t, slowServer(t, 3, &attempts), WithTimeout(50*time.Millisecond), WithCircuitBreaker(breaker))
+		if _, err := s.ScrapePrices(date); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected ErrCircuitOpen, got %v", err)
+		}
+		if got := attempts.Load(); got != 2 {
+			t.Errorf("expected 2 attempts, got %d", got)
+		}
+	})
+
+	t.Run("caller deadline is not retried", func(t *testing.T) {
+		var attempts atomic.Int32
+		breaker := NewCircuitBreaker(1, time.Minute)
+		s := newTestScraper(t, slowServer(t, 3, &attempts), WithCircuitBreaker(breaker))
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if _, err := s.ScrapePricesContext(ctx, date, nil); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+		if got := attempts.Load(); got != 1 {
+			t.Errorf("expected 1 attempt, got %d", got)
+		}
+		if breaker.State() != BreakerClosed {
+			t.Errorf("expected the breaker to ignore the cancelled attempt, got %s", breaker.State())
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package scraper
+
+import (
+	"context"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+)
+
+const (
+	// SourceName is the name the EMMSA source is registered under
+	SourceName = "emmsa"
+
+	// marketName is the wholesale market EMMSA publishes prices for
+	marketName = "Gran Mercado Mayorista de Lima"
+	// priceUnit is the unit EMMSA prices refer to
+	priceUnit = "kg"
+	// priceCurrency is the currency EMMSA prices are quoted in (Peruvian sol)
+	priceCurrency = "PEN"
+	// volumeUnit is the unit EMMSA volumes refer to (metric tonnes)
+	volumeUnit = "t"
+)
+
+// Source adapts EMMSAScraper to the source.PriceSource and
+// source.VolumeSource interfaces
+type Source struct {
+	scraper *EMMSAScraper
+}
+
+var _ source.VolumeSource = (*Source)(nil)
+
+// NewSource creates a new EMMSA price source, passing the options to NewEMMSAScraper
+func NewSource(opts ...Option) (source.PriceSource, error) {
+	s, err := NewEMMSAScraper(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Source{scraper: s}, nil
+}
+
+// Name returns the registry name of the source
+func (s *Source) Name() string {
+	return SourceName
+}
+
+// ReportTypes returns the report types supported by EMMSA
+func (s *Source) ReportTypes() []source.ReportType {
+	return []source.ReportType{source.ReportDailyPrices, source.ReportDailyVolumes}
+}
+
+// FetchPrices fetches the daily prices for the given date and normalizes them
+func (s *Source) FetchPrices(ctx context.Context, date time.Time) ([]source.PriceRecord, error) {
+	prices, err := s.scraper.ScrapePricesContext(ctx, date, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ToPriceRecords(prices), nil
+}
+
+// FetchVolumes fetches the daily volumes for the given date and normalizes them
+func (s *Source) FetchVolumes(ctx context.Context, date time.Time) ([]source.VolumeRecord, error) {
+	volumes, err := s.scraper.ScrapeVolumesContext(ctx, date, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ToVolumeRecords(volumes), nil
+}
+
+// Close releases any resources used by the source
+func (s *Source) Close() error {
+	return s.scraper.Close()
+}
+
+// priceFields and volumeFields map EMMSA field names to the names used in
+// the normalized records
+var (
+	priceFields  = map[string]string{"precio_min": "min", "precio_max": "max", "precio_prom": "avg"}
+	volumeFields = map[string]string{"volumen": "volume"}
+)
+
+// renameFields maps field names with names, keeping unknown names as is
+func renameFields(fields []string, names map[string]string) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+	renamed := make([]string, len(fields))
+	for i, f := range fields {
+		renamed[i] = f
+		if name, ok := names[f]; ok {
+			renamed[i] = name
+		}
+	}
+	return renamed
+}
+
+// ToPriceRecords converts EMMSA prices into normalized price records
+func ToPriceRecords(prices []EMMSAPrice) []source.PriceRecord {
+	records := make([]source.PriceRecord, 0, len(prices))
+	for _, p := range prices {
+		records = append(records, source.PriceRecord{
+			Date:     p.Date,
+			Source:   SourceName,
+			Market:   marketName,
+			Product:  p.Product,
+			Variety:  p.Variedad,
+			Unit:     priceUnit,
+			Currency: priceCurrency,
+			Min:      p.PrecioMin,
+			Max:      p.PrecioMax,
+			Avg:      p.PrecioProm,
+			Missing:  renameFields(p.Missing, priceFields),
+		})
+	}
+	return records
+}
+
+// ToVolumeRecords converts EMMSA volumes into normalized volume records
+func ToVolumeRecords(volumes []EMMSAVolume) []source.VolumeRecord {
+	records := make([]source.VolumeRecord, 0, len(volumes))
+	for _, v := range volumes {
+		records = append(records, source.VolumeRecord{
+			Date:    v.Date,
+			Source:  SourceName,
+			Market:  marketName,
+			Product: v.Product,
+			Variety: v.Variedad,
+			Unit:    volumeUnit,
+			Volume:  v.Volumen,
+			Missing: renameFields(v.Missing, volumeFields),
+		})
+	}
+	return records
+}
@@ -0,0 +1,92 @@
+package scraper
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aliasthewho/price_tracker/internal/api/emmsa/emmsatest"
+	"github.com/aliasthewho/price_tracker/internal/source"
+)
+
+func TestToPriceRecords(t *testing.T) {
+	prices := []EMMSAPrice{
+		{Date: "2025-06-17", Product: "PAPA", Variedad: "PAPA BLANCA", PrecioMin: 1.2, PrecioMax: 1.5, PrecioProm: 1.35},
+	}
+
+	records := ToPriceRecords(prices)
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+
+	want := source.PriceRecord{
+		Date:     "2025-06-17",
+		Source:   SourceName,
+		Market:   marketName,
+		Product:  "PAPA",
+		Variety:  "PAPA BLANCA",
+		Unit:     "kg",
+		Currency: "PEN",
+		Min:      1.2,
+		Max:      1.5,
+		Avg:      1.35,
+	}
+	if !reflect.DeepEqual(records[0], want) {
+		t.Errorf("unexpected record:\n got %+v\nwant %+v", records[0], want)
+	}
+}
+
+func TestToPriceRecordsMissing(t *testing.T) {
+	records := ToPriceRecords([]EMMSAPrice{
+		{Date: "2025-06-17", Product: "HABA", Variedad: "HABA VERDE", PrecioMax: 2, Missing: []string{"precio_min", "precio_prom"}},
+	})
+	if got := records[0].Missing; !reflect.DeepEqual(got, []string{"min", "avg"}) {
+		t.Errorf("Missing = %v, want [min avg]", got)
+	}
+	if !records[0].IsMissing("avg") || records[0].IsMissing("max") {
+		t.Error("IsMissing does not match Missing")
+	}
+}
+
+func TestSourceFetchVolumes(t *testing.T) {
+	srv := emmsatest.NewServer()
+	defer srv.Close()
+	path := filepath.Join("testdata", "volumes", "normal_day.html")
+	if err := srv.SetReportFile(emmsatest.ReportDailyVolumes, fixtureDate, path); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSource(WithBaseURL(srv.URL), WithFilter(source.Filter{Products: []string{"papa"}}))
+	if err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	defer s.Close()
+	if !source.Supports(s, source.ReportDailyVolumes) {
+		t.Fatal("EMMSA source must support the daily volumes report")
+	}
+
+	records, err := s.(source.VolumeSource).FetchVolumes(context.Background(), fixtureDate)
+	if err != nil {
+		t.Fatalf("Failed to fetch volumes: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 potato records, got %d: %+v", len(records), records)
+	}
+	want := source.VolumeRecord{
+		Date:    "2025-06-17",
+		Source:  SourceName,
+		Market:  marketName,
+		Product: "PAPA",
+		Variety: "PAPA BLANCA",
+		Unit:    "t",
+		Volume:  1250.5,
+	}
+	if !reflect.DeepEqual(records[1], want) {
+		t.Errorf("unexpected record:\n got %+v\nwant %+v", records[1], want)
+	}
+
+	if got := srv.Requests()[0].Form.Get("vid_tipo"); got != "2" {
+		t.Errorf("Sent vid_tipo %q, want 2", got)
+	}
+}
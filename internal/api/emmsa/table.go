@@ -0,0 +1,320 @@
+package scraper
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aliasthewho/price_tracker/internal/source"
+)
+
+// column is a logical column of an EMMSA report table
+type column int
+
+const (
+	colProduct column = iota
+	colVariety
+	colMin
+	colMax
+	colAvg
+	colVolume
+)
+
+// columnNames are the names of the columns used in errors
+var columnNames = map[column]string{
+	colProduct: "product",
+	colVariety: "variety",
+	colMin:     "min price",
+	colMax:     "max price",
+	colAvg:     "average price",
+	colVolume:  "volume",
+}
+
+// headerAliases maps normalized header texts (see normalizeHeader) to columns
+var headerAliases = map[string]column{
+	"producto":  colProduct,
+	"productos": colProduct,
+	"product":   colProduct,
+
+	"variedad":   colVariety,
+	"variedades": colVariety,
+	"variety":    colVariety,
+
+	"precio min":    colMin,
+	"precio minimo": colMin,
+	"p min":         colMin,
+	"min":           colMin,
+	"minimo":        colMin,
+
+	"precio max":    colMax,
+	"precio maximo": colMax,
+	"p max":         colMax,
+	"max":           colMax,
+	"maximo":        colMax,
+
+	"precio prom":     colAvg,
+	"precio promedio": colAvg,
+	"p prom":          colAvg,
+	"prom":            colAvg,
+	"promedio":        colAvg,
+
+	"volumen":            colVolume,
+	"volumen de ingreso": colVolume,
+	"volumen ingresado":  colVolume,
+	"ingreso":            colVolume,
+}
+
+// normalizeHeader folds a header text for alias lookup: units in
+// parentheses are dropped ("VOLUMEN (TM)"), punctuation becomes spaces
+// ("P. MIN.") and case, accents and whitespace are folded ("PRECIO MÍNIMO")
+func normalizeHeader(text string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range text {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')':
+			if depth > 0 {
+				depth--
+			}
+		case depth > 0:
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+	return source.FoldName(b.String())
+}
+
+// SchemaError is returned when a report table does not have the expected
+// columns, which usually means EMMSA changed the layout of the report. No
+// rows are returned with it, since they could be misread.
+type SchemaError struct {
+	// Report is the report that was parsed
+	Report ReportType
+	// Missing are the required columns that were not found
+	Missing []string
+	// Headers are the header texts found, empty if no header was found
+	Headers []string
+}
+
+func (e *SchemaError) Error() string {
+	if len(e.Headers) == 0 {
+		return fmt.Sprintf("EMMSA %s layout changed: no table header found", e.Report)
+	}
+	return fmt.Sprintf("EMMSA %s layout changed: missing columns %s (headers: %s)",
+		e.Report, strings.Join(e.Missing, ", "), strings.Join(e.Headers, " | "))
+}
+
+// SkipReason explains why a table row was not turned into a record
+type SkipReason string
+
+const (
+	// SkipSectionRow is a single-cell row, such as a section title or the
+	// "no records" notice of an empty day
+	SkipSectionRow SkipReason = "section row"
+	// SkipTooFewCells is a row with fewer cells than the header
+	SkipTooFewCells SkipReason = "too few cells"
+	// SkipInvalidNumber is a row with a price or volume that is not a number
+	SkipInvalidNumber SkipReason = "invalid number"
+)
+
+// SkippedRow is a table row that was not turned into a record
+type SkippedRow struct {
+	// Table is the 0-based index of the table in the response
+	Table int `json:"table"`
+	// Row is the 0-based index of the row in its table
+	Row int `json:"row"`
+	// Reason is why the row was skipped
+	Reason SkipReason `json:"reason"`
+	// Cells are the trimmed cell texts of the row
+	Cells []string `json:"cells"`
+	// Errors describes the cells that could not be parsed, for rows skipped
+	// with SkipInvalidNumber
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// ParseStats reports how the rows of a report response were parsed
+type ParseStats struct {
+	// Tables is the number of tables found in the response
+	Tables int `json:"tables"`
+	// Parsed is the number of rows turned into records
+	Parsed int `json:"parsed"`
+	// Skipped lists the rows that were not turned into records
+	Skipped []SkippedRow `json:"skipped"`
+}
+
+// SkippedByReason counts the skipped rows per reason
+func (s ParseStats) SkippedByReason() map[SkipReason]int {
+	counts := make(map[SkipReason]int)
+	for _, r := range s.Skipped {
+		counts[r.Reason]++
+	}
+	return counts
+}
+
+// String summarizes the stats, e.g. "140 parsed, 2 skipped (2 invalid number)"
+func (s ParseStats) String() string {
+	if len(s.Skipped) == 0 {
+		return fmt.Sprintf("%d parsed, 0 skipped", s.Parsed)
+	}
+	counts := s.SkippedByReason()
+	reasons := make([]string, 0, len(counts))
+	for reason, n := range counts {
+		reasons = append(reasons, fmt.Sprintf("%d %s", n, reason))
+	}
+	sort.Strings(reasons)
+	return fmt.Sprintf("%d parsed, %d skipped (%s)", s.Parsed, len(s.Skipped), strings.Join(reasons, ", "))
+}
+
+// skip records a skipped row
+func (s *ParseStats) skip(row tableRow, reason SkipReason) {
+	s.Skipped = append(s.Skipped, SkippedRow{Table: row.table, Row: row.row, Reason: reason, Cells: row.cells})
+}
+
+// skipInvalid records a row skipped because of unparseable numbers
+func (s *ParseStats) skipInvalid(row tableRow, errs []FieldError) {
+	s.skip(row, SkipInvalidNumber)
+	s.Skipped[len(s.Skipped)-1].Errors = errs
+}
+
+// tableRow is a data row with the column layout of the header above it
+type tableRow struct {
+	table, row int
+	cells      []string
+	columns    map[column]int
+}
+
+// value returns the text of the given column
+func (r tableRow) value(col column) string {
+	return r.cells[r.columns[col]]
+}
+
+// tableRows returns the data rows of every table of the response, each
+// mapped to columns by the header row above it. Headers may repeat within a
+// table or differ between tables; single-cell section rows and short rows
+// are recorded in stats.
+//
+// A *SchemaError is returned if a header lacks any of the required columns,
+// or if data rows appear before any header.
+func tableRows(html []byte, report ReportType, required []column, stats *ParseStats) ([]tableRow, error) {
+	// An empty body is an empty report, not a layout change
+	if len(bytes.TrimSpace(html)) == 0 {
+		return nil, nil
+	}
+
+	// Parse the HTML document
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(html))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	tables := doc.Find("table")
+	if tables.Length() == 0 {
+		return nil, &SchemaError{Report: report, Missing: requiredNames(required)}
+	}
+
+	var rows []tableRow
+	var schemaErr *SchemaError
+	tables.Each(func(t int, table *goquery.Selection) {
+		stats.Tables++
+
+		// columns is nil until a usable header is found; headerErr is set
+		// while the last header seen is unusable
+		var columns map[column]int
+		var headerErr *SchemaError
+		width := 0
+
+		table.Find("tr").Each(func(i int, tr *goquery.Selection) {
+			// Rows of nested tables are handled with their own table
+			if !tr.Closest("table").IsSelection(table) {
+				return
+			}
+
+			cells := tr.ChildrenFiltered("th, td")
+			texts := make([]string, cells.Length())
+			cells.Each(func(j int, cell *goquery.Selection) {
+				texts[j] = strings.TrimSpace(cell.Text())
+			})
+
+			mapped, known := mapHeader(texts)
+			isHeader := known >= 2 || (cells.Length() > 0 && cells.Filter("td").Length() == 0)
+			if isHeader {
+				if known == 0 {
+					// A title row that is not a column header
+					return
+				}
+				columns, headerErr, width = mapped, nil, 0
+				if missing := missingColumns(mapped, required); len(missing) > 0 {
+					columns, headerErr = nil, &SchemaError{Report: report, Missing: missing, Headers: texts}
+				}
+				for _, idx := range columns {
+					width = max(width, idx+1)
+				}
+				return
+			}
+
+			row := tableRow{table: t, row: i, cells: texts, columns: columns}
+			switch {
+			case len(texts) <= 1:
+				stats.skip(row, SkipSectionRow)
+			case headerErr != nil:
+				schemaErr = headerErr
+			case columns == nil:
+				schemaErr = &SchemaError{Report: report, Missing: requiredNames(required)}
+			case len(texts) < width:
+				stats.skip(row, SkipTooFewCells)
+			default:
+				rows = append(rows, row)
+			}
+		})
+
+		// A header with the wrong columns is a layout change even if the
+		// table has no data rows yet
+		if headerErr != nil && schemaErr == nil {
+			schemaErr = headerErr
+		}
+	})
+
+	if schemaErr != nil {
+		return nil, schemaErr
+	}
+	return rows, nil
+}
+
+// mapHeader maps header texts to columns and returns the number of known
+// columns found. The first occurrence of a column wins.
+func mapHeader(texts []string) (map[column]int, int) {
+	columns := make(map[column]int)
+	for i, text := range texts {
+		col, ok := headerAliases[normalizeHeader(text)]
+		if !ok {
+			continue
+		}
+		if _, seen := columns[col]; !seen {
+			columns[col] = i
+		}
+	}
+	return columns, len(columns)
+}
+
+// missingColumns returns the names of the required columns not in columns
+func missingColumns(columns map[column]int, required []column) []string {
+	var missing []string
+	for _, col := range required {
+		if _, ok := columns[col]; !ok {
+			missing = append(missing, columnNames[col])
+		}
+	}
+	return missing
+}
+
+// requiredNames returns the names of the required columns
+func requiredNames(required []column) []string {
+	return missingColumns(nil, required)
+}
@@ -0,0 +1,111 @@
+package scraper
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeHeader(t *testing.T) {
+	tests := map[string]string{
+		"PRODUCTO":                "producto",
+		"  Precio  Mínimo ":       "precio minimo",
+		"P. MIN.":                 "p min",
+		"VOLUMEN (TM)":            "volumen",
+		"Precio Promedio (S/.)":   "precio promedio",
+		"PRECIO\n\t\tPROM":        "precio prom",
+		"VOLUMEN DE INGRESO (KG)": "volumen de ingreso",
+	}
+	for in, want := range tests {
+		if got := normalizeHeader(in); got != want {
+			t.Errorf("normalizeHeader(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParsePriceTableStats(t *testing.T) {
+	html, err := os.ReadFile(filepath.Join("testdata", "malformed_rows.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prices, stats, err := parsePriceTable(log.New(io.Discard, "", 0), html, fixtureDate)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if stats.Tables != 1 || stats.Parsed != len(prices) || stats.Parsed != 5 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	want := map[SkipReason]int{SkipTooFewCells: 1, SkipInvalidNumber: 1, SkipSectionRow: 1}
+	if got := stats.SkippedByReason(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SkippedByReason() = %v, want %v", got, want)
+	}
+	if got := stats.String(); got != "5 parsed, 3 skipped (1 invalid number, 1 section row, 1 too few cells)" {
+		t.Errorf("String() = %q", got)
+	}
+
+	skipped := stats.Skipped[0]
+	if skipped.Reason != SkipTooFewCells || skipped.Row != 2 || skipped.Cells[1] != "CEBOLLA BLANCA" {
+		t.Errorf("Unexpected first skipped row: %+v", skipped)
+	}
+
+	invalid := stats.Skipped[len(stats.Skipped)-1]
+	wantErrs := []FieldError{{Field: "precio_min", Text: "1.2O", Reason: "unexpected character 'O'"}}
+	if invalid.Reason != SkipInvalidNumber || !reflect.DeepEqual(invalid.Errors, wantErrs) {
+		t.Errorf("Unexpected invalid row: %+v", invalid)
+	}
+
+	// Placeholders are recorded as missing instead of dropping the row
+	for _, p := range prices {
+		if p.Product == "CHOCLO" && !reflect.DeepEqual(p.Missing, []string{"precio_min"}) {
+			t.Errorf("CHOCLO Missing = %v, want [precio_min]", p.Missing)
+		}
+	}
+}
+
+func TestParsePriceTableSchemaError(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		missing []string
+	}{
+		{
+			name:    "missing column",
+			html:    `<table><tr><th>PRODUCTO</th><th>PRECIO MIN</th><th>PRECIO MAX</th><th>PRECIO PROM</th></tr></table>`,
+			missing: []string{"variety"},
+		},
+		{
+			name:    "not a table",
+			html:    `<html><body><h1>Servicio no disponible</h1></body></html>`,
+			missing: []string{"product", "variety", "min price", "max price", "average price"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prices, _, err := parsePriceTable(log.New(io.Discard, "", 0), []byte(tt.html), fixtureDate)
+			var schemaErr *SchemaError
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("Expected a *SchemaError, got %v", err)
+			}
+			if prices != nil {
+				t.Errorf("No prices must be returned with a schema error, got %d", len(prices))
+			}
+			if schemaErr.Report != ReportDailyPrices || !reflect.DeepEqual(schemaErr.Missing, tt.missing) {
+				t.Errorf("Unexpected error: %+v", schemaErr)
+			}
+		})
+	}
+
+	t.Run("empty body", func(t *testing.T) {
+		prices, _, err := parsePriceTable(log.New(io.Discard, "", 0), []byte(" \n"), fixtureDate)
+		if err != nil || len(prices) != 0 {
+			t.Errorf("An empty body is an empty day, got %d prices and %v", len(prices), err)
+		}
+	})
+}
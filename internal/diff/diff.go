@@ -0,0 +1,239 @@
+// Package diff compares the prices of two days and reports what moved:
+// absolute and percentage changes of the min, max and average prices, and
+// the products that appeared or disappeared.
+//
+// Example:
+//
+//	report := diff.Compare(from.Prices, to.Prices)
+//	report.Sort(diff.SortByChange)
+//	diff.WriteText(os.Stdout, report)
+package diff
+
+import (
+	"cmp"
+	"math"
+	"slices"
+
+	scraper "github.com/aliasthewho/price_tracker/internal/api/emmsa"
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// Status describes how a product variety changed between the two days
+type Status string
+
+const (
+	// StatusChanged means at least one price changed
+	StatusChanged Status = "changed"
+	// StatusUnchanged means every price is the same on both days
+	StatusUnchanged Status = "unchanged"
+	// StatusNew means the variety is only quoted on the second day
+	StatusNew Status = "new"
+	// StatusGone means the variety is only quoted on the first day
+	StatusGone Status = "disappeared"
+)
+
+// Delta is the change of a single price between the two days
+type Delta struct {
+	From float64 `json:"from"`
+	To   float64 `json:"to"`
+	// Change is To - From
+	Change float64 `json:"change"`
+	// Percent is the change relative to From, nil if From is zero
+	Percent *float64 `json:"percent"`
+}
+
+// Change is the comparison of a product variety across the two days. The
+// deltas are nil for new and disappeared varieties, and when the price is
+// missing on either day.
+type Change struct {
+	Source  string `json:"source"`
+	Product string `json:"product"`
+	Variety string `json:"variety"`
+	Status  Status `json:"status"`
+	Min     *Delta `json:"min"`
+	Max     *Delta `json:"max"`
+	Avg     *Delta `json:"avg"`
+}
+
+// Report is the comparison of two days
+type Report struct {
+	// From and To are the compared days in YYYY-MM-DD format
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Changes []Change `json:"changes"`
+}
+
+// Count returns the number of changes with the given status
+func (r Report) Count(status Status) int {
+	n := 0
+	for _, c := range r.Changes {
+		if c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Without returns a copy of the report without the changes of the given statuses
+func (r Report) Without(statuses ...Status) Report {
+	out := Report{From: r.From, To: r.To}
+	for _, c := range r.Changes {
+		if !slices.Contains(statuses, c.Status) {
+			out.Changes = append(out.Changes, c)
+		}
+	}
+	return out
+}
+
+// key identifies a product variety within a day
+type key struct {
+	source, product, variety string
+}
+
+func recordKey(r source.PriceRecord) key {
+	return key{r.Source, source.FoldName(r.Product), source.FoldName(r.Variety)}
+}
+
+// Compare matches the prices of two days by source, product and variety
+// (case and accent insensitive) and computes the change of every price.
+// Changes are in the order of the second day, followed by the disappeared
+// varieties in the order of the first day. If a variety is quoted twice on
+// the same day, the first quote is used.
+func Compare(from, to []source.PriceRecord) Report {
+	var report Report
+	if len(from) > 0 {
+		report.From = from[0].Date
+	}
+	if len(to) > 0 {
+		report.To = to[0].Date
+	}
+
+	before := make(map[key]source.PriceRecord, len(from))
+	for _, r := range from {
+		if _, dup := before[recordKey(r)]; !dup {
+			before[recordKey(r)] = r
+		}
+	}
+
+	seen := make(map[key]bool, len(to))
+	for _, r := range to {
+		k := recordKey(r)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		change := Change{Source: r.Source, Product: r.Product, Variety: r.Variety}
+		prev, ok := before[k]
+		if !ok {
+			change.Status = StatusNew
+			report.Changes = append(report.Changes, change)
+			continue
+		}
+
+		change.Min = delta(prev, r, "min", prev.Min, r.Min)
+		change.Max = delta(prev, r, "max", prev.Max, r.Max)
+		change.Avg = delta(prev, r, "avg", prev.Avg, r.Avg)
+		change.Status = StatusUnchanged
+		for _, d := range []*Delta{change.Min, change.Max, change.Avg} {
+			if d != nil && d.Change != 0 {
+				change.Status = StatusChanged
+			}
+		}
+		report.Changes = append(report.Changes, change)
+	}
+
+	for _, r := range from {
+		k := recordKey(r)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		report.Changes = append(report.Changes, Change{
+			Source: r.Source, Product: r.Product, Variety: r.Variety, Status: StatusGone,
+		})
+	}
+	return report
+}
+
+// CompareDays compares two stored days
+func CompareDays(from, to storage.DailyPrices) Report {
+	report := Compare(from.Prices, to.Prices)
+	report.From, report.To = from.Date, to.Date
+	return report
+}
+
+// CompareEMMSA compares two days of prices as returned by the EMMSA scraper
+func CompareEMMSA(from, to []scraper.EMMSAPrice) Report {
+	return Compare(scraper.ToPriceRecords(from), scraper.ToPriceRecords(to))
+}
+
+// delta computes the change of a price, or returns nil if it is missing on
+// either day
+func delta(prev, cur source.PriceRecord, field string, from, to float64) *Delta {
+	if prev.IsMissing(field) || cur.IsMissing(field) {
+		return nil
+	}
+	d := &Delta{From: from, To: to, Change: round(to - from)}
+	if from != 0 {
+		pct := round((to - from) / from * 100)
+		d.Percent = &pct
+	}
+	return d
+}
+
+// round rounds to 4 decimals, hiding floating point noise such as
+// 1.35 - 1.2 = 0.15000000000000013
+func round(v float64) float64 {
+	return math.Round(v*1e4) / 1e4
+}
+
+// SortOrder is the order of the changes in a report
+type SortOrder string
+
+const (
+	// SortByChange puts the largest average price moves first, in absolute
+	// percentage, followed by new, disappeared and unchanged varieties
+	SortByChange SortOrder = "change"
+	// SortByProduct sorts by product and variety name
+	SortByProduct SortOrder = "product"
+)
+
+// statusRank orders statuses in SortByChange
+var statusRank = map[Status]int{StatusChanged: 0, StatusNew: 1, StatusGone: 2, StatusUnchanged: 3}
+
+// Sort sorts the changes in place
+func (r Report) Sort(order SortOrder) {
+	byName := func(a, b Change) int {
+		return cmp.Or(
+			cmp.Compare(source.FoldName(a.Product), source.FoldName(b.Product)),
+			cmp.Compare(source.FoldName(a.Variety), source.FoldName(b.Variety)),
+			cmp.Compare(a.Source, b.Source),
+		)
+	}
+	if order == SortByProduct {
+		slices.SortStableFunc(r.Changes, byName)
+		return
+	}
+	slices.SortStableFunc(r.Changes, func(a, b Change) int {
+		return cmp.Or(
+			cmp.Compare(statusRank[a.Status], statusRank[b.Status]),
+			cmp.Compare(magnitude(b.Avg), magnitude(a.Avg)),
+			byName(a, b),
+		)
+	})
+}
+
+// magnitude is the absolute percentage change of a delta, or its absolute
+// change when the percentage is undefined; -1 for a nil delta
+func magnitude(d *Delta) float64 {
+	switch {
+	case d == nil:
+		return -1
+	case d.Percent != nil:
+		return math.Abs(*d.Percent)
+	default:
+		return math.Abs(d.Change)
+	}
+}
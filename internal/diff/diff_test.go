@@ -0,0 +1,152 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	scraper "github.com/aliasthewho/price_tracker/internal/api/emmsa"
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/source/sourcetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testReport() Report {
+	from := []source.PriceRecord{
+		sourcetest.Price("2025-06-17", "PAPA", "PAPA BLANCA", 1.2, 1.5, 1.35),
+		sourcetest.Price("2025-06-17", "PAPA", "PAPA AMARILLA", 3, 3.4, 3.2),
+		sourcetest.Price("2025-06-17", "CEBOLLA", "CEBOLLA ROJA AREQUIPEÑA", 1.4, 1.6, 1.5),
+		sourcetest.Price("2025-06-17", "LIMON", "LIMON SUTIL", 3, 4, 3.5),
+		sourcetest.Price("2025-06-17", "HABA", "HABA VERDE", 0, 2, 0, sourcetest.Missing("min", "avg")),
+	}
+	to := []source.PriceRecord{
+		sourcetest.Price("2025-06-18", "PAPA", "PAPA BLANCA", 1.2, 1.8, 1.5),
+		sourcetest.Price("2025-06-18", "PAPA", "PAPA AMARILLA", 3, 3.4, 3.2),
+		sourcetest.Price("2025-06-18", "Cebolla", "Cebolla Roja Arequipena", 1.4, 1.6, 1.2),
+		sourcetest.Price("2025-06-18", "MANZANA", "MANZANA DELICIA", 2.8, 3.2, 3),
+		sourcetest.Price("2025-06-18", "HABA", "HABA VERDE", 1.5, 2.5, 2),
+	}
+	return Compare(from, to)
+}
+
+func find(t *testing.T, report Report, variety string) Change {
+	t.Helper()
+	for _, c := range report.Changes {
+		if source.FoldName(c.Variety) == source.FoldName(variety) {
+			return c
+		}
+	}
+	t.Fatalf("no change for %s", variety)
+	return Change{}
+}
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+	report := testReport()
+
+	assert.Equal(t, "2025-06-17", report.From)
+	assert.Equal(t, "2025-06-18", report.To)
+	require.Len(t, report.Changes, 6)
+	assert.Equal(t, 3, report.Count(StatusChanged))
+	assert.Equal(t, 1, report.Count(StatusUnchanged))
+	assert.Equal(t, 1, report.Count(StatusNew))
+	assert.Equal(t, 1, report.Count(StatusGone))
+
+	papa := find(t, report, "PAPA BLANCA")
+	assert.Equal(t, StatusChanged, papa.Status)
+	assert.Equal(t, 0.0, papa.Min.Change)
+	assert.Equal(t, 0.3, papa.Max.Change)
+	assert.Equal(t, 0.15, papa.Avg.Change)
+	require.NotNil(t, papa.Avg.Percent)
+	assert.Equal(t, 11.1111, *papa.Avg.Percent)
+
+	cebolla := find(t, report, "CEBOLLA ROJA AREQUIPEÑA")
+	assert.Equal(t, StatusChanged, cebolla.Status, "matching is case and accent insensitive")
+	assert.Equal(t, -20.0, *cebolla.Avg.Percent)
+
+	assert.Equal(t, StatusNew, find(t, report, "MANZANA DELICIA").Status)
+	gone := find(t, report, "LIMON SUTIL")
+	assert.Equal(t, StatusGone, gone.Status)
+	assert.Nil(t, gone.Avg)
+
+	haba := find(t, report, "HABA VERDE")
+	assert.Nil(t, haba.Min, "missing prices have no delta")
+	assert.Nil(t, haba.Avg)
+	assert.Equal(t, 0.5, haba.Max.Change)
+}
+
+func TestCompareEMMSA(t *testing.T) {
+	t.Parallel()
+	report := CompareEMMSA(
+		[]scraper.EMMSAPrice{{Date: "2025-06-17", Product: "PAPA", Variedad: "PAPA BLANCA", PrecioProm: 0}},
+		[]scraper.EMMSAPrice{{Date: "2025-06-18", Product: "PAPA", Variedad: "PAPA BLANCA", PrecioProm: 1.35}},
+	)
+	require.Len(t, report.Changes, 1)
+	assert.Equal(t, StatusChanged, report.Changes[0].Status)
+	assert.Nil(t, report.Changes[0].Avg.Percent, "no percentage from a zero price")
+}
+
+func TestSort(t *testing.T) {
+	t.Parallel()
+	varieties := func(r Report) []string {
+		var names []string
+		for _, c := range r.Changes {
+			names = append(names, c.Variety)
+		}
+		return names
+	}
+
+	report := testReport()
+	report.Sort(SortByChange)
+	assert.Equal(t, []string{
+		"Cebolla Roja Arequipena", "PAPA BLANCA", "HABA VERDE",
+		"MANZANA DELICIA", "LIMON SUTIL", "PAPA AMARILLA",
+	}, varieties(report))
+
+	report.Sort(SortByProduct)
+	assert.Equal(t, []string{
+		"Cebolla Roja Arequipena", "HABA VERDE", "LIMON SUTIL",
+		"MANZANA DELICIA", "PAPA AMARILLA", "PAPA BLANCA",
+	}, varieties(report))
+
+	assert.Len(t, report.Without(StatusUnchanged).Changes, 5)
+}
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+	report := testReport().Without(StatusUnchanged)
+	report.Sort(SortByProduct)
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf, report, FormatText))
+		out := buf.String()
+		assert.Contains(t, out, "STATUS")
+		assert.Contains(t, out, "1.35 → 1.50 (+0.15)")
+		assert.Contains(t, out, "+11.1%")
+		assert.Contains(t, out, "2025-06-17 → 2025-06-18: 3 changed, 1 new, 1 disappeared, 0 unchanged")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf, report, FormatJSON))
+		var decoded Report
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, report, decoded)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf, report, FormatCSV))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 6)
+		assert.Equal(t, strings.Join(csvHeader, ","), lines[0])
+		assert.Equal(t, "2025-06-17,2025-06-18,emmsa,HABA,HABA VERDE,changed,,,,,2,2.5,0.5,25,,,,", lines[2])
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		assert.Error(t, Write(&bytes.Buffer{}, report, "xml"))
+	})
+}
@@ -0,0 +1,122 @@
+package diff
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Formats supported by Write
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Write writes the report in the given format: text, json or csv
+func Write(w io.Writer, report Report, format string) error {
+	switch format {
+	case FormatText, "":
+		return WriteText(w, report)
+	case FormatJSON:
+		return WriteJSON(w, report)
+	case FormatCSV:
+		return WriteCSV(w, report)
+	default:
+		return fmt.Errorf("unknown format %q (available: text, json, csv)", format)
+	}
+}
+
+// WriteText writes the report as an aligned table followed by a summary line
+func WriteText(w io.Writer, report Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "STATUS\tPRODUCT\tVARIETY\tMIN\tMIN %%\tMAX\tMAX %%\tAVG\tAVG %%\n")
+	for _, c := range report.Changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			c.Status, c.Product, c.Variety,
+			textDelta(c.Min), textPercent(c.Min),
+			textDelta(c.Max), textPercent(c.Max),
+			textDelta(c.Avg), textPercent(c.Avg))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%s → %s: %d changed, %d new, %d disappeared, %d unchanged\n",
+		report.From, report.To, report.Count(StatusChanged), report.Count(StatusNew),
+		report.Count(StatusGone), report.Count(StatusUnchanged))
+	return err
+}
+
+// textDelta formats a delta as "1.20 → 1.35 (+0.15)"
+func textDelta(d *Delta) string {
+	if d == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f → %.2f (%+.2f)", d.From, d.To, d.Change)
+}
+
+// textPercent formats the percentage of a delta as "+12.5%"
+func textPercent(d *Delta) string {
+	if d == nil || d.Percent == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", *d.Percent)
+}
+
+// WriteJSON writes the report as indented JSON
+func WriteJSON(w io.Writer, report Report) error {
+	if report.Changes == nil {
+		report.Changes = []Change{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// csvHeader is the header row of WriteCSV
+var csvHeader = []string{
+	"from", "to", "source", "product", "variety", "status",
+	"min_from", "min_to", "min_change", "min_change_pct",
+	"max_from", "max_to", "max_change", "max_change_pct",
+	"avg_from", "avg_to", "avg_change", "avg_change_pct",
+}
+
+// WriteCSV writes the report as CSV with one row per change. Missing
+// values are empty.
+func WriteCSV(w io.Writer, report Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, c := range report.Changes {
+		row := []string{report.From, report.To, c.Source, c.Product, c.Variety, string(c.Status)}
+		for _, d := range []*Delta{c.Min, c.Max, c.Avg} {
+			row = append(row, csvDelta(d)...)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvDelta returns the from, to, change and percent columns of a delta
+func csvDelta(d *Delta) []string {
+	if d == nil {
+		return []string{"", "", "", ""}
+	}
+	pct := ""
+	if d.Percent != nil {
+		pct = formatFloat(*d.Percent)
+	}
+	return []string{formatFloat(d.From), formatFloat(d.To), formatFloat(d.Change), pct}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,71 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// csvWriter writes CSV or TSV with a header row
+type csvWriter struct {
+	cw      *csv.Writer
+	decimal rune
+	header  bool
+}
+
+func newCSVWriter(w io.Writer, comma, decimal rune) *csvWriter {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	return &csvWriter{cw: cw, decimal: decimal}
+}
+
+// writeHeader writes the header row once
+func (c *csvWriter) writeHeader() error {
+	if c.header {
+		return nil
+	}
+	c.header = true
+	return c.cw.Write(Columns)
+}
+
+func (c *csvWriter) WriteDay(day storage.DailyPrices) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	for _, p := range day.Prices {
+		row := []string{p.Date, p.Source, p.Market, p.Product, p.Variety, p.Unit, p.Currency,
+			c.price(p, "min", p.Min), c.price(p, "max", p.Max), c.price(p, "avg", p.Avg)}
+		if err := c.cw.Write(row); err != nil {
+			return err
+		}
+	}
+	// Flush every day so rows reach the output as the backfill progresses
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+// price formats a price with the decimal separator, or returns an empty
+// cell if it is missing
+func (c *csvWriter) price(p source.PriceRecord, field string, v float64) string {
+	if p.IsMissing(field) {
+		return ""
+	}
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if c.decimal != '.' {
+		s = strings.Replace(s, ".", string(c.decimal), 1)
+	}
+	return s
+}
+
+func (c *csvWriter) Close() error {
+	// An export without days still gets its header
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.cw.Flush()
+	return c.cw.Error()
+}
@@ -0,0 +1,180 @@
+// Package export writes fetched days in the formats analysts load into
+// spreadsheets, pandas or DuckDB: the JSON day document, newline-delimited
+// JSON, CSV, TSV and Parquet.
+//
+// Every tabular format has one row per price with the columns of Columns,
+// in that order. Writers stream: rows are written as days arrive, and
+// Parquet buffers at most one row group, so exporting a large backfill does
+// not hold every day in memory.
+//
+// Example:
+//
+//	w, err := export.NewWriter(os.Stdout, export.FormatCSV, export.Options{Decimal: ','})
+//	if err != nil {
+//		return err
+//	}
+//	for _, day := range days {
+//		if err := w.WriteDay(day); err != nil {
+//			return err
+//		}
+//	}
+//	return w.Close()
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// Format is an output format
+type Format string
+
+// Formats supported by NewWriter
+const (
+	// FormatJSON writes the indented day document, or an array of them
+	FormatJSON Format = "json"
+	// FormatNDJSON writes one price record per line
+	FormatNDJSON  Format = "ndjson"
+	FormatCSV     Format = "csv"
+	FormatTSV     Format = "tsv"
+	FormatParquet Format = "parquet"
+)
+
+// Formats lists every supported format
+var Formats = []Format{FormatJSON, FormatNDJSON, FormatCSV, FormatTSV, FormatParquet}
+
+// ParseFormat returns the format with the given name
+func ParseFormat(name string) (Format, error) {
+	for _, f := range Formats {
+		if strings.EqualFold(strings.TrimSpace(name), string(f)) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q (available: json, ndjson, csv, tsv, parquet)", name)
+}
+
+// Columns are the columns of the tabular formats (csv, tsv and parquet), in
+// order. Prices listed in a record's Missing field are empty (null in
+// Parquet).
+var Columns = []string{"date", "source", "market", "product", "variety", "unit", "currency", "min", "max", "avg"}
+
+// Options configures a Writer
+type Options struct {
+	// Decimal is the decimal separator of csv and tsv numbers, '.' (default)
+	// or ','. CSV fields are separated by ';' when it is ','.
+	Decimal rune
+	// Multiple is set when more than one day is written, making json write
+	// an array of day documents instead of a single document
+	Multiple bool
+}
+
+// Writer writes days in an output format
+type Writer interface {
+	// WriteDay writes the prices of a day
+	WriteDay(day storage.DailyPrices) error
+	// Close writes any buffered rows and trailer. It does not close the
+	// underlying io.Writer.
+	Close() error
+}
+
+// NewWriter returns a Writer writing the format to w
+func NewWriter(w io.Writer, format Format, opts Options) (Writer, error) {
+	if opts.Decimal == 0 {
+		opts.Decimal = '.'
+	}
+	if opts.Decimal != '.' && opts.Decimal != ',' {
+		return nil, fmt.Errorf("unsupported decimal separator %q (available: . and ,)", opts.Decimal)
+	}
+
+	switch format {
+	case FormatJSON:
+		return &jsonWriter{w: w, array: opts.Multiple}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	case FormatCSV:
+		comma := ','
+		if opts.Decimal == ',' {
+			comma = ';'
+		}
+		return newCSVWriter(w, comma, opts.Decimal), nil
+	case FormatTSV:
+		return newCSVWriter(w, '\t', opts.Decimal), nil
+	case FormatParquet:
+		return newParquetWriter(w), nil
+	}
+	return nil, fmt.Errorf("unknown format %q (available: json, ndjson, csv, tsv, parquet)", format)
+}
+
+// jsonWriter writes the indented day document, as json output always did,
+// or a streamed array of them
+type jsonWriter struct {
+	w     io.Writer
+	array bool
+	days  int
+}
+
+func (j *jsonWriter) WriteDay(day storage.DailyPrices) error {
+	if j.days > 0 && !j.array {
+		return errors.New("json output holds a single day")
+	}
+	indent := ""
+	prefix := ""
+	if j.array {
+		indent = "  "
+		prefix = "[\n  "
+		if j.days > 0 {
+			prefix = ",\n  "
+		}
+	}
+	data, err := json.MarshalIndent(day, indent, "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", day.Date, err)
+	}
+	j.days++
+
+	if _, err := io.WriteString(j.w, prefix); err != nil {
+		return err
+	}
+	if _, err := j.w.Write(data); err != nil {
+		return err
+	}
+	if !j.array {
+		_, err = io.WriteString(j.w, "\n")
+	}
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	if !j.array {
+		return nil
+	}
+	end := "\n]\n"
+	if j.days == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// ndjsonWriter writes every price record as a JSON line
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) WriteDay(day storage.DailyPrices) error {
+	for _, p := range day.Prices {
+		if err := n.enc.Encode(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDays() []storage.DailyPrices {
+	return []storage.DailyPrices{
+		{Date: "2025-06-16", Fetched: "2025-06-16T08:00:00-05:00", Prices: []source.PriceRecord{
+			{Date: "2025-06-16", Source: "emmsa", Market: "Mercado Mayorista N°2 de Frutas", Product: "PAPA", Variety: "PAPA BLANCA",
+				Unit: "kg", Currency: "PEN", Min: 1.1, Max: 1.3, Avg: 1.25},
+		}},
+		{Date: "2025-06-17", Fetched: "2025-06-17T08:00:00-05:00", Prices: []source.PriceRecord{
+			{Date: "2025-06-17", Source: "emmsa", Product: "LIMON", Variety: "LIMON SUTIL, EXTRA",
+				Unit: "kg", Currency: "PEN", Min: 2.5, Max: 3.5, Avg: 0, Missing: []string{"avg"}},
+		}},
+	}
+}
+
+// export writes the days in the format and returns the output
+func export(t *testing.T, format Format, opts Options, days ...storage.DailyPrices) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format, opts)
+	require.NoError(t, err)
+	for _, day := range days {
+		require.NoError(t, w.WriteDay(day))
+	}
+	require.NoError(t, w.Close())
+	return buf.String()
+}
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+	days := testDays()
+
+	single, err := json.MarshalIndent(days[0], "", "  ")
+	require.NoError(t, err)
+	assert.Equal(t, string(single)+"\n", export(t, FormatJSON, Options{}, days[0]))
+
+	var decoded []storage.DailyPrices
+	require.NoError(t, json.Unmarshal([]byte(export(t, FormatJSON, Options{Multiple: true}, days...)), &decoded))
+	assert.Equal(t, days, decoded)
+	assert.Equal(t, "[]\n", export(t, FormatJSON, Options{Multiple: true}))
+
+	w, err := NewWriter(&bytes.Buffer{}, FormatJSON, Options{})
+	require.NoError(t, err)
+	require.NoError(t, w.WriteDay(days[0]))
+	assert.Error(t, w.WriteDay(days[1]), "a single json document holds one day")
+}
+
+func TestNDJSON(t *testing.T) {
+	t.Parallel()
+	lines := strings.Split(strings.TrimSpace(export(t, FormatNDJSON, Options{}, testDays()...)), "\n")
+	require.Len(t, lines, 2)
+
+	var record source.PriceRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, "LIMON SUTIL, EXTRA", record.Variety)
+	assert.True(t, record.IsMissing("avg"))
+}
+
+func TestCSV(t *testing.T) {
+	t.Parallel()
+	days := testDays()
+
+	assert.Equal(t, "date,source,market,product,variety,unit,currency,min,max,avg\n"+
+		"2025-06-16,emmsa,Mercado Mayorista N°2 de Frutas,PAPA,PAPA BLANCA,kg,PEN,1.1,1.3,1.25\n"+
+		"2025-06-17,emmsa,,LIMON,\"LIMON SUTIL, EXTRA\",kg,PEN,2.5,3.5,\n",
+		export(t, FormatCSV, Options{}, days...))
+
+	assert.Equal(t, "date;source;market;product;variety;unit;currency;min;max;avg\n"+
+		"2025-06-16;emmsa;Mercado Mayorista N°2 de Frutas;PAPA;PAPA BLANCA;kg;PEN;1,1;1,3;1,25\n",
+		export(t, FormatCSV, Options{Decimal: ','}, days[0]), "decimal commas separate fields with ;")
+
+	assert.Equal(t, "date\tsource\tmarket\tproduct\tvariety\tunit\tcurrency\tmin\tmax\tavg\n"+
+		"2025-06-17\temmsa\t\tLIMON\tLIMON SUTIL, EXTRA\tkg\tPEN\t2,5\t3,5\t\n",
+		export(t, FormatTSV, Options{Decimal: ','}, days[1]))
+
+	assert.Equal(t, strings.Join(Columns, ",")+"\n", export(t, FormatCSV, Options{}), "the header is written without rows")
+}
+
+func TestNewWriter(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewWriter(&bytes.Buffer{}, "xlsx", Options{})
+	assert.ErrorContains(t, err, `unknown format "xlsx"`)
+
+	_, err = NewWriter(&bytes.Buffer{}, FormatCSV, Options{Decimal: ';'})
+	assert.ErrorContains(t, err, "unsupported decimal separator")
+
+	format, err := ParseFormat(" Parquet ")
+	require.NoError(t, err)
+	assert.Equal(t, FormatParquet, format)
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,295 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// rowGroupSize is the number of rows buffered before a row group is written
+const rowGroupSize = 50_000
+
+// parquetMagic starts and ends a Parquet file
+const parquetMagic = "PAR1"
+
+// Parquet physical types, repetitions, converted types and encodings used
+// by the writer, as numbered in parquet.thrift
+const (
+	parquetInt32     = 1
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetUTF8 = 0
+	parquetDate = 6
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+// parquetColumn is a column of the Parquet schema. text returns the value
+// of date and string columns, number the value of price columns.
+type parquetColumn struct {
+	name      string
+	kind      int32
+	converted int32
+	optional  bool
+	text      func(r source.PriceRecord) string
+	number    func(r source.PriceRecord) float64
+}
+
+// textColumn returns a required UTF8 string column
+func textColumn(name string, text func(r source.PriceRecord) string) parquetColumn {
+	return parquetColumn{name: name, kind: parquetByteArray, converted: parquetUTF8, text: text}
+}
+
+// priceColumn returns a nullable double column, null where the price is missing
+func priceColumn(name string, number func(r source.PriceRecord) float64) parquetColumn {
+	return parquetColumn{name: name, kind: parquetDouble, converted: -1, optional: true, number: number}
+}
+
+// parquetColumns follow Columns. Dates are DATE, text columns UTF8 strings
+// and prices nullable doubles.
+var parquetColumns = []parquetColumn{
+	{name: "date", kind: parquetInt32, converted: parquetDate, text: func(r source.PriceRecord) string { return r.Date }},
+	textColumn("source", func(r source.PriceRecord) string { return r.Source }),
+	textColumn("market", func(r source.PriceRecord) string { return r.Market }),
+	textColumn("product", func(r source.PriceRecord) string { return r.Product }),
+	textColumn("variety", func(r source.PriceRecord) string { return r.Variety }),
+	textColumn("unit", func(r source.PriceRecord) string { return r.Unit }),
+	textColumn("currency", func(r source.PriceRecord) string { return r.Currency }),
+	priceColumn("min", func(r source.PriceRecord) float64 { return r.Min }),
+	priceColumn("max", func(r source.PriceRecord) float64 { return r.Max }),
+	priceColumn("avg", func(r source.PriceRecord) float64 { return r.Avg }),
+}
+
+// columnChunk describes a written column chunk for the footer
+type columnChunk struct {
+	offset int64
+	size   int64
+	values int64
+}
+
+// rowGroup describes a written row group for the footer
+type rowGroup struct {
+	columns []columnChunk
+	rows    int64
+}
+
+// parquetWriter writes an uncompressed, PLAIN encoded Parquet file with one
+// data page per column chunk and a row group every groupSize rows
+type parquetWriter struct {
+	w         io.Writer
+	offset    int64
+	groupSize int
+	rows      []source.PriceRecord
+	groups    []rowGroup
+	total     int64
+}
+
+func newParquetWriter(w io.Writer) *parquetWriter {
+	return &parquetWriter{w: w, groupSize: rowGroupSize}
+}
+
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+func (p *parquetWriter) WriteDay(day storage.DailyPrices) error {
+	for _, r := range day.Prices {
+		if _, err := time.Parse(storage.DateLayout, r.Date); err != nil {
+			return fmt.Errorf("invalid date %q of %s: %w", r.Date, r.Variety, err)
+		}
+		p.rows = append(p.rows, r)
+		if len(p.rows) == p.groupSize {
+			if err := p.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group
+func (p *parquetWriter) flush() error {
+	if p.offset == 0 {
+		if err := p.write([]byte(parquetMagic)); err != nil {
+			return err
+		}
+	}
+	if len(p.rows) == 0 {
+		return nil
+	}
+
+	group := rowGroup{rows: int64(len(p.rows))}
+	for _, col := range parquetColumns {
+		body := encodeColumn(col, p.rows)
+
+		t := newThriftWriter()
+		t.i32(1, 0) // DATA_PAGE
+		t.i32(2, int32(len(body)))
+		t.i32(3, int32(len(body)))
+		t.structBegin(5)
+		t.i32(1, int32(len(p.rows)))
+		t.i32(2, parquetPlain)
+		t.i32(3, parquetRLE)
+		t.i32(4, parquetRLE)
+		t.structEnd()
+		header := t.finish()
+
+		chunk := columnChunk{offset: p.offset, size: int64(len(header) + len(body)), values: int64(len(p.rows))}
+		if err := p.write(header); err != nil {
+			return err
+		}
+		if err := p.write(body); err != nil {
+			return err
+		}
+		group.columns = append(group.columns, chunk)
+	}
+
+	p.groups = append(p.groups, group)
+	p.total += group.rows
+	p.rows = p.rows[:0]
+	return nil
+}
+
+// encodeColumn returns the data page body of a column: the definition levels
+// of optional columns followed by the PLAIN encoded non-null values
+func encodeColumn(col parquetColumn, rows []source.PriceRecord) []byte {
+	var values bytes.Buffer
+	defined := make([]bool, len(rows))
+	for i, r := range rows {
+		switch col.kind {
+		case parquetInt32:
+			// The date was validated by WriteDay
+			date, _ := time.Parse(storage.DateLayout, col.text(r))
+			values.Write(binary.LittleEndian.AppendUint32(nil, uint32(epochDays(date))))
+		case parquetByteArray:
+			s := col.text(r)
+			values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(s))))
+			values.WriteString(s)
+		case parquetDouble:
+			if r.IsMissing(col.name) {
+				continue
+			}
+			values.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(col.number(r))))
+		}
+		defined[i] = true
+	}
+	if !col.optional {
+		return values.Bytes()
+	}
+
+	levels := encodeLevels(defined)
+	body := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	body = append(body, levels...)
+	return append(body, values.Bytes()...)
+}
+
+// epochDays returns the signed number of days from 1970-01-01 to date, the
+// value of a DATE column
+func epochDays(date time.Time) int32 {
+	days := date.Unix() / 86400
+	if date.Unix()%86400 < 0 {
+		days--
+	}
+	return int32(days)
+}
+
+// encodeLevels RLE encodes definition levels of bit width 1
+func encodeLevels(defined []bool) []byte {
+	var out []byte
+	for i := 0; i < len(defined); {
+		j := i
+		for j < len(defined) && defined[j] == defined[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		if defined[i] {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+		i = j
+	}
+	return out
+}
+
+// Close writes the last row group and the footer
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+
+	t := newThriftWriter()
+	t.i32(1, 1) // version
+	t.listBegin(2, thriftStruct, len(parquetColumns)+1)
+	t.elemBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(parquetColumns)))
+	t.structEnd()
+	for _, col := range parquetColumns {
+		t.elemBegin()
+		t.i32(1, col.kind)
+		repetition := int32(parquetRequired)
+		if col.optional {
+			repetition = parquetOptional
+		}
+		t.i32(3, repetition)
+		t.binary(4, col.name)
+		if col.converted >= 0 {
+			t.i32(6, col.converted)
+		}
+		t.structEnd()
+	}
+	t.i64(3, p.total)
+	t.listBegin(4, thriftStruct, len(p.groups))
+	for _, group := range p.groups {
+		t.elemBegin()
+		t.listBegin(1, thriftStruct, len(group.columns))
+		var size int64
+		for i, chunk := range group.columns {
+			col := parquetColumns[i]
+			size += chunk.size
+			t.elemBegin()
+			t.i64(2, chunk.offset)
+			t.structBegin(3)
+			t.i32(1, col.kind)
+			t.listBegin(2, thriftI32, 2)
+			t.listI32(parquetPlain)
+			t.listI32(parquetRLE)
+			t.listBegin(3, thriftBinary, 1)
+			t.listBinary(col.name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, chunk.values)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.structEnd()
+			t.structEnd()
+		}
+		t.i64(2, size)
+		t.i64(3, group.rows)
+		t.structEnd()
+	}
+	t.binary(6, "price-tracker")
+	footer := t.finish()
+
+	if err := p.write(footer); err != nil {
+		return err
+	}
+	if err := p.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer)))); err != nil {
+		return err
+	}
+	return p.write([]byte(parquetMagic))
+}
@@ -0,0 +1,449 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/source/sourcetest"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// update regenerates the golden files: go test ./internal/export -run Golden -update
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// thriftReader decodes Thrift compact structs into maps of field id to value,
+// enough to check the footer and page headers written by parquetWriter
+type thriftReader struct {
+	t   *testing.T
+	buf []byte
+}
+
+func (r *thriftReader) varint() int64 {
+	v, n := binary.Varint(r.buf)
+	require.Positive(r.t, n)
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	require.Positive(r.t, n)
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *thriftReader) byte() byte {
+	require.NotEmpty(r.t, r.buf)
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := r.uvarint()
+		s := string(r.buf[:n])
+		r.buf = r.buf[n:]
+		return s
+	case thriftList:
+		header := r.byte()
+		n := uint64(header >> 4)
+		if n == 15 {
+			n = r.uvarint()
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return r.read()
+	}
+	r.t.Fatalf("unexpected thrift type %d", typ)
+	return nil
+}
+
+// read decodes a struct
+func (r *thriftReader) read() map[int16]any {
+	fields := make(map[int16]any)
+	var id int16
+	for {
+		header := r.byte()
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(header & 0x0f)
+	}
+}
+
+// readColumn decodes the page of a column chunk, returning its definition
+// levels and PLAIN encoded values
+func readColumn(t *testing.T, file []byte, chunk map[int16]any, optional bool) ([]byte, []byte) {
+	t.Helper()
+	meta := chunk[3].(map[int16]any)
+	offset := meta[9].(int64)
+	r := &thriftReader{t: t, buf: file[offset:]}
+	page := r.read()
+	assert.Equal(t, int64(0), page[1], "DATA_PAGE")
+	body := r.buf[:page[3].(int64)]
+	assert.Equal(t, meta[7], int64(len(file[offset:])-len(r.buf))+page[3].(int64), "chunk size")
+	if !optional {
+		return nil, body
+	}
+	n := binary.LittleEndian.Uint32(body)
+	return body[4 : 4+n], body[4+n:]
+}
+
+// readRows decodes every row group of a file written by parquetWriter and
+// returns its rows as FormatCSV writes them
+func readRows(t *testing.T, file []byte) string {
+	t.Helper()
+	size := binary.LittleEndian.Uint32(file[len(file)-8:])
+	footer := (&thriftReader{t: t, buf: file[len(file)-8-int(size) : len(file)-8]}).read()
+
+	var out bytes.Buffer
+	cw := csv.NewWriter(&out)
+	require.NoError(t, cw.Write(Columns))
+	var total int64
+	for _, group := range footer[4].([]any) {
+		group := group.(map[int16]any)
+		n := int(group[3].(int64))
+		rows := make([][]string, n)
+		for i, chunk := range group[1].([]any) {
+			col := parquetColumns[i]
+			levels, values := readColumn(t, file, chunk.(map[int16]any), col.optional)
+			defined := readLevels(t, levels, n)
+			for j := range rows {
+				cell := ""
+				switch {
+				case !defined[j]:
+				case col.kind == parquetInt32:
+					days := int32(binary.LittleEndian.Uint32(values))
+					cell = time.Unix(int64(days)*86400, 0).UTC().Format(storage.DateLayout)
+					values = values[4:]
+				case col.kind == parquetByteArray:
+					length := binary.LittleEndian.Uint32(values)
+					cell = string(values[4 : 4+length])
+					values = values[4+length:]
+				case col.kind == parquetDouble:
+					cell = strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(values)), 'f', -1, 64)
+					values = values[8:]
+				}
+				rows[j] = append(rows[j], cell)
+			}
+			assert.Empty(t, values, "%s has no values left", col.name)
+		}
+		require.NoError(t, cw.WriteAll(rows))
+		total += int64(n)
+	}
+	assert.Equal(t, total, footer[3], "num_rows")
+	cw.Flush()
+	return out.String()
+}
+
+// readLevels decodes the RLE definition levels of n values, all defined for
+// required columns
+func readLevels(t *testing.T, levels []byte, n int) []bool {
+	t.Helper()
+	defined := make([]bool, 0, n)
+	if levels == nil {
+		for range n {
+			defined = append(defined, true)
+		}
+		return defined
+	}
+	r := &thriftReader{t: t, buf: levels}
+	for len(r.buf) > 0 {
+		header := r.uvarint()
+		require.Zero(t, header&1, "only RLE runs are written")
+		value := r.byte()
+		for range header >> 1 {
+			defined = append(defined, value == 1)
+		}
+	}
+	require.Len(t, defined, n)
+	return defined
+}
+
+func TestParquet(t *testing.T) {
+	t.Parallel()
+	days := testDays()
+	file := []byte(export(t, FormatParquet, Options{}, days...))
+
+	require.Equal(t, parquetMagic, string(file[:4]))
+	require.Equal(t, parquetMagic, string(file[len(file)-4:]))
+	size := binary.LittleEndian.Uint32(file[len(file)-8:])
+	r := &thriftReader{t: t, buf: file[len(file)-8-int(size) : len(file)-8]}
+	footer := r.read()
+	assert.Empty(t, r.buf)
+
+	assert.Equal(t, int64(2), footer[3], "num_rows")
+	schema := footer[2].([]any)
+	require.Len(t, schema, len(Columns)+1)
+	for i, name := range Columns {
+		assert.Equal(t, name, schema[i+1].(map[int16]any)[4])
+	}
+	assert.Equal(t, int64(parquetDate), schema[1].(map[int16]any)[6])
+	assert.Equal(t, int64(parquetOptional), schema[10].(map[int16]any)[3])
+
+	groups := footer[4].([]any)
+	require.Len(t, groups, 1)
+	chunks := groups[0].(map[int16]any)[1].([]any)
+	require.Len(t, chunks, len(Columns))
+
+	_, dates := readColumn(t, file, chunks[0].(map[int16]any), false)
+	assert.Equal(t, uint32(20255), binary.LittleEndian.Uint32(dates), "2025-06-16 in days since the epoch")
+
+	_, varieties := readColumn(t, file, chunks[4].(map[int16]any), false)
+	assert.Equal(t, "\x0b\x00\x00\x00PAPA BLANCA\x12\x00\x00\x00LIMON SUTIL, EXTRA", string(varieties))
+
+	levels, avgs := readColumn(t, file, chunks[9].(map[int16]any), true)
+	assert.Equal(t, []byte{2, 1, 2, 0}, levels, "one defined avg then one null")
+	require.Len(t, avgs, 8)
+	assert.Equal(t, 1.25, math.Float64frombits(binary.LittleEndian.Uint64(avgs)))
+}
+
+func TestParquetRowGroups(t *testing.T) {
+	t.Parallel()
+	prices := make([]source.PriceRecord, rowGroupSize+1)
+	for i := range prices {
+		prices[i] = source.PriceRecord{Date: "2025-06-16", Source: "emmsa", Product: "PAPA", Avg: float64(i)}
+	}
+	file := []byte(export(t, FormatParquet, Options{}, storage.DailyPrices{Date: "2025-06-16", Prices: prices}))
+
+	size := binary.LittleEndian.Uint32(file[len(file)-8:])
+	footer := (&thriftReader{t: t, buf: file[len(file)-8-int(size) : len(file)-8]}).read()
+	assert.Equal(t, int64(rowGroupSize+1), footer[3])
+	groups := footer[4].([]any)
+	require.Len(t, groups, 2)
+	assert.Equal(t, int64(rowGroupSize), groups[0].(map[int16]any)[3])
+	assert.Equal(t, int64(1), groups[1].(map[int16]any)[3])
+
+	w := newParquetWriter(&bytes.Buffer{})
+	assert.Error(t, w.WriteDay(storage.DailyPrices{Prices: []source.PriceRecord{{Date: "16/06/2025"}}}))
+}
+
+// parquetCase is a file written by parquetWriter with a row group every
+// groupSize rows (rowGroupSize if zero), which has groups row groups
+type parquetCase struct {
+	name      string
+	groupSize int
+	groups    int
+	days      []storage.DailyPrices
+}
+
+// parquetCases cover nulls in every price column, rows split over several
+// row groups, dates before the Unix epoch and an export without rows
+func parquetCases() []parquetCase {
+	market := sourcetest.Market("Gran Mercado Mayorista de Lima")
+	return []parquetCase{
+		{name: "nulls", groups: 1, days: []storage.DailyPrices{
+			{Date: "2025-06-16", Prices: []source.PriceRecord{
+				sourcetest.Price("2025-06-16", "PAPA", "PAPA BLANCA", 1.05, 1.45, 1.25, sourcetest.Market("Mercado Mayorista N°2 de Frutas")),
+				sourcetest.Price("2025-06-16", "LIMON", "LIMON SUTIL, EXTRA", 2.5, 3.5, 0, market, sourcetest.Missing("avg")),
+				sourcetest.Price("2025-06-16", "HABA", "HABA VERDE", 1.8, 2.2, 2, market, sourcetest.Missing("min")),
+				sourcetest.Price("2025-06-16", "ZAPALLO", "ZAPALLO MACRE", 0.6, 1, 0.8, market, sourcetest.Missing("max")),
+				sourcetest.Price("2025-06-16", "OLLUCO", "OLLUCO", 0, 0, 0, market, sourcetest.Missing("min", "max", "avg")),
+			}},
+		}},
+		{name: "row_groups", groupSize: 2, groups: 3, days: []storage.DailyPrices{
+			{Date: "2025-06-16", Prices: []source.PriceRecord{
+				sourcetest.Price("2025-06-16", "PAPA", "PAPA BLANCA", 1.05, 1.45, 1.25, market),
+				sourcetest.Price("2025-06-16", "PAPA", "PAPA AMARILLA", 2.4, 2.8, 2.6, market),
+				sourcetest.Price("2025-06-16", "CEBOLLA", "CEBOLLA ROJA", 0.9, 1.3, 1.1, market, sourcetest.Missing("avg")),
+			}},
+			{Date: "2025-06-17", Prices: []source.PriceRecord{
+				sourcetest.Price("2025-06-17", "PAPA", "PAPA BLANCA", 1.1, 1.5, 1.3, market),
+				sourcetest.Price("2025-06-17", "PAPA", "PAPA AMARILLA", 2.35, 2.75, 2.55, market, sourcetest.Missing("min", "max")),
+			}},
+		}},
+		{name: "dates", groups: 1, days: []storage.DailyPrices{
+			{Date: "1969-12-31", Prices: []source.PriceRecord{sourcetest.Price("1969-12-31", "PAPA", "PAPA BLANCA", 0.1, 0.2, 0.15, market)}},
+			{Date: "1900-01-01", Prices: []source.PriceRecord{sourcetest.Price("1900-01-01", "PAPA", "PAPA BLANCA", 0.01, 0.02, 0.015, market)}},
+			{Date: "2100-12-31", Prices: []source.PriceRecord{sourcetest.Price("2100-12-31", "PAPA", "PAPA BLANCA", 10, 20, 15, market)}},
+		}},
+		{name: "empty"},
+	}
+}
+
+// write returns the Parquet file of the case
+func (c parquetCase) write(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newParquetWriter(&buf)
+	if c.groupSize > 0 {
+		w.groupSize = c.groupSize
+	}
+	for _, day := range c.days {
+		require.NoError(t, w.WriteDay(day))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestEpochDays(t *testing.T) {
+	t.Parallel()
+	for date, want := range map[string]int32{"1970-01-01": 0, "1970-01-02": 1, "1969-12-31": -1, "1900-01-01": -25567, "2025-06-16": 20255} {
+		day, err := time.Parse(storage.DateLayout, date)
+		require.NoError(t, err)
+		assert.Equal(t, want, epochDays(day), date)
+	}
+}
+
+// TestParquetGolden compares the writer output with the Parquet files in
+// testdata. Each <name>.parquet has a <name>.csv with its rows as written by
+// FormatCSV, which the file must decode to. TestParquetInterop reads the
+// same files with DuckDB or pyarrow.
+func TestParquetGolden(t *testing.T) {
+	t.Parallel()
+	for _, tt := range parquetCases() {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			file := tt.write(t)
+			golden := filepath.Join("testdata", tt.name)
+			rows := export(t, FormatCSV, Options{}, tt.days...)
+			if *update {
+				require.NoError(t, os.WriteFile(golden+".parquet", file, 0644))
+				require.NoError(t, os.WriteFile(golden+".csv", []byte(rows), 0644))
+			}
+			want, err := os.ReadFile(golden + ".parquet")
+			require.NoError(t, err, "run with -update to create the golden file")
+			assert.True(t, bytes.Equal(want, file), "%s.parquet does not match (run with -update if the change is expected)", golden)
+			wantRows, err := os.ReadFile(golden + ".csv")
+			require.NoError(t, err)
+			assert.Equal(t, string(wantRows), rows)
+			assert.Equal(t, string(wantRows), readRows(t, file))
+		})
+	}
+}
+
+// interop makes TestParquetInterop fail instead of skip without a reader:
+// go test ./internal/export -run Interop -interop
+var interop = flag.Bool("interop", false, "require DuckDB or pyarrow to read the Parquet output")
+
+// parquetReaders print the number of row groups of the Parquet file given as
+// their last argument, then its rows as CSV with a header, nulls as empty
+// cells and DATE columns as YYYY-MM-DD
+var parquetReaders = map[string]struct {
+	// check is a command that succeeds if the reader is installed
+	check []string
+	read  func(path string) []string
+}{
+	"duckdb": {
+		check: []string{"duckdb", "-c", "SELECT 1"},
+		read: func(path string) []string {
+			path = strings.ReplaceAll(path, "'", "''")
+			return []string{"duckdb", "-noheader", "-csv", "-c",
+				fmt.Sprintf("SELECT count(DISTINCT row_group_id) FROM parquet_metadata('%[1]s'); "+
+					"COPY (SELECT * FROM read_parquet('%[1]s')) TO '/dev/stdout' (FORMAT csv, HEADER)", path)}
+		},
+	},
+	"pyarrow": {
+		check: []string{"python3", "-c", "import pyarrow.parquet"},
+		read: func(path string) []string {
+			return []string{"python3", "-c", pyarrowReader, path}
+		},
+	},
+}
+
+// pyarrowReader is the Python program of the pyarrow reader
+const pyarrowReader = `import csv, sys
+import pyarrow.parquet as pq
+
+f = pq.ParquetFile(sys.argv[1])
+print(f.metadata.num_row_groups)
+table = f.read()
+out = csv.writer(sys.stdout, lineterminator="\n")
+out.writerow(table.column_names)
+for row in table.to_pylist():
+    out.writerow("" if v is None else v.isoformat() if hasattr(v, "isoformat") else v for v in row.values())
+`
+
+// TestParquetInterop reads the writer output with every installed
+// independent Parquet reader and checks that it gets the rows FormatCSV
+// writes. It is skipped when neither DuckDB nor pyarrow is installed, unless
+// -interop is set (make test-interop).
+func TestParquetInterop(t *testing.T) {
+	t.Parallel()
+	var readers []string
+	for name, reader := range parquetReaders {
+		if exec.Command(reader.check[0], reader.check[1:]...).Run() == nil {
+			readers = append(readers, name)
+		}
+	}
+	if len(readers) == 0 {
+		if *interop {
+			t.Fatal("-interop needs DuckDB (duckdb) or pyarrow (python3 -m pip install pyarrow)")
+		}
+		t.Skip("neither DuckDB nor pyarrow is installed, run make test-interop where one is")
+	}
+	sort.Strings(readers)
+
+	dir := t.TempDir()
+	for _, tt := range parquetCases() {
+		path := filepath.Join(dir, tt.name+".parquet")
+		require.NoError(t, os.WriteFile(path, tt.write(t), 0644))
+		want := export(t, FormatCSV, Options{}, tt.days...)
+		for _, name := range readers {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				args := parquetReaders[name].read(path)
+				out, err := exec.Command(args[0], args[1:]...).Output()
+				require.NoError(t, err, "%s failed to read %s", name, tt.name)
+				groups, rows, _ := strings.Cut(string(out), "\n")
+				assert.Equal(t, strconv.Itoa(tt.groups), strings.TrimSpace(groups), "row groups")
+				assertRows(t, want, rows)
+			})
+		}
+	}
+}
+
+// assertRows checks that the CSV rows got hold the cells of want, comparing
+// numbers by value since readers print 10 as 10.0
+func assertRows(t *testing.T, want, got string) {
+	t.Helper()
+	parse := func(text string) [][]string {
+		r := csv.NewReader(strings.NewReader(text))
+		r.FieldsPerRecord = -1
+		rows, err := r.ReadAll()
+		require.NoError(t, err, text)
+		return rows
+	}
+	wantRows, gotRows := parse(want), parse(got)
+	require.Len(t, gotRows, len(wantRows), got)
+	for i, row := range wantRows {
+		require.Len(t, gotRows[i], len(row), "row %d: %v", i, gotRows[i])
+		for j, cell := range row {
+			if gotRows[i][j] == cell {
+				continue
+			}
+			wantValue, wantErr := strconv.ParseFloat(cell, 64)
+			gotValue, gotErr := strconv.ParseFloat(gotRows[i][j], 64)
+			if wantErr != nil || gotErr != nil || wantValue != gotValue {
+				t.Errorf("row %d, %s: got %q, want %q", i, wantRows[0][j], gotRows[i][j], cell)
+			}
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package metrics
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -19,6 +22,55 @@ var (
 		Buckets: prometheus.DefBuckets,
 	}, []string{"endpoint"})
 
+	// PriceRequestAttemptsTotal counts every HTTP attempt made to a price source
+	PriceRequestAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "price_request_attempts_total",
+		Help: "Total number of HTTP attempts made to fetch prices",
+	}, []string{"status"}) // "success", "retryable_error" or "error"
+
+	// PriceRequestRetriesTotal counts the retries of failed price requests
+	PriceRequestRetriesTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "price_request_retries_total",
+		Help: "Total number of retried price requests",
+	})
+
+	// CircuitBreakerState is the state of the price source circuit breaker
+	CircuitBreakerState = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "price_circuit_breaker_state",
+		Help: "State of the price source circuit breaker (0 closed, 1 open, 2 half-open)",
+	})
+
+	// ParsedRowsTotal counts the report table rows parsed or skipped, by skip reason
+	ParsedRowsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "price_parsed_rows_total",
+		Help: "Total number of report table rows, by report and outcome (parsed or the skip reason)",
+	}, []string{"report", "outcome"})
+
+	// AlertsSentTotal counts the price alerts delivered, by rule
+	AlertsSentTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "price_alerts_sent_total",
+		Help: "Total number of price alerts delivered to at least one webhook",
+	}, []string{"rule"})
+
+	// AlertDeliveriesTotal counts the webhook requests made to deliver alerts
+	AlertDeliveriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "price_alert_deliveries_total",
+		Help: "Total number of alert webhook requests",
+	}, []string{"status"}) // "success" or "error"
+
+	// APIRequestsTotal counts the REST API requests by route and status code
+	APIRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "api_requests_total",
+		Help: "Total number of REST API requests",
+	}, []string{"route", "code"})
+
+	// APIRequestDuration tracks the duration of REST API requests
+	APIRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "api_request_duration_seconds",
+		Help:    "Duration of REST API requests in seconds",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route"})
+
 	// PantryOperationsTotal counts the total number of Pantry operations
 	PantryOperationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "pantry_operations_total",
@@ -31,6 +83,37 @@ var (
 		Help:    "Duration of Pantry operations in seconds",
 		Buckets: prometheus.DefBuckets,
 	}, []string{"operation"})
+
+	// StoreOperationsTotal counts the total number of storage backend operations
+	StoreOperationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "store_operations_total",
+		Help: "Total number of storage backend operations",
+	}, []string{"backend", "operation", "status"}) // backend: "pantry", "file", "sqlite"
+
+	// StoreOperationDuration tracks the duration of storage backend operations
+	StoreOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "store_operation_duration_seconds",
+		Help:    "Duration of storage backend operations in seconds",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"backend", "operation"})
+
+	// SchedulerRunsTotal counts the scheduled runs by outcome
+	SchedulerRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_runs_total",
+		Help: "Total number of scheduled runs",
+	}, []string{"status"}) // "success", "empty" or "error"
+
+	// SchedulerNextRun is the Unix time of the next scheduled run or retry
+	SchedulerNextRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "scheduler_next_run_timestamp_seconds",
+		Help: "Unix time of the next scheduled run or retry",
+	})
+
+	// SchedulerLastSuccess is the Unix time of the last successful scheduled run
+	SchedulerLastSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "scheduler_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful scheduled run",
+	})
 )
 
 // RecordPriceRequest records metrics for a price request
@@ -39,8 +122,69 @@ func RecordPriceRequest(status string, duration float64, endpoint string) {
 	PriceRequestDuration.WithLabelValues(endpoint).Observe(duration)
 }
 
+// RecordPriceAttempt records a single HTTP attempt to fetch prices
+func RecordPriceAttempt(status string) {
+	PriceRequestAttemptsTotal.WithLabelValues(status).Inc()
+}
+
+// RecordPriceRetry records a retry of a failed price request
+func RecordPriceRetry() {
+	PriceRequestRetriesTotal.Inc()
+}
+
+// RecordParsedRows records the rows of a parsed report table, with the
+// number of skipped rows per reason
+func RecordParsedRows(report string, parsed int, skipped map[string]int) {
+	ParsedRowsTotal.WithLabelValues(report, "parsed").Add(float64(parsed))
+	for reason, n := range skipped {
+		ParsedRowsTotal.WithLabelValues(report, reason).Add(float64(n))
+	}
+}
+
+// SetCircuitBreakerState records the current circuit breaker state
+func SetCircuitBreakerState(state int) {
+	CircuitBreakerState.Set(float64(state))
+}
+
+// RecordAlertSent records a price alert delivered for the first time
+func RecordAlertSent(rule string) {
+	AlertsSentTotal.WithLabelValues(rule).Inc()
+}
+
+// RecordAlertDelivery records a webhook request delivering alerts
+func RecordAlertDelivery(status string) {
+	AlertDeliveriesTotal.WithLabelValues(status).Inc()
+}
+
+// RecordAPIRequest records metrics for a REST API request
+func RecordAPIRequest(route string, code int, duration float64) {
+	APIRequestsTotal.WithLabelValues(route, strconv.Itoa(code)).Inc()
+	APIRequestDuration.WithLabelValues(route).Observe(duration)
+}
+
 // RecordPantryOperation records metrics for a Pantry operation
 func RecordPantryOperation(operation, status string, duration float64) {
 	PantryOperationsTotal.WithLabelValues(operation, status).Inc()
 	PantryOperationDuration.WithLabelValues(operation).Observe(duration)
 }
+
+// RecordStoreOperation records metrics for a storage backend operation
+func RecordStoreOperation(backend, operation, status string, duration float64) {
+	StoreOperationsTotal.WithLabelValues(backend, operation, status).Inc()
+	StoreOperationDuration.WithLabelValues(backend, operation).Observe(duration)
+}
+
+// RecordSchedulerRun records the outcome of a scheduled run
+func RecordSchedulerRun(status string) {
+	SchedulerRunsTotal.WithLabelValues(status).Inc()
+}
+
+// SetSchedulerNextRun records when the scheduler wakes up next
+func SetSchedulerNextRun(t time.Time) {
+	SchedulerNextRun.Set(float64(t.Unix()))
+}
+
+// SetSchedulerLastSuccess records when the scheduler last stored a day
+func SetSchedulerLastSuccess(t time.Time) {
+	SchedulerLastSuccess.Set(float64(t.Unix()))
+}
@@ -0,0 +1,63 @@
+package query
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Formats supported by Write
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+)
+
+// Write writes the result in the given format: json or csv
+func Write(w io.Writer, result Result, format string) error {
+	switch format {
+	case FormatJSON, "":
+		return WriteJSON(w, result)
+	case FormatCSV:
+		return WriteCSV(w, result)
+	default:
+		return fmt.Errorf("unknown format %q (available: json, csv)", format)
+	}
+}
+
+// WriteJSON writes the result as indented JSON. Gaps have a null value.
+func WriteJSON(w io.Writer, result Result) error {
+	if result.Series == nil {
+		result.Series = []Series{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// csvHeader is the header row of WriteCSV
+var csvHeader = []string{"source", "product", "variety", "unit", "currency", "date", "value", "days"}
+
+// WriteCSV writes the result as CSV with one row per point of every series.
+// Gaps have an empty value.
+func WriteCSV(w io.Writer, result Result) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, s := range result.Series {
+		for _, p := range s.Points {
+			value := ""
+			if p.Value != nil {
+				value = strconv.FormatFloat(*p.Value, 'f', -1, 64)
+			}
+			row := []string{s.Source, s.Product, s.Variety, s.Unit, s.Currency, p.Date, value, strconv.Itoa(p.Days)}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
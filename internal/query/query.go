@@ -0,0 +1,322 @@
+// Package query builds per-variety price time series from the days saved by
+// a storage backend, optionally aggregated by week or month.
+//
+// Every day (or week, or month) of the range has a point in every series;
+// days a variety was not quoted are gaps with a nil Value, so a chart or a
+// spreadsheet can tell them apart from a zero price.
+//
+// Example:
+//
+//	result, err := query.Run(ctx, store, query.Request{
+//		From:        from,
+//		To:          to,
+//		Filter:      source.Filter{Products: []string{"papa"}},
+//		Interval:    query.IntervalWeek,
+//		Aggregation: query.AggregateMean,
+//	})
+package query
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// Interval is the width of the points of a series
+type Interval string
+
+// Intervals supported by Request
+const (
+	IntervalDay   Interval = "day"
+	IntervalWeek  Interval = "week"
+	IntervalMonth Interval = "month"
+)
+
+// Aggregation combines the quoted days of a week or month into one value
+type Aggregation string
+
+// Aggregations supported by Request
+const (
+	AggregateMean Aggregation = "mean"
+	AggregateMin  Aggregation = "min"
+	AggregateMax  Aggregation = "max"
+	// AggregateLast takes the value of the last quoted day
+	AggregateLast Aggregation = "last"
+)
+
+// MaxRange is the longest range a Request may span, in days. Every day of
+// the range gets a point in every series, so the range bounds the memory
+// used by Build.
+const MaxRange = 3660
+
+// Request selects the prices of a query
+type Request struct {
+	// From and To are the first and last day of the range, both inclusive
+	From, To time.Time
+	// Filter selects the products and varieties; the zero value selects all
+	Filter source.Filter
+	// Field is the price read from every record: min, max or avg (default avg)
+	Field string
+	// Interval is day (default), week (starting on Monday) or month
+	Interval Interval
+	// Aggregation combines the days of a week or month: mean (default),
+	// min, max or last. It is ignored for daily series.
+	Aggregation Aggregation
+}
+
+// withDefaults fills in the default field, interval and aggregation
+func (r Request) withDefaults() Request {
+	if r.Field == "" {
+		r.Field = source.FieldAvg
+	}
+	if r.Interval == "" {
+		r.Interval = IntervalDay
+	}
+	if r.Aggregation == "" {
+		r.Aggregation = AggregateMean
+	}
+	return r
+}
+
+// Validate checks the range, field, interval and aggregation of the request
+func (r Request) Validate() error {
+	r = r.withDefaults()
+	if r.From.IsZero() || r.To.IsZero() {
+		return errors.New("query range not set")
+	}
+	if r.To.Before(r.From) {
+		return fmt.Errorf("range ends (%s) before it starts (%s)",
+			r.To.Format(storage.DateLayout), r.From.Format(storage.DateLayout))
+	}
+	if days := RangeDays(r.From, r.To); days > MaxRange {
+		return fmt.Errorf("range spans %d days (at most %d)", days, MaxRange)
+	}
+	if !source.IsPriceField(r.Field) {
+		return fmt.Errorf("unknown field %q (available: min, max, avg)", r.Field)
+	}
+	switch r.Interval {
+	case IntervalDay, IntervalWeek, IntervalMonth:
+	default:
+		return fmt.Errorf("unknown interval %q (available: day, week, month)", r.Interval)
+	}
+	switch r.Aggregation {
+	case AggregateMean, AggregateMin, AggregateMax, AggregateLast:
+	default:
+		return fmt.Errorf("unknown aggregation %q (available: mean, min, max, last)", r.Aggregation)
+	}
+	return nil
+}
+
+// RangeDays returns the number of days from from to to, both inclusive
+func RangeDays(from, to time.Time) int {
+	return int(to.Sub(from).Hours()/24) + 1
+}
+
+// Point is the value of a series on a day, week or month
+type Point struct {
+	// Date is the day, or the first day of the week or month, in YYYY-MM-DD format
+	Date string `json:"date"`
+	// Value is nil for a gap: the variety was not quoted on any day of the point
+	Value *float64 `json:"value"`
+	// Days is the number of quoted days the value was computed from
+	Days int `json:"days"`
+}
+
+// Series is the time series of a product variety
+type Series struct {
+	Source   string  `json:"source"`
+	Product  string  `json:"product"`
+	Variety  string  `json:"variety"`
+	Unit     string  `json:"unit"`
+	Currency string  `json:"currency"`
+	Points   []Point `json:"points"`
+}
+
+// Gaps returns the number of points without a value
+func (s Series) Gaps() int {
+	n := 0
+	for _, p := range s.Points {
+		if p.Value == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Result holds the series of every variety quoted in the range, sorted by
+// product, variety and source
+type Result struct {
+	From        string      `json:"from"`
+	To          string      `json:"to"`
+	Field       string      `json:"field"`
+	Interval    Interval    `json:"interval"`
+	Aggregation Aggregation `json:"aggregation,omitempty"`
+	Series      []Series    `json:"series"`
+}
+
+// Run loads the days of the range from the store and builds the series
+func Run(ctx context.Context, store storage.Store, req Request) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return Result{}, err
+	}
+	days, err := Load(ctx, store, req.From, req.To)
+	if err != nil {
+		return Result{}, err
+	}
+	return Build(days, req)
+}
+
+// Load returns the stored days between from and to, both inclusive, in
+// ascending order. Days that are not stored are left out.
+func Load(ctx context.Context, store storage.Store, from, to time.Time) ([]storage.DailyPrices, error) {
+	stored, err := store.ListDays(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored days: %w", err)
+	}
+
+	var days []storage.DailyPrices
+	for _, date := range stored {
+		if date.Before(from) || date.After(to) {
+			continue
+		}
+		day, err := store.LoadDay(ctx, date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", date.Format(storage.DateLayout), err)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// seriesKey identifies a product variety across days
+type seriesKey struct {
+	source, product, variety string
+}
+
+// Build builds the series of the request from days, which may be in any
+// order and may include days outside of the range
+func Build(days []storage.DailyPrices, req Request) (Result, error) {
+	if err := req.Validate(); err != nil {
+		return Result{}, err
+	}
+	req = req.withDefaults()
+
+	result := Result{
+		From:     req.From.Format(storage.DateLayout),
+		To:       req.To.Format(storage.DateLayout),
+		Field:    req.Field,
+		Interval: req.Interval,
+	}
+	if req.Interval != IntervalDay {
+		result.Aggregation = req.Aggregation
+	}
+
+	// Index of the point each day of the range falls into
+	buckets := make(map[string]int)
+	var points []string
+	for d := req.From; !d.After(req.To); d = d.AddDate(0, 0, 1) {
+		start := bucketStart(d, req.Interval).Format(storage.DateLayout)
+		if len(points) == 0 || points[len(points)-1] != start {
+			points = append(points, start)
+		}
+		buckets[d.Format(storage.DateLayout)] = len(points) - 1
+	}
+
+	// values[key][point] holds the quoted values of the point, in date order
+	sorted := slices.Clone(days)
+	slices.SortFunc(sorted, func(a, b storage.DailyPrices) int { return cmp.Compare(a.Date, b.Date) })
+	series := make(map[seriesKey]*Series)
+	values := make(map[seriesKey][][]float64)
+	for _, day := range sorted {
+		bucket, ok := buckets[day.Date]
+		if !ok {
+			continue
+		}
+		seen := make(map[seriesKey]bool)
+		for _, p := range req.Filter.Apply(day.Prices) {
+			key := seriesKey{p.Source, source.FoldName(p.Product), source.FoldName(p.Variety)}
+			// A variety quoted twice on the same day counts once
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			s, ok := series[key]
+			if !ok {
+				s = &Series{}
+				series[key] = s
+				values[key] = make([][]float64, len(points))
+			}
+			// Names and units of the latest day win
+			s.Source, s.Product, s.Variety = p.Source, p.Product, p.Variety
+			s.Unit, s.Currency = p.Unit, p.Currency
+			if !p.IsMissing(req.Field) {
+				values[key][bucket] = append(values[key][bucket], p.Price(req.Field))
+			}
+		}
+	}
+
+	for key, s := range series {
+		s.Points = make([]Point, len(points))
+		for i, date := range points {
+			s.Points[i] = Point{Date: date, Days: len(values[key][i])}
+			if v, ok := aggregate(values[key][i], req.Aggregation); ok {
+				s.Points[i].Value = &v
+			}
+		}
+		result.Series = append(result.Series, *s)
+	}
+	slices.SortFunc(result.Series, func(a, b Series) int {
+		return cmp.Or(
+			cmp.Compare(source.FoldName(a.Product), source.FoldName(b.Product)),
+			cmp.Compare(source.FoldName(a.Variety), source.FoldName(b.Variety)),
+			cmp.Compare(a.Source, b.Source),
+		)
+	})
+	return result, nil
+}
+
+// bucketStart returns the first day of the point the day falls into
+func bucketStart(day time.Time, interval Interval) time.Time {
+	switch interval {
+	case IntervalWeek:
+		// Weeks start on Monday
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case IntervalMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	}
+	return day
+}
+
+// aggregate combines the values of a point, or returns false if there are none
+func aggregate(values []float64, agg Aggregation) (float64, bool) {
+	if len(values) == 0 {
+		return 0, false
+	}
+	switch agg {
+	case AggregateMin:
+		return slices.Min(values), true
+	case AggregateMax:
+		return slices.Max(values), true
+	case AggregateLast:
+		return values[len(values)-1], true
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return round(sum / float64(len(values))), true
+}
+
+// round rounds to 4 decimals, hiding floating point noise in means
+func round(v float64) float64 {
+	return math.Round(v*1e4) / 1e4
+}
@@ -0,0 +1,169 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/source/sourcetest"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/aliasthewho/price_tracker/internal/storage/localfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse(storage.DateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// testDays holds two weeks of June 2025 with Sundays missing and a few
+// varieties not quoted every day
+func testDays() []storage.DailyPrices {
+	return []storage.DailyPrices{
+		{Date: "2025-06-09", Prices: []source.PriceRecord{sourcetest.Price("2025-06-09", "PAPA", "PAPA BLANCA", 0.80, 1.20, 1.0), sourcetest.Price("2025-06-09", "LIMÓN", "LIMON SUTIL", 2.80, 3.20, 3.0)}},
+		{Date: "2025-06-10", Prices: []source.PriceRecord{sourcetest.Price("2025-06-10", "PAPA", "PAPA BLANCA", 1.00, 1.40, 1.2)}},
+		{Date: "2025-06-11", Prices: []source.PriceRecord{sourcetest.Price("2025-06-11", "PAPA", "PAPA BLANCA", 1.20, 1.60, 1.4), sourcetest.Price("2025-06-11", "LIMON", "LIMON SUTIL", 3.20, 3.80, 0, sourcetest.Missing("avg"))}},
+		{Date: "2025-06-16", Prices: []source.PriceRecord{sourcetest.Price("2025-06-16", "PAPA", "PAPA BLANCA", 1.80, 2.20, 2.0), sourcetest.Price("2025-06-16", "LIMON", "LIMON SUTIL", 3.80, 4.20, 4.0)}},
+		{Date: "2025-06-02", Prices: []source.PriceRecord{sourcetest.Price("2025-06-02", "PAPA", "PAPA BLANCA", 9.70, 10.10, 9.9)}},
+	}
+}
+
+func values(s Series) []any {
+	out := make([]any, len(s.Points))
+	for i, p := range s.Points {
+		if p.Value != nil {
+			out[i] = *p.Value
+		}
+	}
+	return out
+}
+
+func TestBuildDaily(t *testing.T) {
+	t.Parallel()
+
+	result, err := Build(testDays(), Request{From: date("2025-06-09"), To: date("2025-06-12")})
+	require.NoError(t, err)
+	assert.Equal(t, "avg", result.Field)
+	assert.Equal(t, IntervalDay, result.Interval)
+	assert.Empty(t, result.Aggregation)
+	require.Len(t, result.Series, 2)
+
+	limon, papa := result.Series[0], result.Series[1]
+	assert.Equal(t, "LIMON", limon.Product, "names of the latest day win")
+	assert.Equal(t, []any{3.0, nil, nil, nil}, values(limon), "a missing avg is a gap")
+	assert.Equal(t, []int{1, 0, 0, 0}, []int{limon.Points[0].Days, limon.Points[1].Days, limon.Points[2].Days, limon.Points[3].Days})
+	assert.Equal(t, 3, limon.Gaps())
+
+	assert.Equal(t, []any{1.0, 1.2, 1.4, nil}, values(papa))
+	assert.Equal(t, "2025-06-12", papa.Points[3].Date)
+	assert.Equal(t, "kg", papa.Unit)
+}
+
+func TestBuildAggregated(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		agg  Aggregation
+		want []any
+	}{
+		{AggregateMean, []any{1.3, 2.0}},
+		{AggregateMin, []any{1.2, 2.0}},
+		{AggregateMax, []any{1.4, 2.0}},
+		{AggregateLast, []any{1.4, 2.0}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.agg), func(t *testing.T) {
+			result, err := Build(testDays(), Request{
+				From: date("2025-06-10"), To: date("2025-06-18"),
+				Filter:   source.Filter{Products: []string{"papa"}},
+				Interval: IntervalWeek, Aggregation: tt.agg,
+			})
+			require.NoError(t, err)
+			require.Len(t, result.Series, 1)
+			papa := result.Series[0]
+			assert.Equal(t, tt.want, values(papa))
+			// Weeks are labelled with their Monday, even before the range
+			assert.Equal(t, "2025-06-09", papa.Points[0].Date)
+			assert.Equal(t, 2, papa.Points[0].Days, "06-09 is outside of the range")
+		})
+	}
+
+	t.Run("month", func(t *testing.T) {
+		result, err := Build(testDays(), Request{
+			From: date("2025-05-20"), To: date("2025-06-30"), Field: source.FieldMax,
+			Interval: IntervalMonth, Aggregation: AggregateMax,
+		})
+		require.NoError(t, err)
+		require.Len(t, result.Series, 2)
+		assert.Equal(t, []any{nil, 4.2}, values(result.Series[0]))
+		assert.Equal(t, []any{nil, 10.1}, values(result.Series[1]))
+		assert.Equal(t, "2025-05-01", result.Series[1].Points[0].Date)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	from, to := date("2025-06-09"), date("2025-06-16")
+	assert.NoError(t, Request{From: from, To: to}.Validate())
+	assert.ErrorContains(t, Request{From: to, To: from}.Validate(), "before it starts")
+	assert.ErrorContains(t, Request{To: to}.Validate(), "range not set")
+	assert.ErrorContains(t, Request{From: from, To: to, Field: "median"}.Validate(), `unknown field "median"`)
+	assert.ErrorContains(t, Request{From: from, To: to, Interval: "year"}.Validate(), `unknown interval "year"`)
+	assert.ErrorContains(t, Request{From: from, To: to, Aggregation: "sum"}.Validate(), `unknown aggregation "sum"`)
+
+	assert.NoError(t, Request{From: to.AddDate(0, 0, -(MaxRange - 1)), To: to}.Validate())
+	assert.ErrorContains(t, Request{From: to.AddDate(0, 0, -MaxRange), To: to}.Validate(), "range spans 3661 days (at most 3660)")
+	huge := Request{From: time.Date(1000, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)}
+	assert.ErrorContains(t, huge.Validate(), "at most 3660")
+	_, err := Build(nil, huge)
+	assert.Error(t, err, "Build does not allocate the range")
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	store, err := localfs.New(t.TempDir())
+	require.NoError(t, err)
+	for _, day := range testDays() {
+		require.NoError(t, store.SaveDay(ctx, day))
+	}
+
+	result, err := Run(ctx, store, Request{
+		From: date("2025-06-10"), To: date("2025-06-16"),
+		Filter: source.Filter{Varieties: []string{"limon sutil"}},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Series, 1)
+	assert.Equal(t, []any{nil, nil, nil, nil, nil, nil, 4.0}, values(result.Series[0]))
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf, result, FormatJSON))
+		var decoded Result
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, result, decoded)
+		assert.Contains(t, buf.String(), `"value": null`)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, Write(&buf, result, FormatCSV))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 8)
+		assert.Equal(t, "source,product,variety,unit,currency,date,value,days", lines[0])
+		assert.Equal(t, "emmsa,LIMON,LIMON SUTIL,kg,PEN,2025-06-10,,0", lines[1])
+		assert.Equal(t, "emmsa,LIMON,LIMON SUTIL,kg,PEN,2025-06-16,4,1", lines[7])
+	})
+
+	assert.ErrorContains(t, Write(&bytes.Buffer{}, result, "xml"), `unknown format "xml"`)
+}
@@ -0,0 +1,87 @@
+// Package retry provides the exponential backoff shared by the HTTP clients
+// of the tracker. Each client decides which of its failures are transient;
+// this package only computes how long to wait between attempts and waits.
+//
+// Example:
+//
+//	for attempt := 1; ; attempt++ {
+//		err := send(ctx)
+//		if err == nil || attempt >= policy.Attempts() || !retryable(err) {
+//			return err
+//		}
+//		if err := retry.Sleep(ctx, policy.Backoff(attempt)); err != nil {
+//			return err
+//		}
+//	}
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy controls how many times a failed request is attempted and how long
+// to wait between attempts
+type Policy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	// Values below 1 are treated as 1 (no retries).
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts
+	MaxBackoff time.Duration
+	// Multiplier is the factor the delay grows by after every retry
+	Multiplier float64
+	// Jitter is the fraction of the delay that is randomized, between 0 and 1.
+	// A jitter of 0.2 waits between 80% and 100% of the computed delay.
+	Jitter float64
+}
+
+// Attempts returns MaxAttempts, or 1 if it is below 1
+func (p Policy) Attempts() int {
+	return max(p.MaxAttempts, 1)
+}
+
+// Backoff returns the delay before the retry following the given attempt (1-based)
+func (p Policy) Backoff(attempt int) time.Duration {
+	multiplier := max(p.Multiplier, 1)
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	jitter := math.Min(math.Max(p.Jitter, 0), 1)
+	delay -= delay * jitter * rand.Float64()
+	return time.Duration(delay)
+}
+
+// TransportError marks failures that happened while sending a request or
+// reading its response (connection refused or reset, timeouts, ...), as
+// opposed to errors building the request. Clients retry them.
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string { return e.Err.Error() }
+func (e *TransportError) Unwrap() error { return e.Err }
+
+// IsTransport reports whether err is or wraps a *TransportError
+func IsTransport(err error) bool {
+	var transportErr *TransportError
+	return errors.As(err, &transportErr)
+}
+
+// Sleep waits for the given duration or until ctx is cancelled
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
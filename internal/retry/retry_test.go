@@ -0,0 +1,54 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+	policy := Policy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2, Jitter: 0.5}
+
+	for attempt, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		for range 20 {
+			d := policy.Backoff(attempt)
+			if d > max || d < max/2 {
+				t.Fatalf("attempt %d: backoff %s outside [%s, %s]", attempt, d, max/2, max)
+			}
+		}
+	}
+
+	constant := Policy{InitialBackoff: time.Second}
+	assert.Equal(t, time.Second, constant.Backoff(3), "a multiplier below 1 keeps the delay")
+}
+
+func TestAttempts(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 1, Policy{}.Attempts())
+	assert.Equal(t, 1, Policy{MaxAttempts: -2}.Attempts())
+	assert.Equal(t, 4, Policy{MaxAttempts: 4}.Attempts())
+}
+
+func TestClassification(t *testing.T) {
+	t.Parallel()
+	transport := fmt.Errorf("request failed: %w", &TransportError{Err: errors.New("connection reset")})
+	assert.True(t, IsTransport(transport))
+	assert.Equal(t, "request failed: connection reset", transport.Error())
+	assert.False(t, IsTransport(errors.New("invalid URL")))
+}
+
+func TestSleep(t *testing.T) {
+	t.Parallel()
+	assert.NoError(t, Sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.ErrorIs(t, Sleep(ctx, time.Hour), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Minute)
+}
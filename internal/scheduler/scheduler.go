@@ -0,0 +1,316 @@
+// Package scheduler runs a daily job on a cron schedule, retrying days that
+// failed or came back empty later in the same day, and persists its state so
+// a restarted daemon picks up where it left off.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/metrics"
+	"github.com/robfig/cron/v3"
+)
+
+// DefaultTimezone is the timezone EMMSA publishes prices in
+const DefaultTimezone = "America/Lima"
+
+// dateLayout is the layout of the days recorded in the state file
+const dateLayout = "2006-01-02"
+
+// dailyTime matches the "HH:MM" shorthand for a job running once a day
+var dailyTime = regexp.MustCompile(`^([01]?[0-9]|2[0-3]):([0-5][0-9])$`)
+
+// ErrEmpty is returned by a Job when the source published no data for the
+// day yet. The day is retried like a failed one, but is not counted as an error.
+var ErrEmpty = errors.New("no data published")
+
+// Job fetches and stores the data of a single day
+type Job func(ctx context.Context, day time.Time) error
+
+// Schedule returns the next activation time strictly after the given time
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// ParseSchedule parses either a daily "HH:MM" time or a standard five-field
+// cron expression (e.g. "30 7 * * 1-6"), both interpreted in loc.
+func ParseSchedule(spec string, loc *time.Location) (Schedule, error) {
+	if m := dailyTime.FindStringSubmatch(spec); m != nil {
+		spec = fmt.Sprintf("%s %s * * *", m[2], m[1])
+	}
+	schedule, err := cron.ParseStandard(fmt.Sprintf("CRON_TZ=%s %s", loc.String(), spec))
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+	}
+	return schedule, nil
+}
+
+// PendingDay is a day whose job failed or came back empty and will be retried
+type PendingDay struct {
+	// Day is the day to retry in YYYY-MM-DD format
+	Day string `json:"day"`
+	// Attempts is the number of runs made so far
+	Attempts int `json:"attempts"`
+	// NextRetry is when the next attempt is due
+	NextRetry time.Time `json:"next_retry"`
+	// LastError is the error of the last attempt
+	LastError string `json:"last_error,omitempty"`
+}
+
+// State is the scheduler state persisted between runs
+type State struct {
+	// LastRun is when the job last ran, successfully or not
+	LastRun time.Time `json:"last_run"`
+	// LastSuccess is when the job last stored a day
+	LastSuccess time.Time `json:"last_success"`
+	// LastSuccessDay is the last day that was stored, in YYYY-MM-DD format
+	LastSuccessDay string `json:"last_success_day,omitempty"`
+	// Pending lists the days waiting to be retried
+	Pending []PendingDay `json:"pending,omitempty"`
+}
+
+// LoadState reads the state file. A missing file yields an empty state.
+func LoadState(path string) (State, error) {
+	var state State
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read state file: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to decode state file: %w", err)
+	}
+	return state, nil
+}
+
+// SaveState writes the state file atomically
+func SaveState(path string, state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// Config configures a Scheduler
+type Config struct {
+	// Schedule decides when the job runs for the current day
+	Schedule Schedule
+	// Location is the timezone used to decide what "today" is
+	Location *time.Location
+	// RetryInterval is the delay before a failed or empty day is retried.
+	// Retries stop at the end of the day in Location. Zero disables retries.
+	RetryInterval time.Duration
+	// StatePath is the file the state is persisted to. Empty disables persistence.
+	StatePath string
+	// Job is run for every scheduled day and retry
+	Job Job
+}
+
+// Scheduler runs a Job for the current day on a schedule.
+//
+// The zero value is not usable, use New instead.
+type Scheduler struct {
+	cfg   Config
+	state State
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+// New creates a Scheduler, loading any previously persisted state
+func New(cfg Config) (*Scheduler, error) {
+	if cfg.Schedule == nil {
+		return nil, errors.New("schedule not set")
+	}
+	if cfg.Job == nil {
+		return nil, errors.New("job not set")
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+
+	var state State
+	if cfg.StatePath != "" {
+		var err error
+		if state, err = LoadState(cfg.StatePath); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Scheduler{cfg: cfg, state: state, now: time.Now}
+	if !state.LastSuccess.IsZero() {
+		metrics.SetSchedulerLastSuccess(state.LastSuccess)
+	}
+	return s, nil
+}
+
+// State returns a copy of the current scheduler state
+func (s *Scheduler) State() State {
+	state := s.state
+	state.Pending = append([]PendingDay(nil), s.state.Pending...)
+	return state
+}
+
+// Run runs the job on schedule until ctx is cancelled. It only returns
+// ctx.Err() or an error persisting the state.
+func (s *Scheduler) Run(ctx context.Context) error {
+	nextRun := s.cfg.Schedule.Next(s.now())
+	for {
+		wake := nextRun
+		if retry, ok := s.nextRetry(); ok && retry.Before(wake) {
+			wake = retry
+		}
+		metrics.SetSchedulerNextRun(wake)
+		log.Printf("Next scheduled run at %s", wake.In(s.cfg.Location).Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		now := s.now()
+		if !now.Before(nextRun) {
+			s.runDay(ctx, s.today(now))
+			nextRun = s.cfg.Schedule.Next(now)
+		}
+		s.runDueRetries(ctx, now)
+
+		if err := s.persist(); err != nil {
+			return err
+		}
+	}
+}
+
+// RunOnce runs the job for the current day and any due retries, then persists the state
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	now := s.now()
+	s.runDay(ctx, s.today(now))
+	s.runDueRetries(ctx, now)
+	return s.persist()
+}
+
+// today returns the current day in the scheduler location as a UTC date
+func (s *Scheduler) today(now time.Time) time.Time {
+	y, m, d := now.In(s.cfg.Location).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// endOfDay returns the end of the given UTC date in the scheduler location
+func (s *Scheduler) endOfDay(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, s.cfg.Location)
+}
+
+// nextRetry returns the earliest pending retry
+func (s *Scheduler) nextRetry() (time.Time, bool) {
+	if len(s.state.Pending) == 0 {
+		return time.Time{}, false
+	}
+	return s.state.Pending[0].NextRetry, true
+}
+
+// runDueRetries retries every pending day whose retry time has come
+func (s *Scheduler) runDueRetries(ctx context.Context, now time.Time) {
+	for _, p := range s.State().Pending {
+		if p.NextRetry.After(now) {
+			continue
+		}
+		day, err := time.Parse(dateLayout, p.Day)
+		if err != nil {
+			s.removePending(p.Day)
+			continue
+		}
+		s.runDay(ctx, day)
+	}
+}
+
+// runDay runs the job for a day and updates the state with the outcome
+func (s *Scheduler) runDay(ctx context.Context, day time.Time) {
+	dayStr := day.Format(dateLayout)
+	startTime := s.now()
+	err := s.cfg.Job(ctx, day)
+	s.state.LastRun = startTime
+
+	status := "success"
+	switch {
+	case err == nil:
+		s.state.LastSuccess = s.now()
+		s.state.LastSuccessDay = dayStr
+		s.removePending(dayStr)
+		metrics.SetSchedulerLastSuccess(s.state.LastSuccess)
+		log.Printf("Scheduled run for %s succeeded", dayStr)
+	case errors.Is(err, ErrEmpty):
+		status = "empty"
+		s.schedulePending(dayStr, day, err)
+	default:
+		status = "error"
+		s.schedulePending(dayStr, day, err)
+	}
+	metrics.RecordSchedulerRun(status)
+}
+
+// schedulePending records a failed or empty day for a retry later in the day
+func (s *Scheduler) schedulePending(dayStr string, day time.Time, err error) {
+	attempts := 1
+	for _, p := range s.state.Pending {
+		if p.Day == dayStr {
+			attempts = p.Attempts + 1
+		}
+	}
+	s.removePending(dayStr)
+
+	nextRetry := s.now().Add(s.cfg.RetryInterval)
+	if s.cfg.RetryInterval <= 0 || !nextRetry.Before(s.endOfDay(day)) {
+		log.Printf("Scheduled run for %s gave up after %d attempts: %v", dayStr, attempts, err)
+		return
+	}
+
+	log.Printf("Scheduled run for %s failed (attempt %d), retrying at %s: %v",
+		dayStr, attempts, nextRetry.In(s.cfg.Location).Format(time.RFC3339), err)
+	s.state.Pending = append(s.state.Pending, PendingDay{
+		Day:       dayStr,
+		Attempts:  attempts,
+		NextRetry: nextRetry,
+		LastError: err.Error(),
+	})
+	sort.Slice(s.state.Pending, func(i, j int) bool {
+		return s.state.Pending[i].NextRetry.Before(s.state.Pending[j].NextRetry)
+	})
+}
+
+// removePending removes a day from the pending list
+func (s *Scheduler) removePending(dayStr string) {
+	pending := s.state.Pending[:0]
+	for _, p := range s.state.Pending {
+		if p.Day != dayStr {
+			pending = append(pending, p)
+		}
+	}
+	s.state.Pending = pending
+}
+
+// persist saves the state if a state path is configured
+func (s *Scheduler) persist() error {
+	if s.cfg.StatePath == "" {
+		return nil
+	}
+	return SaveState(s.cfg.StatePath, s.state)
+}
@@ -0,0 +1,136 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lima(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(DefaultTimezone)
+	require.NoError(t, err)
+	return loc
+}
+
+func TestParseSchedule(t *testing.T) {
+	t.Parallel()
+	loc := lima(t)
+	from := time.Date(2025, 6, 18, 6, 0, 0, 0, loc)
+
+	tests := []struct {
+		name string
+		spec string
+		want time.Time
+		err  bool
+	}{
+		{name: "daily time", spec: "07:30", want: time.Date(2025, 6, 18, 7, 30, 0, 0, loc)},
+		{name: "daily time already passed", spec: "5:00", want: time.Date(2025, 6, 19, 5, 0, 0, 0, loc)},
+		{name: "cron expression", spec: "0 9 * * 1-6", want: time.Date(2025, 6, 18, 9, 0, 0, 0, loc)},
+		{name: "cron skips sunday", spec: "0 5 * * 1-6", want: time.Date(2025, 6, 19, 5, 0, 0, 0, loc)},
+		{name: "invalid", spec: "25:00", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.spec, loc)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(schedule.Next(from)), "got %s", schedule.Next(from))
+		})
+	}
+}
+
+func TestSchedulerRetries(t *testing.T) {
+	t.Parallel()
+	loc := lima(t)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	now := time.Date(2025, 6, 18, 7, 0, 0, 0, loc)
+
+	// The job comes back empty twice, then succeeds
+	var calls []time.Time
+	results := []error{ErrEmpty, errors.New("status 502"), nil}
+	job := func(ctx context.Context, day time.Time) error {
+		calls = append(calls, day)
+		err := results[0]
+		results = results[1:]
+		return err
+	}
+
+	schedule, err := ParseSchedule("07:00", loc)
+	require.NoError(t, err)
+	s, err := New(Config{
+		Schedule:      schedule,
+		Location:      loc,
+		RetryInterval: time.Hour,
+		StatePath:     statePath,
+		Job:           job,
+	})
+	require.NoError(t, err)
+	s.now = func() time.Time { return now }
+
+	// First run is empty and schedules a retry an hour later
+	require.NoError(t, s.RunOnce(context.Background()))
+	state := s.State()
+	require.Len(t, state.Pending, 1)
+	assert.Equal(t, "2025-06-18", state.Pending[0].Day)
+	assert.Equal(t, 1, state.Pending[0].Attempts)
+	assert.True(t, now.Add(time.Hour).Equal(state.Pending[0].NextRetry))
+
+	// Retries are not due yet
+	s.runDueRetries(context.Background(), now.Add(30*time.Minute))
+	assert.Len(t, calls, 1)
+
+	// The first retry fails
+	now = now.Add(time.Hour)
+	s.runDueRetries(context.Background(), now)
+	state = s.State()
+	require.Len(t, state.Pending, 1)
+	assert.Equal(t, 2, state.Pending[0].Attempts)
+	assert.Equal(t, "status 502", state.Pending[0].LastError)
+
+	// The second retry succeeds and clears the pending day
+	now = now.Add(time.Hour)
+	s.runDueRetries(context.Background(), now)
+	require.NoError(t, s.persist())
+	assert.Len(t, calls, 3)
+
+	persisted, err := LoadState(statePath)
+	require.NoError(t, err)
+	assert.Empty(t, persisted.Pending)
+	assert.Equal(t, "2025-06-18", persisted.LastSuccessDay)
+	assert.True(t, now.Equal(persisted.LastSuccess))
+
+	// A new scheduler picks up the persisted state
+	restarted, err := New(Config{Schedule: schedule, Location: loc, StatePath: statePath, Job: job})
+	require.NoError(t, err)
+	assert.Equal(t, "2025-06-18", restarted.State().LastSuccessDay)
+}
+
+func TestSchedulerGivesUpAtEndOfDay(t *testing.T) {
+	t.Parallel()
+	loc := lima(t)
+	now := time.Date(2025, 6, 18, 23, 30, 0, 0, loc)
+
+	schedule, err := ParseSchedule("07:00", loc)
+	require.NoError(t, err)
+	s, err := New(Config{
+		Schedule:      schedule,
+		Location:      loc,
+		RetryInterval: time.Hour,
+		Job:           func(ctx context.Context, day time.Time) error { return ErrEmpty },
+	})
+	require.NoError(t, err)
+	s.now = func() time.Time { return now }
+
+	require.NoError(t, s.RunOnce(context.Background()))
+	assert.Empty(t, s.State().Pending, "a retry after midnight must not be scheduled")
+}
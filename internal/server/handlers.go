@@ -0,0 +1,183 @@
+package server
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/query"
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// scrapeTimeout bounds an on-demand scrape, which keeps running when the
+// client disconnects
+const scrapeTimeout = 5 * time.Minute
+
+// pricesResponse is the body of GET /prices
+type pricesResponse struct {
+	Date    string `json:"date"`
+	Fetched string `json:"fetched"`
+	Page[source.PriceRecord]
+}
+
+// Product is an item of GET /products
+type Product struct {
+	Name string `json:"name"`
+	// Varieties are the varieties quoted in the range, sorted by name
+	Varieties []string `json:"varieties"`
+	// LastDate is the last day the product was quoted, in YYYY-MM-DD format
+	LastDate string `json:"last_date"`
+}
+
+// filterParams returns the filter of the repeatable product and variety
+// query parameters
+func filterParams(r *http.Request) source.Filter {
+	q := r.URL.Query()
+	return source.Filter{Products: q["product"], Varieties: q["variety"]}
+}
+
+// handlePrices serves the prices of the day given by ?date=, or of the
+// latest stored day
+func (s *Server) handlePrices(w http.ResponseWriter, r *http.Request) error {
+	date, err := dateParam(r, "date", time.Time{})
+	if err != nil {
+		return err
+	}
+	if date.IsZero() {
+		days, err := s.cfg.Store.ListDays(r.Context())
+		if err != nil {
+			return err
+		}
+		if len(days) == 0 {
+			return errorf(http.StatusNotFound, "no day stored yet")
+		}
+		date = days[len(days)-1]
+	}
+
+	day, err := s.cfg.Store.LoadDay(r.Context(), date)
+	if errors.Is(err, storage.ErrNotFound) {
+		return errorf(http.StatusNotFound, "no prices stored for %s", date.Format(storage.DateLayout))
+	}
+	if err != nil {
+		return err
+	}
+
+	page, err := paginate(r, filterParams(r).Apply(day.Prices))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, http.StatusOK, pricesResponse{Date: day.Date, Fetched: day.Fetched, Page: page})
+}
+
+// handleProducts serves the products quoted between ?from= and ?to=
+func (s *Server) handleProducts(w http.ResponseWriter, r *http.Request) error {
+	from, to, err := s.rangeParams(r)
+	if err != nil {
+		return err
+	}
+	days, err := query.Load(r.Context(), s.cfg.Store, from, to)
+	if err != nil {
+		return err
+	}
+
+	products := make(map[string]*Product)
+	varieties := make(map[string]map[string]string)
+	for _, day := range days {
+		for _, p := range day.Prices {
+			key := source.FoldName(p.Product)
+			product, ok := products[key]
+			if !ok {
+				product = &Product{}
+				products[key] = product
+				varieties[key] = make(map[string]string)
+			}
+			// Days are in ascending order, so the latest spelling wins
+			product.Name, product.LastDate = p.Product, day.Date
+			varieties[key][source.FoldName(p.Variety)] = p.Variety
+		}
+	}
+
+	list := make([]Product, 0, len(products))
+	for key, product := range products {
+		for _, name := range varieties[key] {
+			product.Varieties = append(product.Varieties, name)
+		}
+		slices.Sort(product.Varieties)
+		list = append(list, *product)
+	}
+	slices.SortFunc(list, func(a, b Product) int {
+		return cmp.Compare(source.FoldName(a.Name), source.FoldName(b.Name))
+	})
+
+	page, err := paginate(r, list)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, r, http.StatusOK, page)
+}
+
+// handleHistory serves the time series of a product between ?from= and
+// ?to=, with the field, interval, agg and variety parameters of the query
+// package
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) error {
+	name := r.PathValue("name")
+	from, to, err := s.rangeParams(r)
+	if err != nil {
+		return err
+	}
+
+	q := r.URL.Query()
+	req := query.Request{
+		From:        from,
+		To:          to,
+		Filter:      source.Filter{Products: []string{name}, Varieties: q["variety"]},
+		Field:       q.Get("field"),
+		Interval:    query.Interval(q.Get("interval")),
+		Aggregation: query.Aggregation(q.Get("agg")),
+	}
+	if err := req.Validate(); err != nil {
+		return errorf(http.StatusBadRequest, "%v", err)
+	}
+
+	result, err := query.Run(r.Context(), s.cfg.Store, req)
+	if err != nil {
+		return err
+	}
+	if len(result.Series) == 0 {
+		return errorf(http.StatusNotFound, "no prices of %q stored between %s and %s", name, result.From, result.To)
+	}
+	return writeJSON(w, r, http.StatusOK, result)
+}
+
+// handleScrape fetches and stores the day given by ?date= (default today).
+// Only one scrape runs at a time.
+func (s *Server) handleScrape(w http.ResponseWriter, r *http.Request) error {
+	if s.cfg.Scrape == nil {
+		return errorf(http.StatusNotImplemented, "on-demand scrapes are disabled")
+	}
+	today := s.today()
+	date, err := dateParam(r, "date", today)
+	if err != nil {
+		return err
+	}
+	if date.After(today) {
+		return errorf(http.StatusBadRequest, "date %s is in the future", date.Format(storage.DateLayout))
+	}
+
+	if !s.scraping.TryLock() {
+		return errorf(http.StatusConflict, "a scrape is already running")
+	}
+	defer s.scraping.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), scrapeTimeout)
+	defer cancel()
+	result, err := s.cfg.Scrape(ctx, date)
+	if err != nil {
+		return errorf(http.StatusBadGateway, "scrape failed: %v", err)
+	}
+	return writeJSON(w, r, http.StatusOK, result)
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/query"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// Pagination limits of list responses
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// apiError is an error returned to the client with an HTTP status
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// errorf returns an apiError with the status and a formatted message
+func errorf(status int, format string, args ...any) error {
+	return &apiError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+// errorBody is the JSON body of error responses
+type errorBody struct {
+	Error struct {
+		Status  int    `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// writeError writes err as a JSON error. Errors that are not an apiError
+// are logged and reported as a 500 without details.
+func writeError(w http.ResponseWriter, err error) {
+	var body errorBody
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		body.Error.Status, body.Error.Message = apiErr.status, apiErr.message
+	} else {
+		log.Printf("API error: %v", err)
+		body.Error.Status, body.Error.Message = http.StatusInternalServerError, "internal server error"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(body.Error.Status)
+	_ = json.NewEncoder(w).Encode(body) // the status is already sent
+}
+
+// writeJSON writes v as JSON. GET responses carry an ETag computed from the
+// body, and a request whose If-None-Match matches it gets a 304 without body.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	// Keep the & of next page URLs readable
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to marshal response: %w", err)
+	}
+	body := buf.Bytes()
+
+	if r.Method == http.MethodGet {
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err := w.Write(body)
+	return err
+}
+
+// etagMatches reports whether an If-None-Match header matches the ETag,
+// using the weak comparison required for If-None-Match
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Page is a page of a list response
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// Total is the number of items across all pages
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	// Next is the URL of the next page, empty on the last page
+	Next string `json:"next,omitempty"`
+}
+
+// pageParams parses the limit and offset query parameters
+func pageParams(r *http.Request) (limit, offset int, err error) {
+	limit, offset = DefaultLimit, 0
+	q := r.URL.Query()
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return 0, 0, errorf(http.StatusBadRequest, "limit must be between 1 and %d", MaxLimit)
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errorf(http.StatusBadRequest, "offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+// paginate returns the page of items selected by the request's limit and offset
+func paginate[T any](r *http.Request, items []T) (Page[T], error) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	page := Page[T]{Items: []T{}, Total: len(items), Limit: limit, Offset: offset}
+	if offset < len(items) {
+		page.Items = items[offset:min(offset+limit, len(items))]
+	}
+	// offset+limit would overflow for offsets near math.MaxInt
+	if offset < len(items)-limit {
+		q := r.URL.Query()
+		q.Set("offset", strconv.Itoa(offset+limit))
+		q.Set("limit", strconv.Itoa(limit))
+		page.Next = r.URL.EscapedPath() + "?" + q.Encode()
+	}
+	return page, nil
+}
+
+// dateParam parses a YYYY-MM-DD query parameter, returning def if it is unset
+func dateParam(r *http.Request, name string, def time.Time) (time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	date, err := time.Parse(storage.DateLayout, v)
+	if err != nil {
+		return time.Time{}, errorf(http.StatusBadRequest, "invalid %s %q, expected YYYY-MM-DD", name, v)
+	}
+	return date, nil
+}
+
+// rangeParams parses the from and to query parameters, defaulting to the
+// DefaultRange days ending today. Ranges over MaxRange days are rejected.
+func (s *Server) rangeParams(r *http.Request) (time.Time, time.Time, error) {
+	to, err := dateParam(r, "to", s.today())
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	from, err := dateParam(r, "from", to.AddDate(0, 0, -(DefaultRange-1)))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errorf(http.StatusBadRequest, "to (%s) is before from (%s)",
+			to.Format(storage.DateLayout), from.Format(storage.DateLayout))
+	}
+	if days := query.RangeDays(from, to); days > MaxRange {
+		return time.Time{}, time.Time{}, errorf(http.StatusBadRequest, "range spans %d days (at most %d)", days, MaxRange)
+	}
+	return from, to, nil
+}
@@ -0,0 +1,136 @@
+// Package server implements the REST API serving the prices saved by a
+// storage backend to dashboards and other internal consumers.
+//
+// Routes:
+//
+//	GET  /prices?date=                   prices of a stored day (default: the latest)
+//	GET  /products?from=&to=             products quoted in a range (default: the last 30 days)
+//	GET  /products/{name}/history?from=&to=  time series of a product
+//	POST /scrape?date=                   fetch and store a day on demand
+//
+// Every response is JSON. Lists are paginated with limit and offset, GET
+// responses carry an ETag honoured through If-None-Match, and errors are
+// returned as {"error": {"status": 404, "message": "..."}}.
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/metrics"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// DefaultRange is the number of days listed by /products and
+// /products/{name}/history when no range is given
+const DefaultRange = 30
+
+// MaxRange is the longest range, in days, accepted by /products and
+// /products/{name}/history. Both load every stored day of the range on each
+// request, which takes minutes behind the Pantry rate limit, so the API
+// allows a year rather than the query.MaxRange of the query subcommand.
+const MaxRange = 366
+
+// ScrapeResult is the outcome of an on-demand scrape
+type ScrapeResult struct {
+	// Date is the fetched day in YYYY-MM-DD format
+	Date string `json:"date"`
+	// Status is "stored", or "empty" when the source published nothing and
+	// the day was not saved
+	Status string `json:"status"`
+	// Records is the number of prices and volumes stored
+	Records int `json:"records"`
+}
+
+// ScrapeFunc fetches and stores a day, as run by POST /scrape
+type ScrapeFunc func(ctx context.Context, date time.Time) (ScrapeResult, error)
+
+// Config configures a Server
+type Config struct {
+	// Store holds the served days; required
+	Store storage.Store
+	// Scrape runs on-demand scrapes. Nil disables POST /scrape.
+	Scrape ScrapeFunc
+	// Location decides what "today" is (default UTC)
+	Location *time.Location
+	// Now returns the current time (default time.Now)
+	Now func() time.Time
+}
+
+// Server serves the REST API.
+//
+// The zero value is not usable, use New instead.
+type Server struct {
+	cfg Config
+	mux *http.ServeMux
+	// scraping is held while an on-demand scrape runs
+	scraping sync.Mutex
+}
+
+// New returns a Server for the configuration
+func New(cfg Config) (*Server, error) {
+	if cfg.Store == nil {
+		return nil, errors.New("the API needs a storage backend")
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	s := &Server{cfg: cfg, mux: http.NewServeMux()}
+	s.handle("GET /prices", s.handlePrices)
+	s.handle("GET /products", s.handleProducts)
+	s.handle("GET /products/{name}/history", s.handleHistory)
+	s.handle("POST /scrape", s.handleScrape)
+	return s, nil
+}
+
+// Register adds the API routes to mux, next to other handlers such as the
+// metrics endpoint
+func (s *Server) Register(mux *http.ServeMux) {
+	for _, pattern := range []string{"/prices", "/products", "/products/", "/scrape"} {
+		mux.Handle(pattern, s)
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handlerFunc is an API handler; a returned error is written as the response
+type handlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// handle registers a handler that records request metrics and writes errors
+func (s *Server) handle(pattern string, h handlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		if err := h(rec, r); err != nil {
+			writeError(rec, err)
+		}
+		metrics.RecordAPIRequest(pattern, rec.status, time.Since(startTime).Seconds())
+	})
+}
+
+// today returns the current day in the configured location
+func (s *Server) today() time.Time {
+	now := s.cfg.Now().In(s.cfg.Location)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
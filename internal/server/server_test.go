@@ -0,0 +1,277 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/query"
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/source/sourcetest"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/aliasthewho/price_tracker/internal/storage/localfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestServer serves two stored days, with the clock on 2025-06-18
+func newTestServer(t *testing.T, scrape ScrapeFunc) (*httptest.Server, storage.Store) {
+	t.Helper()
+	ctx := context.Background()
+	store, err := localfs.New(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, store.SaveDay(ctx, storage.DailyPrices{Date: "2025-06-16", Fetched: "2025-06-16T08:00:00-05:00", Prices: []source.PriceRecord{
+		sourcetest.Price("2025-06-16", "PAPA", "PAPA BLANCA", 1.00, 1.40, 1.2),
+		sourcetest.Price("2025-06-16", "LIMÓN", "LIMON SUTIL", 2.80, 3.20, 3.0),
+	}}))
+	require.NoError(t, store.SaveDay(ctx, storage.DailyPrices{Date: "2025-06-17", Fetched: "2025-06-17T08:00:00-05:00", Prices: []source.PriceRecord{
+		sourcetest.Price("2025-06-17", "PAPA", "PAPA BLANCA", 1.20, 1.60, 1.4),
+		sourcetest.Price("2025-06-17", "PAPA", "PAPA AMARILLA", 3.00, 3.40, 3.2),
+		sourcetest.Price("2025-06-17", "LIMON", "LIMON SUTIL", 3.30, 3.70, 3.5),
+		sourcetest.Price("2025-06-17", "CEBOLLA", "CEBOLLA ROJA", 1.30, 1.70, 1.5),
+	}}))
+
+	srv, err := New(Config{
+		Store:  store,
+		Scrape: scrape,
+		Now:    func() time.Time { return time.Date(2025, 6, 18, 12, 0, 0, 0, time.UTC) },
+	})
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	srv.Register(mux)
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts, store
+}
+
+// get requests the path and decodes the JSON body into v
+func get(t *testing.T, ts *httptest.Server, path string, v any) *http.Response {
+	t.Helper()
+	resp, err := http.Get(ts.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if v != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp
+}
+
+func TestPrices(t *testing.T) {
+	t.Parallel()
+	ts, _ := newTestServer(t, nil)
+
+	t.Run("Latest day", func(t *testing.T) {
+		var body pricesResponse
+		resp := get(t, ts, "/prices", &body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "2025-06-17", body.Date)
+		assert.Equal(t, 4, body.Total)
+		assert.Len(t, body.Items, 4)
+		assert.Empty(t, body.Next)
+	})
+
+	t.Run("Pagination and filter", func(t *testing.T) {
+		var body pricesResponse
+		get(t, ts, "/prices?date=2025-06-17&product=papa&limit=1", &body)
+		assert.Equal(t, 2, body.Total)
+		require.Len(t, body.Items, 1)
+		assert.Equal(t, "PAPA BLANCA", body.Items[0].Variety)
+		assert.Equal(t, "/prices?date=2025-06-17&limit=1&offset=1&product=papa", body.Next)
+
+		var next pricesResponse
+		get(t, ts, body.Next, &next)
+		require.Len(t, next.Items, 1)
+		assert.Equal(t, "PAPA AMARILLA", next.Items[0].Variety)
+		assert.Empty(t, next.Next)
+
+		var past pricesResponse
+		resp := get(t, ts, "/prices?date=2025-06-17&offset=9223372036854775807", &past)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, past.Items)
+		assert.Empty(t, past.Next, "no next page past the end")
+	})
+
+	t.Run("ETag", func(t *testing.T) {
+		resp := get(t, ts, "/prices?date=2025-06-16", nil)
+		etag := resp.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/prices?date=2025-06-16", nil)
+		require.NoError(t, err)
+		req.Header.Set("If-None-Match", "W/"+etag)
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+		other := get(t, ts, "/prices?date=2025-06-17", nil)
+		assert.NotEqual(t, etag, other.Header.Get("ETag"))
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		tests := []struct {
+			path    string
+			status  int
+			message string
+		}{
+			{"/prices?date=2025-06-15", http.StatusNotFound, "no prices stored for 2025-06-15"},
+			{"/prices?date=17/06/2025", http.StatusBadRequest, `invalid date "17/06/2025"`},
+			{"/prices?limit=5000", http.StatusBadRequest, "limit must be between 1 and 1000"},
+			{"/prices?offset=-1", http.StatusBadRequest, "offset must be a non-negative integer"},
+		}
+		for _, tt := range tests {
+			var body errorBody
+			resp := get(t, ts, tt.path, &body)
+			assert.Equal(t, tt.status, resp.StatusCode, tt.path)
+			assert.Equal(t, tt.status, body.Error.Status, tt.path)
+			assert.Contains(t, body.Error.Message, tt.message, tt.path)
+		}
+
+		resp, err := http.Post(ts.URL+"/prices", "application/json", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+}
+
+func TestProducts(t *testing.T) {
+	t.Parallel()
+	ts, _ := newTestServer(t, nil)
+
+	var page Page[Product]
+	resp := get(t, ts, "/products", &page)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []Product{
+		{Name: "CEBOLLA", Varieties: []string{"CEBOLLA ROJA"}, LastDate: "2025-06-17"},
+		{Name: "LIMON", Varieties: []string{"LIMON SUTIL"}, LastDate: "2025-06-17"},
+		{Name: "PAPA", Varieties: []string{"PAPA AMARILLA", "PAPA BLANCA"}, LastDate: "2025-06-17"},
+	}, page.Items)
+
+	get(t, ts, "/products?from=2025-06-01&to=2025-06-16", &page)
+	assert.Equal(t, 2, page.Total)
+	assert.Equal(t, "LIMÓN", page.Items[0].Name)
+
+	var body errorBody
+	resp = get(t, ts, "/products?from=2025-06-17&to=2025-06-16", &body)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = get(t, ts, "/products?from=0001-01-01&to=9999-12-31", &body)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body.Error.Message, "at most 366)")
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+	ts, _ := newTestServer(t, nil)
+
+	var result query.Result
+	resp := get(t, ts, "/products/Papa/history?from=2025-06-16&to=2025-06-18&variety=papa%20blanca", &result)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, result.Series, 1)
+	points := result.Series[0].Points
+	require.Len(t, points, 3)
+	assert.Equal(t, 1.2, *points[0].Value)
+	assert.Equal(t, 1.4, *points[1].Value)
+	assert.Nil(t, points[2].Value, "2025-06-18 is not stored")
+
+	get(t, ts, "/products/lim%C3%B3n/history", &result)
+	require.Len(t, result.Series, 1)
+	assert.Equal(t, "2025-05-20", result.From, "the default range is the last 30 days")
+
+	var body errorBody
+	resp = get(t, ts, "/products/mango/history", &body)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Contains(t, body.Error.Message, `no prices of "mango"`)
+
+	resp = get(t, ts, "/products/papa/history?interval=year", &body)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body.Error.Message, `unknown interval "year"`)
+
+	resp = get(t, ts, "/products/papa/history?from=0001-01-01&to=9999-12-31", &body)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body.Error.Message, "at most 366)")
+
+	resp = get(t, ts, "/products/papa/history?from=2024-06-17&to=2025-06-18", &body)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, body.Error.Message, "range spans 367 days (at most 366)")
+
+	resp = get(t, ts, "/products/papa/history?from=2024-06-18&to=2025-06-18", &result)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "a year is accepted")
+}
+
+func TestScrape(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Disabled", func(t *testing.T) {
+		ts, _ := newTestServer(t, nil)
+		resp, err := http.Post(ts.URL+"/scrape", "", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	})
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	var mu sync.Mutex
+	var scraped []time.Time
+	scrape := func(ctx context.Context, date time.Time) (ScrapeResult, error) {
+		mu.Lock()
+		scraped = append(scraped, date)
+		mu.Unlock()
+		if date.Day() == 1 {
+			return ScrapeResult{}, errors.New("status 503")
+		}
+		started <- struct{}{}
+		<-release
+		return ScrapeResult{Date: date.Format(storage.DateLayout), Status: "stored", Records: 3}, nil
+	}
+	ts, _ := newTestServer(t, scrape)
+
+	post := func(path string) (*http.Response, string) {
+		resp, err := http.Post(ts.URL+path, "", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	done := make(chan *http.Response)
+	go func() {
+		resp, _ := post("/scrape")
+		done <- resp
+	}()
+	<-started
+
+	resp, body := post("/scrape?date=2025-06-17")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Contains(t, body, "a scrape is already running")
+
+	close(release)
+	resp = <-done
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("ETag"))
+	mu.Lock()
+	assert.Equal(t, "2025-06-18", scraped[0].Format(storage.DateLayout), "defaults to today")
+	mu.Unlock()
+
+	resp, body = post("/scrape?date=2025-06-01")
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Contains(t, body, "scrape failed: status 503")
+
+	resp, _ = post("/scrape?date=2025-06-19")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	_, err := New(Config{})
+	assert.Error(t, err)
+}
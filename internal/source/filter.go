@@ -0,0 +1,100 @@
+package source
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Filter selects price records by product and variety name.
+//
+// Names are matched case- and accent-insensitively ("cebolla" matches
+// "CEBOLLA", "arequipena" matches "AREQUIPEÑA") and surrounding or repeated
+// whitespace is ignored. A record matches if its product equals any of
+// Products and its variety equals any of Varieties; an empty list matches
+// everything, so the zero Filter keeps all records.
+type Filter struct {
+	// Products are the product names to keep
+	Products []string
+	// Varieties are the variety names to keep
+	Varieties []string
+}
+
+// IsZero reports whether the filter keeps every record
+func (f Filter) IsZero() bool {
+	return len(f.Products) == 0 && len(f.Varieties) == 0
+}
+
+// Match reports whether a product and variety pass the filter
+func (f Filter) Match(product, variety string) bool {
+	return matchAny(f.Products, product) && matchAny(f.Varieties, variety)
+}
+
+// Apply returns the records that pass the filter. The zero Filter returns
+// records unchanged.
+func (f Filter) Apply(records []PriceRecord) []PriceRecord {
+	if f.IsZero() {
+		return records
+	}
+	kept := make([]PriceRecord, 0, len(records))
+	for _, r := range records {
+		if f.Match(r.Product, r.Variety) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// matchAny reports whether name equals any of the names, or names is empty
+func matchAny(names []string, name string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	folded := FoldName(name)
+	for _, n := range names {
+		if FoldName(n) == folded {
+			return true
+		}
+	}
+	return false
+}
+
+// FoldName normalizes a product or variety name for comparison: it lowercases
+// it, strips Spanish diacritics and collapses whitespace
+func FoldName(name string) string {
+	var b strings.Builder
+	b.Grow(len(name))
+	space := false
+	for _, r := range strings.TrimSpace(name) {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(foldRune(unicode.ToLower(r)))
+	}
+	return b.String()
+}
+
+// foldRune maps an accented lowercase letter to its unaccented form
+func foldRune(r rune) rune {
+	switch r {
+	case 'á', 'à', 'â', 'ä', 'ã':
+		return 'a'
+	case 'é', 'è', 'ê', 'ë':
+		return 'e'
+	case 'í', 'ì', 'î', 'ï':
+		return 'i'
+	case 'ó', 'ò', 'ô', 'ö', 'õ':
+		return 'o'
+	case 'ú', 'ù', 'û', 'ü':
+		return 'u'
+	case 'ñ':
+		return 'n'
+	case 'ç':
+		return 'c'
+	}
+	return r
+}
@@ -0,0 +1,47 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFoldName(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "cebolla roja arequipena", FoldName("  CEBOLLA   ROJA\tAREQUIPEÑA "))
+	assert.Equal(t, "name", FoldName("Ñame"))
+	assert.Equal(t, "limon sutil", FoldName("LIMÓN SUTIL"))
+}
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+	records := []PriceRecord{
+		{Product: "PAPA", Variety: "PAPA AMARILLA"},
+		{Product: "PAPA", Variety: "PAPA BLANCA"},
+		{Product: "CEBOLLA", Variety: "CEBOLLA ROJA AREQUIPEÑA"},
+		{Product: "LIMON", Variety: "LIMON SUTIL"},
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{name: "zero keeps everything", want: []string{"PAPA AMARILLA", "PAPA BLANCA", "CEBOLLA ROJA AREQUIPEÑA", "LIMON SUTIL"}},
+		{name: "products", filter: Filter{Products: []string{"papa", "Cebolla"}}, want: []string{"PAPA AMARILLA", "PAPA BLANCA", "CEBOLLA ROJA AREQUIPEÑA"}},
+		{name: "variety without accents", filter: Filter{Varieties: []string{"cebolla roja arequipena"}}, want: []string{"CEBOLLA ROJA AREQUIPEÑA"}},
+		{name: "product and variety", filter: Filter{Products: []string{"papa"}, Varieties: []string{"papa blanca", "limon sutil"}}, want: []string{"PAPA BLANCA"}},
+		{name: "accented filter", filter: Filter{Products: []string{"limón"}}, want: []string{"LIMON SUTIL"}},
+		{name: "no match", filter: Filter{Products: []string{"papaya"}}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, r := range tt.filter.Apply(records) {
+				got = append(got, r.Variety)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,246 @@
+// Package source defines the source-agnostic model for wholesale market prices
+// and the PriceSource interface implemented by each market scraper.
+package source
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReportType identifies a kind of report a source can produce
+type ReportType string
+
+const (
+	// ReportDailyPrices is the daily min/max/average price report
+	ReportDailyPrices ReportType = "daily-prices"
+	// ReportDailyVolumes is the daily report of the volume entering the market
+	ReportDailyVolumes ReportType = "daily-volumes"
+)
+
+// reportTypes lists every known report type in display order
+var reportTypes = []ReportType{ReportDailyPrices, ReportDailyVolumes}
+
+// ParseReportTypes parses a comma-separated list of report types, e.g.
+// "daily-prices,daily-volumes". Duplicates are ignored.
+func ParseReportTypes(list string) ([]ReportType, error) {
+	var reports []ReportType
+	seen := make(map[ReportType]bool)
+	for _, name := range strings.Split(list, ",") {
+		report := ReportType(strings.ToLower(strings.TrimSpace(name)))
+		if report == "" || seen[report] {
+			continue
+		}
+		if !slices.Contains(reportTypes, report) {
+			return nil, fmt.Errorf("unknown report type %q (available: %s)", name, joinReports(reportTypes))
+		}
+		seen[report] = true
+		reports = append(reports, report)
+	}
+	if len(reports) == 0 {
+		return nil, fmt.Errorf("no report type selected (available: %s)", joinReports(reportTypes))
+	}
+	return reports, nil
+}
+
+// joinReports joins report types with commas
+func joinReports(reports []ReportType) string {
+	names := make([]string, len(reports))
+	for i, r := range reports {
+		names[i] = string(r)
+	}
+	return strings.Join(names, ", ")
+}
+
+// PriceRecord is a normalized price observation for a single product variety
+// on a given day, independent of the market it was scraped from.
+type PriceRecord struct {
+	// Date is the trading day in YYYY-MM-DD format
+	Date string `json:"date"`
+	// Source is the registry name of the source that produced the record
+	Source string `json:"source"`
+	// Market is the human readable name of the wholesale market
+	Market string `json:"market"`
+	// Product is the product name as published by the market
+	Product string `json:"product"`
+	// Variety is the product variety as published by the market
+	Variety string `json:"variety"`
+	// Unit is the unit the prices refer to (e.g. "kg")
+	Unit string `json:"unit"`
+	// Currency is the ISO 4217 currency code of the prices
+	Currency string `json:"currency"`
+	// Min is the lowest price of the day
+	Min float64 `json:"min"`
+	// Max is the highest price of the day
+	Max float64 `json:"max"`
+	// Avg is the average price of the day
+	Avg float64 `json:"avg"`
+	// Missing lists the prices the market did not publish ("min", "max" or
+	// "avg"), which are left at zero
+	Missing []string `json:"missing,omitempty"`
+}
+
+// VolumeRecord is a normalized observation of the volume of a product variety
+// that entered the market on a given day.
+type VolumeRecord struct {
+	// Date is the trading day in YYYY-MM-DD format
+	Date string `json:"date"`
+	// Source is the registry name of the source that produced the record
+	Source string `json:"source"`
+	// Market is the human readable name of the wholesale market
+	Market string `json:"market"`
+	// Product is the product name as published by the market
+	Product string `json:"product"`
+	// Variety is the product variety as published by the market
+	Variety string `json:"variety"`
+	// Unit is the unit of the volume (e.g. "t")
+	Unit string `json:"unit"`
+	// Volume is the quantity that entered the market
+	Volume float64 `json:"volume"`
+	// Missing is ["volume"] if the market did not publish the volume
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Names of the prices of a PriceRecord, as listed in its Missing field
+const (
+	FieldMin = "min"
+	FieldMax = "max"
+	FieldAvg = "avg"
+)
+
+// IsPriceField reports whether field is FieldMin, FieldMax or FieldAvg
+func IsPriceField(field string) bool {
+	switch field {
+	case FieldMin, FieldMax, FieldAvg:
+		return true
+	}
+	return false
+}
+
+// IsMissing reports whether the named price ("min", "max" or "avg") was not published
+func (r PriceRecord) IsMissing(field string) bool {
+	return slices.Contains(r.Missing, field)
+}
+
+// Price returns the named price ("min", "max" or "avg"), or 0 for any other name
+func (r PriceRecord) Price(field string) float64 {
+	switch field {
+	case FieldMin:
+		return r.Min
+	case FieldMax:
+		return r.Max
+	case FieldAvg:
+		return r.Avg
+	}
+	return 0
+}
+
+// PriceSource fetches daily prices from a wholesale market.
+//
+// Implementations must be safe for concurrent use by multiple goroutines.
+type PriceSource interface {
+	// Name returns the registry name of the source (e.g. "emmsa")
+	Name() string
+	// ReportTypes returns the report types supported by the source
+	ReportTypes() []ReportType
+	// FetchPrices returns the normalized prices published for the given day.
+	// An empty slice with a nil error means the market published no prices.
+	FetchPrices(ctx context.Context, date time.Time) ([]PriceRecord, error)
+	// Close releases any resources used by the source
+	Close() error
+}
+
+// VolumeSource is implemented by sources that also publish the
+// ReportDailyVolumes report
+type VolumeSource interface {
+	PriceSource
+	// FetchVolumes returns the normalized volumes published for the given
+	// day. An empty slice with a nil error means no volumes were published.
+	FetchVolumes(ctx context.Context, date time.Time) ([]VolumeRecord, error)
+}
+
+// Supports reports whether the source produces the given report type
+func Supports(s PriceSource, report ReportType) bool {
+	return slices.Contains(s.ReportTypes(), report)
+}
+
+// Factory creates a new PriceSource
+type Factory func() (PriceSource, error)
+
+// Registry maps source names to the factories that create them.
+//
+// The zero value is not usable, use NewRegistry instead.
+type Registry struct {
+	factories map[string]Factory
+}
+
+// NewRegistry creates an empty source registry
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+// Register adds a source factory under the given name, replacing any
+// factory previously registered with the same name.
+func (r *Registry) Register(name string, factory Factory) {
+	r.factories[strings.ToLower(name)] = factory
+}
+
+// Names returns the registered source names in alphabetical order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the source registered under the given name
+func (r *Registry) New(name string) (PriceSource, error) {
+	factory, ok := r.factories[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown price source %q (available: %s)", name, strings.Join(r.Names(), ", "))
+	}
+	return factory()
+}
+
+// Open creates every source in the comma-separated list of names, e.g.
+// "emmsa,other". If any source cannot be created, the ones already created
+// are closed and the error is returned.
+func (r *Registry) Open(names string) ([]PriceSource, error) {
+	var sources []PriceSource
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		s, err := r.New(name)
+		if err != nil {
+			CloseAll(sources)
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no price source selected (available: %s)", strings.Join(r.Names(), ", "))
+	}
+	return sources, nil
+}
+
+// CloseAll closes every source, returning the first error encountered
+func CloseAll(sources []PriceSource) error {
+	var firstErr error
+	for _, s := range sources {
+		if err := s.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
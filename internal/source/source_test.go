@@ -0,0 +1,106 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource is a PriceSource returning fixed records
+type fakeSource struct {
+	name   string
+	closed bool
+}
+
+func (f *fakeSource) Name() string              { return f.name }
+func (f *fakeSource) ReportTypes() []ReportType { return []ReportType{ReportDailyPrices} }
+func (f *fakeSource) Close() error              { f.closed = true; return nil }
+func (f *fakeSource) FetchPrices(ctx context.Context, date time.Time) ([]PriceRecord, error) {
+	return []PriceRecord{{Date: date.Format("2006-01-02"), Source: f.name}}, nil
+}
+
+func TestRegistry(t *testing.T) {
+	t.Parallel()
+
+	created := make(map[string]*fakeSource)
+	registry := NewRegistry()
+	for _, name := range []string{"emmsa", "other"} {
+		name := name
+		registry.Register(name, func() (PriceSource, error) {
+			s := &fakeSource{name: name}
+			created[name] = s
+			return s, nil
+		})
+	}
+	registry.Register("broken", func() (PriceSource, error) {
+		return nil, errors.New("boom")
+	})
+
+	t.Run("Names", func(t *testing.T) {
+		assert.Equal(t, []string{"broken", "emmsa", "other"}, registry.Names())
+	})
+
+	t.Run("Open list", func(t *testing.T) {
+		sources, err := registry.Open(" EMMSA, other,emmsa,")
+		require.NoError(t, err)
+		require.Len(t, sources, 2)
+		assert.Equal(t, "emmsa", sources[0].Name())
+		assert.Equal(t, "other", sources[1].Name())
+	})
+
+	t.Run("Open unknown", func(t *testing.T) {
+		_, err := registry.Open("emmsa,missing")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown price source "missing"`)
+		assert.True(t, created["emmsa"].closed, "already opened sources must be closed")
+	})
+
+	t.Run("Open factory error", func(t *testing.T) {
+		_, err := registry.Open("broken")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "boom")
+	})
+
+	t.Run("Open empty", func(t *testing.T) {
+		_, err := registry.Open(" , ")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no price source selected")
+	})
+}
+
+func TestParseReportTypes(t *testing.T) {
+	t.Parallel()
+
+	reports, err := ParseReportTypes(" Daily-Volumes,daily-prices,daily-volumes")
+	require.NoError(t, err)
+	assert.Equal(t, []ReportType{ReportDailyVolumes, ReportDailyPrices}, reports)
+
+	_, err = ParseReportTypes("daily-prices,arrivals")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown report type "arrivals"`)
+
+	_, err = ParseReportTypes("")
+	assert.Error(t, err)
+
+	assert.True(t, Supports(&fakeSource{}, ReportDailyPrices))
+	assert.False(t, Supports(&fakeSource{}, ReportDailyVolumes))
+}
+
+func TestPriceFields(t *testing.T) {
+	t.Parallel()
+	p := PriceRecord{Min: 1.2, Max: 1.5, Avg: 1.35, Missing: []string{FieldMax}}
+
+	assert.Equal(t, 1.2, p.Price(FieldMin))
+	assert.Equal(t, 1.5, p.Price(FieldMax))
+	assert.Equal(t, 1.35, p.Price(FieldAvg))
+	assert.Zero(t, p.Price("median"))
+	assert.True(t, p.IsMissing(FieldMax))
+	assert.False(t, p.IsMissing(FieldAvg))
+
+	assert.True(t, IsPriceField(FieldAvg))
+	assert.False(t, IsPriceField("Avg"))
+}
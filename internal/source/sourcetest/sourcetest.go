@@ -0,0 +1,40 @@
+// Package sourcetest provides price records for tests of the packages that
+// consume them.
+//
+// Example:
+//
+//	p := sourcetest.Price("2025-06-18", "PAPA", "PAPA BLANCA", 1.2, 1.5, 1.35)
+//	haba := sourcetest.Price("2025-06-18", "HABA", "HABA VERDE", 0, 2, 0,
+//		sourcetest.Missing("min", "avg"))
+package sourcetest
+
+import "github.com/aliasthewho/price_tracker/internal/source"
+
+// Option customizes a record built by Price
+type Option func(*source.PriceRecord)
+
+// Market sets the market the price was quoted at
+func Market(name string) Option {
+	return func(p *source.PriceRecord) {
+		p.Market = name
+	}
+}
+
+// Missing sets the fields EMMSA did not quote
+func Missing(fields ...string) Option {
+	return func(p *source.PriceRecord) {
+		p.Missing = fields
+	}
+}
+
+// Price returns an EMMSA price record in soles per kilogram
+func Price(date, product, variety string, min, max, avg float64, opts ...Option) source.PriceRecord {
+	p := source.PriceRecord{
+		Date: date, Source: "emmsa", Product: product, Variety: variety, Unit: "kg", Currency: "PEN",
+		Min: min, Max: max, Avg: avg,
+	}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return p
+}
@@ -0,0 +1,125 @@
+// Package localfs implements storage.Store as a directory of JSON files,
+// one file per day named like the Pantry baskets (prices_YYYY_MM_DD.json).
+package localfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// fileExt is the extension of every day file
+const fileExt = ".json"
+
+// Store keeps one indented JSON file per day in a directory.
+//
+// The zero value is not usable, use New instead.
+type Store struct {
+	// dir is the directory holding the day files
+	dir string
+}
+
+var _ storage.Store = (*Store)(nil)
+
+// New creates a Store in the given directory, creating it if needed
+func New(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, errors.New("storage directory not set")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// path returns the file of the given date
+func (s *Store) path(date time.Time) string {
+	return filepath.Join(s.dir, storage.DayKey(date)+fileExt)
+}
+
+// SaveDay writes the day to its file. The file is written to a temporary
+// name first, so an interrupted write never leaves a partial day behind.
+func (s *Store) SaveDay(ctx context.Context, day storage.DailyPrices) error {
+	date, err := day.Day()
+	if err != nil {
+		return err
+	}
+
+	jsonData, err := json.MarshalIndent(day, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal day: %w", err)
+	}
+
+	path := s.path(date)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, jsonData, 0o600); err != nil {
+		return fmt.Errorf("failed to write day file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write day file: %w", err)
+	}
+	return nil
+}
+
+// LoadDay reads the file of the given date
+func (s *Store) LoadDay(ctx context.Context, date time.Time) (storage.DailyPrices, error) {
+	jsonData, err := os.ReadFile(s.path(date))
+	if errors.Is(err, os.ErrNotExist) {
+		return storage.DailyPrices{}, fmt.Errorf("%s: %w", date.Format(storage.DateLayout), storage.ErrNotFound)
+	}
+	if err != nil {
+		return storage.DailyPrices{}, fmt.Errorf("failed to read day file: %w", err)
+	}
+
+	var day storage.DailyPrices
+	if err := json.Unmarshal(jsonData, &day); err != nil {
+		return storage.DailyPrices{}, fmt.Errorf("failed to decode day file: %w", err)
+	}
+	return day, nil
+}
+
+// ListDays returns the dates of every day file in the directory
+func (s *Store) ListDays(ctx context.Context) ([]time.Time, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage directory: %w", err)
+	}
+
+	var days []time.Time
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), fileExt) {
+			continue
+		}
+		if date, ok := storage.ParseDayKey(strings.TrimSuffix(e.Name(), fileExt)); ok {
+			days = append(days, date)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, nil
+}
+
+// DeleteDay removes the file of the given date
+func (s *Store) DeleteDay(ctx context.Context, date time.Time) error {
+	err := os.Remove(s.path(date))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s: %w", date.Format(storage.DateLayout), storage.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete day file: %w", err)
+	}
+	return nil
+}
+
+// Close releases any resources used by the store
+func (s *Store) Close() error {
+	return nil
+}
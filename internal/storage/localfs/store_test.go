@@ -0,0 +1,63 @@
+package localfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, err := New(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	june17 := time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC)
+	june18 := time.Date(2025, 6, 18, 0, 0, 0, 0, time.UTC)
+	day := storage.NewDailyPrices(june18, []source.PriceRecord{
+		{Date: "2025-06-18", Source: "emmsa", Product: "PAPA", Variety: "PAPA BLANCA", Avg: 1.35},
+	})
+
+	t.Run("LoadDay missing", func(t *testing.T) {
+		_, err := store.LoadDay(ctx, june17)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("SaveDay and LoadDay", func(t *testing.T) {
+		require.NoError(t, store.SaveDay(ctx, day))
+		assert.FileExists(t, filepath.Join(dir, "prices_2025_06_18.json"))
+
+		got, err := store.LoadDay(ctx, june18)
+		require.NoError(t, err)
+		assert.Equal(t, day, got)
+	})
+
+	t.Run("ListDays ignores unrelated files", func(t *testing.T) {
+		require.NoError(t, store.SaveDay(ctx, storage.NewDailyPrices(june17, nil)))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.json"), []byte("{}"), 0o600))
+
+		days, err := store.ListDays(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{june17, june18}, days)
+	})
+
+	t.Run("DeleteDay", func(t *testing.T) {
+		require.NoError(t, store.DeleteDay(ctx, june17))
+		assert.ErrorIs(t, store.DeleteDay(ctx, june17), storage.ErrNotFound)
+	})
+
+	t.Run("SaveDay invalid date", func(t *testing.T) {
+		err := store.SaveDay(ctx, storage.DailyPrices{Date: "18/06/2025"})
+		assert.Error(t, err)
+	})
+}
@@ -4,13 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"os"
+	"strings"
 	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/retry"
+	"github.com/aliasthewho/price_tracker/internal/storage"
 )
 
+// DefaultBaseURL is the URL of the Pantry API
+const DefaultBaseURL = "https://getpantry.cloud/apiv1/pantry"
+
+// maxErrorText is the longest plain-text response body used as an error message
+const maxErrorText = 200
+
 type (
 	// ErrorResponse represents an error response from the Pantry API
 	ErrorResponse struct {
@@ -18,6 +29,9 @@ type (
 	}
 
 	// Basket represents a Pantry basket
+	//
+	// Deprecated: read and write baskets as a concrete type with Get, Put
+	// and Update.
 	Basket map[string]interface{}
 )
 
@@ -31,61 +45,230 @@ type BasketManager struct {
 	baseURL string
 	// apiKey is the API key for authentication
 	apiKey string
+	// userAgent is sent with every request, Go's default if empty
+	userAgent string
+	// basketPrefix is prepended to the basket name of every day
+	basketPrefix string
 	// httpClient is the HTTP client for making requests
 	httpClient *http.Client
+	// retry controls how transient failures are retried
+	retry RetryPolicy
+	// limiter spaces out requests, nil if they are not rate limited
+	limiter *limiter
+	// maxBasketSize is the largest payload PutSharded writes to a single basket
+	maxBasketSize int
+	// writeMode is how SaveDay writes a day that is already stored
+	writeMode WriteMode
+	// scraperVersion is recorded in the Envelope of every day SaveDay writes
+	scraperVersion string
 }
 
-// Config holds the configuration required to initialize a Pantry client.
-type Config struct {
-	// APIKey is the authentication token for the Pantry API.
-	// It can be obtained from the Pantry dashboard at https://getpantry.cloud/
-	APIKey string
+// Option configures a BasketManager created by NewBasketManager
+type Option func(*BasketManager)
+
+// WithBaseURL sets the URL of the Pantry API, e.g. the BaseURL of a
+// pantrytest.Server. It overrides Config.BaseURL.
+func WithBaseURL(url string) Option {
+	return func(m *BasketManager) {
+		m.baseURL = strings.TrimSuffix(url, "/")
+	}
 }
 
-// NewConfigFromEnv creates a new Config by reading the PANTRY_API_KEY environment variable.
-//
-// Returns an error if the environment variable is not set or is empty.
-//
-// Example:
-//
-//	cfg, err := NewConfigFromEnv()
-//	if err != nil {
-//	    log.Fatal(err)
-//	}
-func NewConfigFromEnv() (Config, error) {
-	apiKey := os.Getenv("PANTRY_API_KEY")
-	if apiKey == "" {
-		return Config{}, fmt.Errorf("PANTRY_API_KEY environment variable not set")
+// WithHTTPClient sets the HTTP client used to send requests
+func WithHTTPClient(client *http.Client) Option {
+	return func(m *BasketManager) {
+		m.httpClient = client
+	}
+}
+
+// WithRetryPolicy sets how transient failures are retried
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(m *BasketManager) {
+		m.retry = policy
+	}
+}
+
+// WithRateLimit limits requests to rate per second with bursts of up to
+// burst requests. A rate of 0 disables the limit.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(m *BasketManager) {
+		m.limiter = newLimiter(rate, burst)
+	}
+}
+
+// WithMaxBasketSize sets the largest payload, in bytes of JSON, that
+// PutSharded writes to a single basket before splitting it into parts
+func WithMaxBasketSize(size int) Option {
+	return func(m *BasketManager) {
+		m.maxBasketSize = size
+	}
+}
+
+// WriteMode is how a write treats the existing contents of a basket
+type WriteMode string
+
+// Write modes of SaveDay and PutSharded
+const (
+	// WriteReplace replaces the contents of the basket, see ReplaceBasket
+	WriteReplace WriteMode = "replace"
+	// WriteMerge merges into the contents of the basket, see MergeBasket
+	WriteMerge WriteMode = "merge"
+)
+
+// WithWriteMode sets how SaveDay writes a day that is already stored. The
+// default is WriteReplace.
+func WithWriteMode(mode WriteMode) Option {
+	return func(m *BasketManager) {
+		m.writeMode = mode
+	}
+}
+
+// WithScraperVersion sets the version of the program fetching the days,
+// recorded in the Envelope of every day SaveDay writes
+func WithScraperVersion(version string) Option {
+	return func(m *BasketManager) {
+		m.scraperVersion = version
 	}
-	return Config{APIKey: apiKey}, nil
 }
 
 // NewBasketManager creates a new BasketManager with the provided configuration.
 //
 // The returned BasketManager is ready to interact with the Pantry API.
-// The default HTTP client has a 10-second timeout.
+// The default HTTP client has the timeout of the Config (DefaultTimeout if
+// unset), transient failures are retried with DefaultRetryPolicy and
+// requests are limited to DefaultRateLimit per second.
 //
 // Example:
 //
 //	cfg := Config{APIKey: "your-api-key"}
-//	manager := NewBasketManager(cfg)
-func NewBasketManager(cfg Config) *BasketManager {
-	return &BasketManager{
-		baseURL:    "https://getpantry.cloud/apiv1/pantry",
-		apiKey:     cfg.APIKey,
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+//	manager := NewBasketManager(cfg, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+func NewBasketManager(cfg Config, opts ...Option) *BasketManager {
+	baseURL := DefaultBaseURL
+	if cfg.BaseURL != "" {
+		baseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	m := &BasketManager{
+		baseURL:      baseURL,
+		apiKey:       cfg.APIKey,
+		userAgent:    cfg.UserAgent,
+		basketPrefix: cfg.BasketPrefix,
+		httpClient:   &http.Client{Timeout: timeout},
+		retry:        DefaultRetryPolicy(),
+		limiter:      newLimiter(DefaultRateLimit, DefaultBurst),
+
+		maxBasketSize: DefaultMaxBasketSize,
+		writeMode:     WriteReplace,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// do sends a request to the path below the pantry's URL and returns the body
+// of the 200 response. Requests wait for the rate limiter, and transient
+// failures are retried according to the retry policy; merges (PUT) are only
+// retried when rate limited, see isRetryableRequest. Other responses are
+// returned as an *APIError for the operation op; basketRead marks requests
+// on a single basket, whose 400 responses mean ErrNotFound. The API key is
+// scrubbed from returned and logged errors.
+func (m *BasketManager) do(ctx context.Context, op, method, path string, payload []byte, basketRead bool) ([]byte, error) {
+	url := fmt.Sprintf("%s/%s/%s", m.baseURL, m.apiKey, path)
+	attempts := m.retry.Attempts()
+
+	for attempt := 1; ; attempt++ {
+		if err := m.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		body, err := m.send(ctx, op, method, url, payload, basketRead)
+		err = m.redactError(err)
+		if err == nil || attempt >= attempts || ctx.Err() != nil || !isRetryableRequest(method, err) {
+			return body, err
+		}
+
+		delay := m.retry.Backoff(attempt)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			delay = apiErr.RetryAfter
+			m.limiter.pause(delay)
+		}
+		log.Printf("Pantry request failed (attempt %d/%d), retrying in %s: %v", attempt, attempts, delay.Round(time.Millisecond), err)
+		if err := retry.Sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send sends a single request attempt
+func (m *BasketManager) send(ctx context.Context, op, method, url string, payload []byte, basketRead bool) ([]byte, error) {
+	var reqBody io.Reader = http.NoBody
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if method == http.MethodPost || method == http.MethodPut {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if m.userAgent != "" {
+		req.Header.Set("User-Agent", m.userAgent)
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, &retry.TransportError{Err: fmt.Errorf("request failed: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &retry.TransportError{Err: fmt.Errorf("failed to read response: %w", err)}
+	}
+	if resp.StatusCode == http.StatusOK {
+		return body, nil
+	}
+
+	message := resp.Status
+	var errResp ErrorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil {
+		if errResp.Message != "" {
+			message = errResp.Message
+		}
+	} else if text := strings.TrimSpace(string(body)); text != "" && len(text) <= maxErrorText && !strings.HasPrefix(text, "<") {
+		// Pantry reports some errors as plain text
+		message = text
+	}
+	return nil, &APIError{
+		Op:         op,
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		kind:       classify(resp.StatusCode, message, basketRead),
 	}
 }
 
 // BasketName generates a consistent name for a basket based on the provided date.
-// The format is "prices_YYYY_MM_DD".
+// The format is "prices_YYYY_MM_DD". The BasketManager stores days in
+// DayBasket, which adds the basket prefix of its Config.
 //
 // Example:
 //
 //	name := BasketName(time.Date(2023, 6, 18, 0, 0, 0, 0, time.UTC))
 //	// name is "prices_2023_06_18"
 func BasketName(date time.Time) string {
-	return fmt.Sprintf("prices_%s", date.Format("2006_01_02"))
+	return storage.DayKey(date)
+}
+
+// DayBasket returns the name of the basket the day is stored in: BasketName
+// with the basket prefix of the Config
+func (m *BasketManager) DayBasket(date time.Time) string {
+	return m.basketPrefix + BasketName(date)
 }
 
 // CreateBasket creates a new basket in Pantry with the given name.
@@ -100,37 +283,15 @@ func BasketName(date time.Time) string {
 //	    return fmt.Errorf("failed to create basket: %w", err)
 //	}
 func (m *BasketManager) CreateBasket(ctx context.Context, basketName string) error {
-	url := fmt.Sprintf("%s/%s/basket/%s", m.baseURL, m.apiKey, basketName)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, http.NoBody)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := m.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		var errResp ErrorResponse
-		if json.Unmarshal(body, &errResp) == nil {
-			return fmt.Errorf("failed to create basket: %s", errResp.Message)
-		}
-		return fmt.Errorf("failed to create basket: %s", resp.Status)
-	}
-
-	return nil
+	_, err := m.do(ctx, "create basket "+basketName, http.MethodPost, "basket/"+basketName, nil, false)
+	return err
 }
 
 // BasketExists checks if a basket with the given name exists in Pantry.
 //
-// Returns true if the basket exists, false otherwise. Any error during the check
-// (e.g., network issues) is returned as the second parameter.
+// Returns true on a 200 response and false if Pantry reports the basket as
+// missing. Any other outcome (network issues, rate limiting, server errors,
+// an invalid key) is returned as an error rather than guessed.
 //
 // Example:
 //
@@ -139,20 +300,14 @@ func (m *BasketManager) CreateBasket(ctx context.Context, basketName string) err
 //	    return false, fmt.Errorf("failed to check basket existence: %w", err)
 //	}
 func (m *BasketManager) BasketExists(ctx context.Context, basketName string) (bool, error) {
-	url := fmt.Sprintf("%s/%s/basket/%s", m.baseURL, m.apiKey, basketName)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
-	if err != nil {
-		return false, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := m.httpClient.Do(req)
-	if err != nil {
-		return false, fmt.Errorf("request failed: %w", err)
+	_, err := m.do(ctx, "check basket "+basketName, http.MethodGet, "basket/"+basketName, nil, true)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, ErrNotFound):
+		return false, nil
 	}
-	defer resp.Body.Close()
-
-	return resp.StatusCode == http.StatusOK, nil
+	return false, err
 }
 
 // ListBaskets retrieves the names of all baskets in your Pantry.
@@ -167,85 +322,80 @@ func (m *BasketManager) BasketExists(ctx context.Context, basketName string) (bo
 //	    return nil, fmt.Errorf("failed to list baskets: %w", err)
 //	}
 func (m *BasketManager) ListBaskets(ctx context.Context) ([]string, error) {
-	url := fmt.Sprintf("%s/%s/baskets", m.baseURL, m.apiKey)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	body, err := m.do(ctx, "list baskets", http.MethodGet, "baskets", nil, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := m.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		var errResp ErrorResponse
-		if json.Unmarshal(body, &errResp) == nil {
-			return nil, fmt.Errorf("failed to list baskets: %s", errResp.Message)
-		}
-		return nil, fmt.Errorf("failed to list baskets: %s", resp.Status)
+		return nil, err
 	}
 
 	var baskets []string
-	if err := json.NewDecoder(resp.Body).Decode(&baskets); err != nil {
+	if err := json.Unmarshal(body, &baskets); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	return baskets, nil
 }
 
-// UpdateBasket updates the contents of an existing basket with the provided data.
+// UpdateBasket merges data into an existing basket, like MergeBasket.
+//
+// Deprecated: use MergeBasket, or ReplaceBasket to drop the keys missing
+// from data.
+func (m *BasketManager) UpdateBasket(ctx context.Context, basketName string, data interface{}) error {
+	return m.MergeBasket(ctx, basketName, data)
+}
+
+// ReplaceBasket replaces the contents of a basket with data, creating the
+// basket if it does not exist. Keys missing from data are removed.
 //
-// The data parameter can be any value that can be marshaled to JSON.
-// If the basket doesn't exist, it will be created.
+// The data parameter can be any value that marshals to a JSON object.
 //
 // Example:
 //
-//	data := map[string]interface{}{"key": "value"}
-//	if err := manager.UpdateBasket(ctx, "my-basket", data); err != nil {
-//	    return fmt.Errorf("failed to update basket: %w", err)
+//	if err := manager.ReplaceBasket(ctx, "my-basket", data); err != nil {
+//	    return fmt.Errorf("failed to replace basket: %w", err)
 //	}
-func (m *BasketManager) UpdateBasket(ctx context.Context, basketName string, data interface{}) error {
+func (m *BasketManager) ReplaceBasket(ctx context.Context, basketName string, data interface{}) error {
 	payload, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
+	return m.replaceBasket(ctx, basketName, payload)
+}
 
-	url := fmt.Sprintf("%s/%s/basket/%s", m.baseURL, m.apiKey, basketName)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(payload))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
+// replaceBasket sends the JSON payload of ReplaceBasket
+func (m *BasketManager) replaceBasket(ctx context.Context, basketName string, payload []byte) error {
+	_, err := m.do(ctx, "replace basket "+basketName, http.MethodPost, "basket/"+basketName, payload, false)
+	return err
+}
 
-	resp, err := m.httpClient.Do(req)
+// MergeBasket deep-merges data into an existing basket: keys of data
+// overwrite the same keys in the basket, nested objects are merged and
+// arrays are appended to. Keys missing from data are kept. Merging into a
+// missing basket returns an error matching ErrNotFound.
+//
+// A merge applied twice appends its arrays twice, so it is only retried
+// after a 429. A transport error or 5xx may leave the merge applied or not.
+//
+// Example:
+//
+//	data := map[string]interface{}{"key": "value"}
+//	if err := manager.MergeBasket(ctx, "my-basket", data); err != nil {
+//	    return fmt.Errorf("failed to merge basket: %w", err)
+//	}
+func (m *BasketManager) MergeBasket(ctx context.Context, basketName string, data interface{}) error {
+	payload, err := json.Marshal(data)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		var errResp ErrorResponse
-		if json.Unmarshal(body, &errResp) == nil {
-			return fmt.Errorf("failed to update basket: %s", errResp.Message)
-		}
-		return fmt.Errorf("failed to update basket: %s", resp.Status)
+		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 
-	return nil
+	_, err = m.do(ctx, "update basket "+basketName, http.MethodPut, "basket/"+basketName, payload, false)
+	return err
 }
 
 // GetBasket retrieves and unmarshals the contents of a basket into the target.
 //
 // The target parameter must be a pointer to a value that can hold the unmarshaled
-// JSON data. Returns an error if the basket doesn't exist or if the data cannot
-// be unmarshaled into the target type.
+// JSON data. Returns an error matching ErrNotFound if the basket doesn't exist,
+// or an error if the data cannot be unmarshaled into the target type.
 //
 // Example:
 //
@@ -254,31 +404,27 @@ func (m *BasketManager) UpdateBasket(ctx context.Context, basketName string, dat
 //	    return fmt.Errorf("failed to get basket: %w", err)
 //	}
 func (m *BasketManager) GetBasket(ctx context.Context, basketName string, target interface{}) error {
-	url := fmt.Sprintf("%s/%s/basket/%s", m.baseURL, m.apiKey, basketName)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	body, err := m.do(ctx, "get basket "+basketName, http.MethodGet, "basket/"+basketName, nil, true)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
 
-	resp, err := m.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		var errResp ErrorResponse
-		if json.Unmarshal(body, &errResp) == nil {
-			return fmt.Errorf("failed to get basket: %s", errResp.Message)
-		}
-		return fmt.Errorf("failed to get basket: %s", resp.Status)
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+	if err := json.Unmarshal(body, target); err != nil {
 		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	return nil
 }
+
+// DeleteBasket deletes the basket with the given name from Pantry. Deleting a
+// missing basket returns an error matching ErrNotFound.
+//
+// Example:
+//
+//	if err := manager.DeleteBasket(ctx, "my-basket"); err != nil {
+//	    return fmt.Errorf("failed to delete basket: %w", err)
+//	}
+func (m *BasketManager) DeleteBasket(ctx context.Context, basketName string) error {
+	_, err := m.do(ctx, "delete basket "+basketName, http.MethodDelete, "basket/"+basketName, nil, true)
+	return err
+}
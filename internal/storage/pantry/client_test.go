@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -63,11 +64,15 @@ func TestNewConfigFromEnv(t *testing.T) {
 	oldKey := os.Getenv("PANTRY_API_KEY")
 	defer os.Setenv("PANTRY_API_KEY", oldKey)
 
+	keyFile := filepath.Join(t.TempDir(), "pantry_key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("file-key-456\n"), 0o600))
+
 	tests := []struct {
 		name    string
 		setup   func()
 		err     string
 		wantKey string
+		want    Config
 	}{
 		{
 			name: "valid key",
@@ -83,6 +88,34 @@ func TestNewConfigFromEnv(t *testing.T) {
 			},
 			err: "PANTRY_API_KEY environment variable not set",
 		},
+		{
+			name: "key file and settings",
+			setup: func() {
+				os.Setenv("PANTRY_API_KEY_FILE", keyFile)
+				os.Setenv("PANTRY_TIMEOUT", "30s")
+				os.Setenv("PANTRY_USER_AGENT", "price-tracker/test")
+				os.Setenv("PANTRY_BASKET_PREFIX", "staging_")
+			},
+			wantKey: "file-key-456",
+			want: Config{APIKey: "file-key-456", Timeout: 30 * time.Second,
+				UserAgent: "price-tracker/test", BasketPrefix: "staging_"},
+		},
+		{
+			name: "key and key file",
+			setup: func() {
+				os.Setenv("PANTRY_API_KEY", "test-key-123")
+				os.Setenv("PANTRY_API_KEY_FILE", keyFile)
+			},
+			err: "only one of PANTRY_API_KEY and PANTRY_API_KEY_FILE",
+		},
+		{
+			name: "invalid timeout",
+			setup: func() {
+				os.Setenv("PANTRY_API_KEY", "test-key-123")
+				os.Setenv("PANTRY_TIMEOUT", "soon")
+			},
+			err: `invalid timeout "soon"`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -105,6 +138,9 @@ func TestNewConfigFromEnv(t *testing.T) {
 
 			require.NoError(t, err)
 			assert.Equal(t, tt.wantKey, got.APIKey)
+			if tt.want != (Config{}) {
+				assert.Equal(t, tt.want, got)
+			}
 		})
 	}
 }
@@ -0,0 +1,248 @@
+package pantry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the timeout of every request when Config.Timeout is unset
+const DefaultTimeout = 10 * time.Second
+
+// Environment variables read by NewConfigFromEnv
+const (
+	EnvAPIKey       = "PANTRY_API_KEY"
+	EnvAPIKeyFile   = "PANTRY_API_KEY_FILE"
+	EnvBaseURL      = "PANTRY_BASE_URL"
+	EnvTimeout      = "PANTRY_TIMEOUT"
+	EnvUserAgent    = "PANTRY_USER_AGENT"
+	EnvBasketPrefix = "PANTRY_BASKET_PREFIX"
+)
+
+// Config holds the configuration required to initialize a Pantry client.
+type Config struct {
+	// APIKey is the authentication token for the Pantry API.
+	// It can be obtained from the Pantry dashboard at https://getpantry.cloud/
+	APIKey string
+	// BaseURL is the URL of the Pantry API, DefaultBaseURL if empty. Point it
+	// to a fake server (see pantry-cli serve-fake) to work offline.
+	BaseURL string
+	// Timeout bounds every request, DefaultTimeout if zero
+	Timeout time.Duration
+	// UserAgent is sent with every request, Go's default if empty
+	UserAgent string
+	// BasketPrefix is prepended to the basket name of every day, e.g.
+	// "staging_" stores days as "staging_prices_YYYY_MM_DD", so several
+	// environments can share a pantry
+	BasketPrefix string
+}
+
+// NewConfigFromEnv creates a new Config from the environment: the API key
+// from PANTRY_API_KEY, or from the file named by PANTRY_API_KEY_FILE (e.g.
+// a Docker or Kubernetes secret), and the optional PANTRY_BASE_URL,
+// PANTRY_TIMEOUT (a duration such as "30s"), PANTRY_USER_AGENT and
+// PANTRY_BASKET_PREFIX.
+//
+// Returns an error if no API key is set or the variables are invalid.
+//
+// Example:
+//
+//	cfg, err := NewConfigFromEnv()
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func NewConfigFromEnv() (Config, error) {
+	entry := PantryConfig{
+		APIKey:       os.Getenv(EnvAPIKey),
+		APIKeyFile:   os.Getenv(EnvAPIKeyFile),
+		BaseURL:      os.Getenv(EnvBaseURL),
+		Timeout:      os.Getenv(EnvTimeout),
+		UserAgent:    os.Getenv(EnvUserAgent),
+		BasketPrefix: os.Getenv(EnvBasketPrefix),
+	}
+	switch {
+	case entry.APIKey == "" && entry.APIKeyFile == "":
+		return Config{}, fmt.Errorf("%s environment variable not set", EnvAPIKey)
+	case entry.APIKey != "" && entry.APIKeyFile != "":
+		return Config{}, fmt.Errorf("only one of %s and %s may be set", EnvAPIKey, EnvAPIKeyFile)
+	}
+	cfg, err := entry.config("")
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid Pantry environment: %w", err)
+	}
+	return cfg, nil
+}
+
+// ConfigFile is the content of a JSON file describing one or more named
+// pantries, e.g. production and staging:
+//
+//	{
+//	  "default": "prod",
+//	  "pantries": [
+//	    {"name": "prod", "api_key_file": "/run/secrets/pantry_key"},
+//	    {"name": "staging", "api_key": "...", "basket_prefix": "staging_", "timeout": "30s"}
+//	  ]
+//	}
+type ConfigFile struct {
+	// Default is the pantry used when none is named. It may be omitted if
+	// the file describes a single pantry.
+	Default  string         `json:"default,omitempty"`
+	Pantries []PantryConfig `json:"pantries"`
+}
+
+// PantryConfig describes a pantry of a ConfigFile
+type PantryConfig struct {
+	// Name selects the pantry; required and unique
+	Name string `json:"name"`
+	// APIKey is the key of the pantry. Exactly one of APIKey and APIKeyFile
+	// must be set.
+	APIKey string `json:"api_key,omitempty"`
+	// APIKeyFile is a file holding the key, relative to the config file
+	APIKeyFile string `json:"api_key_file,omitempty"`
+	// BaseURL, UserAgent and BasketPrefix set the fields of Config
+	BaseURL      string `json:"base_url,omitempty"`
+	UserAgent    string `json:"user_agent,omitempty"`
+	BasketPrefix string `json:"basket_prefix,omitempty"`
+	// Timeout is a duration such as "30s"
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// config resolves the entry into a Config, reading the key file relative to dir
+func (p PantryConfig) config(dir string) (Config, error) {
+	cfg := Config{APIKey: p.APIKey, BaseURL: p.BaseURL, UserAgent: p.UserAgent, BasketPrefix: p.BasketPrefix}
+	if p.Timeout != "" {
+		timeout, err := time.ParseDuration(p.Timeout)
+		if err != nil || timeout <= 0 {
+			return Config{}, fmt.Errorf("invalid timeout %q", p.Timeout)
+		}
+		cfg.Timeout = timeout
+	}
+	if p.APIKeyFile != "" {
+		path := p.APIKeyFile
+		if dir != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read API key file: %w", err)
+		}
+		cfg.APIKey = strings.TrimSpace(string(key))
+		if cfg.APIKey == "" {
+			return Config{}, fmt.Errorf("API key file %s is empty", path)
+		}
+	}
+	return cfg, nil
+}
+
+// LoadConfigFile reads and validates a JSON file of named pantries
+func LoadConfigFile(path string) (ConfigFile, error) {
+	var file ConfigFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, fmt.Errorf("failed to read Pantry config: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return file, fmt.Errorf("failed to decode Pantry config: %w", err)
+	}
+	if err := file.Validate(); err != nil {
+		return file, fmt.Errorf("invalid Pantry config: %w", err)
+	}
+	return file, nil
+}
+
+// Validate checks the pantries, returning every problem found
+func (f ConfigFile) Validate() error {
+	var errs []error
+	if len(f.Pantries) == 0 {
+		errs = append(errs, errors.New("no pantry configured"))
+	}
+	names := make(map[string]bool, len(f.Pantries))
+	for i, p := range f.Pantries {
+		name := p.Name
+		switch {
+		case name == "":
+			name = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Errorf("pantry %s: name is required", name))
+		case names[name]:
+			errs = append(errs, fmt.Errorf("pantry %q: duplicate name", name))
+		}
+		names[name] = true
+		if (p.APIKey == "") == (p.APIKeyFile == "") {
+			errs = append(errs, fmt.Errorf("pantry %q: exactly one of api_key and api_key_file is required", name))
+		}
+		if p.Timeout != "" {
+			if timeout, err := time.ParseDuration(p.Timeout); err != nil || timeout <= 0 {
+				errs = append(errs, fmt.Errorf("pantry %q: invalid timeout %q", name, p.Timeout))
+			}
+		}
+	}
+	if f.Default != "" && !names[f.Default] {
+		errs = append(errs, fmt.Errorf("default pantry %q is not configured", f.Default))
+	}
+	return errors.Join(errs...)
+}
+
+// Names returns the names of the pantries in file order
+func (f ConfigFile) Names() []string {
+	names := make([]string, len(f.Pantries))
+	for i, p := range f.Pantries {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// Pantry returns the Config of the named pantry, or of the default one if
+// name is empty. Key files are read relative to dir, the directory of the
+// config file.
+func (f ConfigFile) Pantry(name, dir string) (Config, error) {
+	if name == "" {
+		name = f.Default
+	}
+	if name == "" {
+		if len(f.Pantries) != 1 {
+			return Config{}, fmt.Errorf("no default pantry, select one of: %s", strings.Join(f.Names(), ", "))
+		}
+		name = f.Pantries[0].Name
+	}
+	for _, p := range f.Pantries {
+		if p.Name == name {
+			cfg, err := p.config(dir)
+			if err != nil {
+				return Config{}, fmt.Errorf("pantry %q: %w", name, err)
+			}
+			return cfg, nil
+		}
+	}
+	return Config{}, fmt.Errorf("unknown pantry %q (available: %s)", name, strings.Join(f.Names(), ", "))
+}
+
+// LoadConfig returns the Config of the named pantry of a config file, or
+// reads it from the environment with NewConfigFromEnv if path is empty. The
+// environment describes a single pantry, so a name needs a config file.
+//
+// Example:
+//
+//	cfg, err := LoadConfig(os.Getenv("PANTRY_CONFIG"), "staging")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func LoadConfig(path, name string) (Config, error) {
+	if path == "" {
+		if name != "" {
+			return Config{}, fmt.Errorf("pantry %q selected without a Pantry config file", name)
+		}
+		return NewConfigFromEnv()
+	}
+	file, err := LoadConfigFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	return file.Pantry(name, filepath.Dir(path))
+}
@@ -0,0 +1,130 @@
+package pantry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry/pantrytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfig writes a config file and a key file next to it, returning the
+// path of the config file
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "prod_key"), []byte("prod-key\n"), 0o600))
+	path := filepath.Join(dir, "pantries.json")
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Parallel()
+	path := writeConfig(t, `{
+		"default": "prod",
+		"pantries": [
+			{"name": "prod", "api_key_file": "prod_key"},
+			{"name": "staging", "api_key": "staging-key", "base_url": "http://localhost:8081/apiv1/pantry",
+			 "user_agent": "price-tracker/staging", "basket_prefix": "staging_", "timeout": "30s"}
+		]
+	}`)
+
+	cfg, err := LoadConfig(path, "")
+	require.NoError(t, err)
+	assert.Equal(t, Config{APIKey: "prod-key"}, cfg, "the default pantry, with the key file read relative to the config")
+
+	cfg, err = LoadConfig(path, "staging")
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		APIKey:       "staging-key",
+		BaseURL:      "http://localhost:8081/apiv1/pantry",
+		Timeout:      30 * time.Second,
+		UserAgent:    "price-tracker/staging",
+		BasketPrefix: "staging_",
+	}, cfg)
+
+	_, err = LoadConfig(path, "dev")
+	assert.ErrorContains(t, err, `unknown pantry "dev" (available: prod, staging)`)
+	_, err = LoadConfig("", "staging")
+	assert.ErrorContains(t, err, "without a Pantry config file")
+
+	t.Run("Single pantry", func(t *testing.T) {
+		t.Parallel()
+		cfg, err := LoadConfig(writeConfig(t, `{"pantries": [{"name": "only", "api_key": "key"}]}`), "")
+		require.NoError(t, err)
+		assert.Equal(t, "key", cfg.APIKey)
+	})
+
+	t.Run("No default", func(t *testing.T) {
+		t.Parallel()
+		_, err := LoadConfig(writeConfig(t, `{"pantries": [{"name": "a", "api_key": "k"}, {"name": "b", "api_key": "k"}]}`), "")
+		assert.ErrorContains(t, err, "no default pantry, select one of: a, b")
+	})
+
+	t.Run("Missing key file", func(t *testing.T) {
+		t.Parallel()
+		_, err := LoadConfig(writeConfig(t, `{"pantries": [{"name": "a", "api_key_file": "missing"}]}`), "")
+		assert.ErrorContains(t, err, `pantry "a": failed to read API key file`)
+	})
+}
+
+func TestConfigFileValidate(t *testing.T) {
+	t.Parallel()
+
+	_, err := LoadConfig(writeConfig(t, `{"pantries": [{"name": "a", "api_key": "k", "region": "eu"}]}`), "")
+	assert.ErrorContains(t, err, "unknown field")
+
+	err = ConfigFile{
+		Default: "missing",
+		Pantries: []PantryConfig{
+			{APIKey: "k"},
+			{Name: "a", APIKey: "k", APIKeyFile: "f"},
+			{Name: "a", Timeout: "-1s"},
+		},
+	}.Validate()
+	require.Error(t, err)
+	for _, want := range []string{
+		"pantry #1: name is required",
+		`pantry "a": exactly one of api_key and api_key_file is required`,
+		`pantry "a": duplicate name`,
+		`pantry "a": invalid timeout "-1s"`,
+		`default pantry "missing" is not configured`,
+	} {
+		assert.ErrorContains(t, err, want)
+	}
+	assert.ErrorContains(t, ConfigFile{}.Validate(), "no pantry configured")
+}
+
+func TestConfigSettings(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	srv := pantrytest.NewServer()
+	defer srv.Close()
+	m := NewBasketManager(Config{
+		APIKey:       pantrytest.DefaultKey,
+		BaseURL:      srv.BaseURL(),
+		UserAgent:    "price-tracker/test",
+		BasketPrefix: "staging_",
+	}, WithRateLimit(0, 0))
+
+	require.NoError(t, srv.SetBasket("prices_2025_06_17", storage.DailyPrices{Date: "2025-06-17"}))
+	require.NoError(t, m.SaveDay(ctx, storage.DailyPrices{Date: "2025-06-18"}))
+	assert.Equal(t, []string{"prices_2025_06_17", "staging_prices_2025_06_18"}, baskets(t, srv))
+
+	days, err := m.ListDays(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{time.Date(2025, 6, 18, 0, 0, 0, 0, time.UTC)}, days, "only days with the prefix")
+	day, err := m.LoadDay(ctx, days[0])
+	require.NoError(t, err)
+	assert.Equal(t, "2025-06-18", day.Date)
+
+	for _, req := range srv.Requests() {
+		assert.Equal(t, "price-tracker/test", req.Header.Get("User-Agent"))
+	}
+}
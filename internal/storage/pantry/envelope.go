@@ -0,0 +1,272 @@
+package pantry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	scraper "github.com/aliasthewho/price_tracker/internal/api/emmsa"
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// SchemaVersion is the version of the Envelope written by SaveDay.
+//
+// Version 1 is the bare storage.DailyPrices document stored before
+// envelopes were introduced, whose prices may still be the scraper.EMMSAPrice
+// rows of the first releases; version 2 wraps it in an Envelope.
+const SchemaVersion = 2
+
+// checksumPrefix names the algorithm of Envelope.Checksum
+const checksumPrefix = "sha256:"
+
+// Envelope is the document stored in the basket of a day. Its metadata
+// describes where the day comes from and lets readers detect baskets that
+// were truncated or edited by hand.
+type Envelope struct {
+	// SchemaVersion is the version the envelope was written in
+	SchemaVersion int `json:"schema_version"`
+	// Source lists the sources of the records, comma-separated and sorted
+	Source string `json:"source"`
+	// ScraperVersion is the version of the program that fetched the day,
+	// empty if unknown (see WithScraperVersion)
+	ScraperVersion string `json:"scraper_version"`
+	// FetchedAt is the RFC 3339 timestamp of when the day was fetched
+	FetchedAt string `json:"fetched_at"`
+	// RecordCount is the number of prices and volumes of the day
+	RecordCount int `json:"record_count"`
+	// Checksum is "sha256:" followed by the hex SHA-256 of the canonical
+	// JSON of Data (see dayChecksum)
+	Checksum string `json:"checksum"`
+	// Data is the day itself
+	Data storage.DailyPrices `json:"data"`
+}
+
+// NewEnvelope wraps the day in an Envelope of the current SchemaVersion,
+// computing its metadata
+func NewEnvelope(day storage.DailyPrices, scraperVersion string) (Envelope, error) {
+	data, err := json.Marshal(day)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("failed to encode day: %w", err)
+	}
+	checksum, err := dayChecksum(data)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		SchemaVersion:  SchemaVersion,
+		Source:         daySources(day),
+		ScraperVersion: scraperVersion,
+		FetchedAt:      day.Fetched,
+		RecordCount:    len(day.Prices) + len(day.Volumes),
+		Checksum:       checksum,
+		Data:           day,
+	}, nil
+}
+
+// Verify checks the record count and checksum against the data. Envelopes
+// read from Pantry are verified against the data as it was stored instead,
+// by DecodeEnvelope.
+func (e Envelope) Verify() error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode day: %w", err)
+	}
+	return e.verify(data)
+}
+
+// verify checks the record count against Data and the checksum against data,
+// the JSON document Data was decoded from
+func (e Envelope) verify(data []byte) error {
+	if count := len(e.Data.Prices) + len(e.Data.Volumes); count != e.RecordCount {
+		return fmt.Errorf("envelope holds %d records instead of %d", count, e.RecordCount)
+	}
+	checksum, err := dayChecksum(data)
+	if err != nil {
+		return err
+	}
+	if checksum != e.Checksum {
+		return fmt.Errorf("envelope checksum %s does not match its data (%s)", e.Checksum, checksum)
+	}
+	return nil
+}
+
+// dayChecksum returns the Envelope.Checksum of the JSON document of a day.
+// It is computed over the document decoded generically and re-encoded, with
+// sorted keys and float64 numbers, so that neither Pantry reformatting the
+// JSON nor a version of the tracker with more or fewer record fields than
+// the writer invalidates it.
+func dayChecksum(data []byte) (string, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("failed to decode day: %w", err)
+	}
+	canonical, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode day: %w", err)
+	}
+	sum := sha256.Sum256(canonical)
+	return checksumPrefix + hex.EncodeToString(sum[:]), nil
+}
+
+// daySources returns the sorted, comma-separated sources of the records
+func daySources(day storage.DailyPrices) string {
+	seen := map[string]bool{}
+	for _, p := range day.Prices {
+		seen[p.Source] = true
+	}
+	for _, v := range day.Volumes {
+		seen[v.Source] = true
+	}
+	delete(seen, "")
+	sources := make([]string, 0, len(seen))
+	for s := range seen {
+		sources = append(sources, s)
+	}
+	sort.Strings(sources)
+	return strings.Join(sources, ",")
+}
+
+// upgrades converts a document of the version it is keyed by into a
+// document of the next version
+var upgrades = map[int]func(data []byte) ([]byte, error){
+	1: upgradeV1,
+}
+
+// upgradeV1 wraps a bare DailyPrices document in an Envelope. The scraper
+// version of such days is unknown.
+//
+// The first releases stored the scraped scraper.EMMSAPrice rows as they
+// were, with "variedad" and "precio_*" keys instead of the fields of
+// source.PriceRecord. Every price is decoded in the shape it was written in,
+// so that such days keep their varieties and prices.
+func upgradeV1(data []byte) ([]byte, error) {
+	var doc struct {
+		Date    string                `json:"date"`
+		Prices  []json.RawMessage     `json:"prices"`
+		Volumes []source.VolumeRecord `json:"volumes,omitempty"`
+		Fetched string                `json:"fetched"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	day := storage.DailyPrices{Date: doc.Date, Volumes: doc.Volumes, Fetched: doc.Fetched}
+	for i, raw := range doc.Prices {
+		record, err := decodeV1Price(raw)
+		if err != nil {
+			return nil, fmt.Errorf("price %d: %w", i, err)
+		}
+		day.Prices = append(day.Prices, record)
+	}
+
+	env, err := NewEnvelope(day, "")
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+// decodeV1Price decodes a price of a version 1 document, written either as a
+// source.PriceRecord or as a scraper.EMMSAPrice
+func decodeV1Price(raw json.RawMessage) (source.PriceRecord, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return source.PriceRecord{}, err
+	}
+	if _, ok := keys["variedad"]; !ok {
+		var record source.PriceRecord
+		err := json.Unmarshal(raw, &record)
+		return record, err
+	}
+	var price scraper.EMMSAPrice
+	if err := json.Unmarshal(raw, &price); err != nil {
+		return source.PriceRecord{}, err
+	}
+	return scraper.ToPriceRecords([]scraper.EMMSAPrice{price})[0], nil
+}
+
+// schemaVersion returns the schema version of a stored document: its
+// schema_version field, or 1 if it has none
+func schemaVersion(data []byte) (int, error) {
+	var header struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return 0, err
+	}
+	if header.SchemaVersion == nil {
+		return 1, nil
+	}
+	return *header.SchemaVersion, nil
+}
+
+// DecodeEnvelope decodes a stored day of any schema version, upgrading it to
+// SchemaVersion and verifying it. It also returns the version data was
+// stored in.
+func DecodeEnvelope(data []byte) (Envelope, int, error) {
+	stored, err := schemaVersion(data)
+	if err != nil {
+		return Envelope{}, 0, err
+	}
+	if stored < 1 || stored > SchemaVersion {
+		return Envelope{}, stored, fmt.Errorf("unsupported schema version %d (this version reads 1 to %d)", stored, SchemaVersion)
+	}
+	for version := stored; version < SchemaVersion; version++ {
+		if data, err = upgrades[version](data); err != nil {
+			return Envelope{}, stored, fmt.Errorf("failed to upgrade schema version %d: %w", version, err)
+		}
+	}
+
+	var env Envelope
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&env); err != nil {
+		return Envelope{}, stored, err
+	}
+	// Verify the data as stored, including fields this version drops
+	var raw struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return Envelope{}, stored, err
+	}
+	if err := env.verify(raw.Data); err != nil {
+		return Envelope{}, stored, err
+	}
+	return env, stored, nil
+}
+
+// LoadEnvelope reads the envelope of the given date, upgrading it to
+// SchemaVersion. It also returns the version the basket is stored in, which
+// is below SchemaVersion until the basket is rewritten, e.g. by
+// SaveEnvelope. A missing basket returns ErrNotFound.
+func (m *BasketManager) LoadEnvelope(ctx context.Context, date time.Time) (Envelope, int, error) {
+	name := m.DayBasket(date)
+	raw, err := Get[json.RawMessage](ctx, m, name)
+	if err != nil {
+		return Envelope{}, 0, err
+	}
+	env, stored, err := DecodeEnvelope(raw)
+	if err != nil {
+		return Envelope{}, stored, fmt.Errorf("failed to decode basket %s: %w", name, err)
+	}
+	return env, stored, nil
+}
+
+// SaveEnvelope stores the envelope in the basket of its day, replacing the
+// basket
+func (m *BasketManager) SaveEnvelope(ctx context.Context, env Envelope) error {
+	date, err := env.Data.Day()
+	if err != nil {
+		return err
+	}
+	if err := Put(ctx, m, m.DayBasket(date), env); err != nil {
+		return fmt.Errorf("error storing basket: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package pantry
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDay is a day with records of two sources
+var testDay = storage.DailyPrices{
+	Date:    "2025-06-18",
+	Fetched: "2025-06-18T08:00:00Z",
+	Prices: []source.PriceRecord{
+		{Source: "emmsa", Product: "PAPA", Avg: 1.5},
+		{Source: "agro", Product: "CEBOLLA", Avg: 2},
+		{Source: "emmsa", Product: "PAPA", Variety: "AMARILLA", Avg: 3.25},
+	},
+	Volumes: []source.VolumeRecord{{Source: "emmsa", Product: "PAPA"}},
+}
+
+// assertBaselineDay checks that the day of testdata/v1_baseline.json kept
+// the varieties and prices of its EMMSA rows
+func assertBaselineDay(t *testing.T, day storage.DailyPrices) {
+	t.Helper()
+	assert.Equal(t, "2025-06-17", day.Date)
+	require.Len(t, day.Prices, 142)
+	assert.Equal(t, source.PriceRecord{
+		Date: "2025-06-17", Source: "emmsa", Market: "Gran Mercado Mayorista de Lima",
+		Product: "ACELGA", Variety: "ACELGA", Unit: "kg", Currency: "PEN",
+		Min: 3, Max: 3.5, Avg: 3.38,
+	}, day.Prices[0])
+	for _, p := range day.Prices {
+		assert.NotEmpty(t, p.Variety, "%s has a variety", p.Product)
+		assert.Positive(t, p.Avg, "%s has a price", p.Variety)
+	}
+}
+
+func TestNewEnvelope(t *testing.T) {
+	t.Parallel()
+	env, err := NewEnvelope(testDay, "v1.2.3")
+	require.NoError(t, err)
+
+	assert.Equal(t, SchemaVersion, env.SchemaVersion)
+	assert.Equal(t, "agro,emmsa", env.Source)
+	assert.Equal(t, "v1.2.3", env.ScraperVersion)
+	assert.Equal(t, "2025-06-18T08:00:00Z", env.FetchedAt)
+	assert.Equal(t, 4, env.RecordCount)
+	assert.True(t, strings.HasPrefix(env.Checksum, "sha256:"))
+	assert.Len(t, env.Checksum, len("sha256:")+64)
+	require.NoError(t, env.Verify())
+
+	tampered := env
+	tampered.Data.Prices = append([]source.PriceRecord(nil), env.Data.Prices...)
+	tampered.Data.Prices[0].Avg = 15
+	assert.ErrorContains(t, tampered.Verify(), "checksum")
+	tampered.Data.Prices = tampered.Data.Prices[1:]
+	assert.ErrorContains(t, tampered.Verify(), "holds 3 records instead of 4")
+}
+
+func TestDecodeEnvelope(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Version 1", func(t *testing.T) {
+		t.Parallel()
+		// A basket written by the first release, verbatim
+		data, err := os.ReadFile(filepath.Join("testdata", "v1_baseline.json"))
+		require.NoError(t, err)
+		env, stored, err := DecodeEnvelope(data)
+		require.NoError(t, err)
+		assert.Equal(t, 1, stored)
+		assert.Equal(t, SchemaVersion, env.SchemaVersion)
+		assert.Equal(t, "emmsa", env.Source)
+		assert.Equal(t, "2025-06-17T08:15:02-05:00", env.FetchedAt)
+		assert.Empty(t, env.ScraperVersion, "unknown for upgraded days")
+		assert.Equal(t, 142, env.RecordCount)
+		assertBaselineDay(t, env.Data)
+	})
+
+	t.Run("Version 1 with price records", func(t *testing.T) {
+		t.Parallel()
+		data, err := json.Marshal(testDay)
+		require.NoError(t, err)
+		env, stored, err := DecodeEnvelope(data)
+		require.NoError(t, err)
+		assert.Equal(t, 1, stored)
+		assert.Equal(t, testDay, env.Data)
+		assert.Equal(t, "agro,emmsa", env.Source)
+	})
+
+	t.Run("Current version", func(t *testing.T) {
+		t.Parallel()
+		want, err := NewEnvelope(testDay, "v1.2.3")
+		require.NoError(t, err)
+		data, err := json.Marshal(want)
+		require.NoError(t, err)
+		// Pantry may reformat the JSON it stores
+		reformatted := strings.ReplaceAll(string(data), `"avg":2}`, `"avg":2.00}`)
+		require.NotEqual(t, string(data), reformatted)
+		data = []byte(reformatted)
+		env, stored, err := DecodeEnvelope(data)
+		require.NoError(t, err)
+		assert.Equal(t, SchemaVersion, stored)
+		assert.Equal(t, want, env)
+	})
+
+	t.Run("Fields of another version", func(t *testing.T) {
+		t.Parallel()
+		// A tracker whose records have a field this version does not know
+		// wrote the envelope, checksumming the field
+		want, err := NewEnvelope(testDay, "v9.0.0")
+		require.NoError(t, err)
+		data, err := json.Marshal(want)
+		require.NoError(t, err)
+		var doc map[string]any
+		require.NoError(t, json.Unmarshal(data, &doc))
+		prices := doc["data"].(map[string]any)["prices"].([]any)
+		prices[0].(map[string]any)["grade"] = "extra"
+		day, err := json.Marshal(doc["data"])
+		require.NoError(t, err)
+		doc["checksum"], err = dayChecksum(day)
+		require.NoError(t, err)
+		data, err = json.MarshalIndent(doc, "", "  ")
+		require.NoError(t, err)
+
+		env, _, err := DecodeEnvelope(data)
+		require.NoError(t, err)
+		assert.Equal(t, testDay, env.Data)
+
+		// Changing a field this version drops is still detected
+		tampered := strings.Replace(string(data), `"extra"`, `"first"`, 1)
+		_, _, err = DecodeEnvelope([]byte(tampered))
+		assert.ErrorContains(t, err, "checksum")
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		t.Parallel()
+		_, _, err := DecodeEnvelope([]byte(`{"schema_version":3,"data":{}}`))
+		assert.ErrorContains(t, err, "unsupported schema version 3")
+		_, _, err = DecodeEnvelope([]byte(`{"schema_version":2,"record_count":1,"data":{"date":"2025-06-18"}}`))
+		assert.ErrorContains(t, err, "holds 0 records instead of 1")
+		_, _, err = DecodeEnvelope([]byte(`[]`))
+		assert.Error(t, err)
+	})
+}
+
+func TestEnvelopeStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	date := time.Date(2025, 6, 18, 0, 0, 0, 0, time.UTC)
+	m, fake := newFakeManager(t, nil, WithScraperVersion("v1.2.3"))
+
+	// A day stored before envelopes were introduced
+	require.NoError(t, fake.SetBasket(BasketName(date), testDay))
+	day, err := m.LoadDay(ctx, date)
+	require.NoError(t, err)
+	assert.Equal(t, testDay, day)
+	_, stored, err := m.LoadEnvelope(ctx, date)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stored, "reading does not rewrite the basket")
+
+	require.NoError(t, m.SaveDay(ctx, testDay))
+	data, ok, err := fake.Basket(BasketName(date))
+	require.NoError(t, err)
+	require.True(t, ok)
+	var raw map[string]any
+	require.NoError(t, json.Unmarshal(data, &raw))
+	assert.EqualValues(t, SchemaVersion, raw["schema_version"])
+	assert.Equal(t, "v1.2.3", raw["scraper_version"])
+	assert.EqualValues(t, 4, raw["record_count"])
+
+	env, stored, err := m.LoadEnvelope(ctx, date)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion, stored)
+	assert.Equal(t, testDay, env.Data)
+
+	t.Run("First release basket", func(t *testing.T) {
+		t.Parallel()
+		m, fake := newFakeManager(t, nil)
+		date := time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC)
+		data, err := os.ReadFile(filepath.Join("testdata", "v1_baseline.json"))
+		require.NoError(t, err)
+		require.NoError(t, fake.SetBasket(BasketName(date), json.RawMessage(data)))
+
+		// What pantry-cli migrate does
+		env, stored, err := m.LoadEnvelope(ctx, date)
+		require.NoError(t, err)
+		assert.Equal(t, 1, stored)
+		require.NoError(t, m.SaveEnvelope(ctx, env))
+
+		env, stored, err = m.LoadEnvelope(ctx, date)
+		require.NoError(t, err)
+		assert.Equal(t, SchemaVersion, stored)
+		assertBaselineDay(t, env.Data)
+	})
+}
@@ -0,0 +1,87 @@
+package pantry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// Errors returned by the BasketManager, wrapped in an *APIError. Check them
+// with errors.Is.
+var (
+	// ErrNotFound means the basket does not exist. It also matches
+	// storage.ErrNotFound.
+	ErrNotFound = fmt.Errorf("pantry: basket %w", storage.ErrNotFound)
+	// ErrRateLimited means Pantry rejected the request with 429 Too Many
+	// Requests, and kept doing so for every retry
+	ErrRateLimited = errors.New("pantry: rate limited")
+	// ErrUnauthorized means the API key is invalid or the pantry does not exist
+	ErrUnauthorized = errors.New("pantry: unauthorized")
+	// ErrBasketTooLarge means the payload exceeds the size Pantry accepts
+	ErrBasketTooLarge = errors.New("pantry: basket too large")
+)
+
+// APIError is returned when Pantry answers with a status other than 200
+type APIError struct {
+	// Op is the failed operation, e.g. "get basket prices_2025_06_18"
+	Op string
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// Message is the error message of the response, or its status text
+	Message string
+	// RetryAfter is the delay requested by the Retry-After header, if any
+	RetryAfter time.Duration
+
+	// kind is one of the Err* errors, or nil if the failure is not classified
+	kind error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("failed to %s: %s", e.Op, e.Message)
+}
+
+// Unwrap returns the Err* error the failure was classified as
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// classify returns the Err* error of a failed response. Pantry answers
+// requests for a missing basket with 400 Bad Request, so basketRead makes a
+// 400 without a more specific message mean ErrNotFound.
+func classify(status int, message string, basketRead bool) error {
+	msg := strings.ToLower(message)
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrUnauthorized
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusRequestEntityTooLarge:
+		return ErrBasketTooLarge
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status != http.StatusBadRequest:
+		return nil
+	case containsAny(msg, "too large", "size limit", "exceeds"):
+		return ErrBasketTooLarge
+	case strings.Contains(msg, "basket") && containsAny(msg, "not found", "does not exist", "could not get"):
+		return ErrNotFound
+	case strings.Contains(msg, "pantry") && containsAny(msg, "not found", "does not exist", "could not", "invalid"):
+		return ErrUnauthorized
+	case basketRead:
+		return ErrNotFound
+	}
+	return nil
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
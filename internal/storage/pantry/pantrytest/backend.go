@@ -0,0 +1,122 @@
+package pantrytest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Backend stores the contents of the fake baskets as JSON documents. The
+// Handler serializes its calls, so implementations need no locking of their
+// own.
+type Backend interface {
+	// Get returns the contents of a basket, and false if it does not exist
+	Get(name string) ([]byte, bool, error)
+	// Put creates or replaces a basket
+	Put(name string, data []byte) error
+	// Delete removes a basket, returning false if it did not exist
+	Delete(name string) (bool, error)
+	// List returns the names of every basket, sorted
+	List() ([]string, error)
+}
+
+// NewMemoryBackend returns a Backend keeping baskets in memory
+func NewMemoryBackend() Backend {
+	return &memoryBackend{baskets: make(map[string][]byte)}
+}
+
+type memoryBackend struct {
+	baskets map[string][]byte
+}
+
+func (b *memoryBackend) Get(name string) ([]byte, bool, error) {
+	data, ok := b.baskets[name]
+	return data, ok, nil
+}
+
+func (b *memoryBackend) Put(name string, data []byte) error {
+	b.baskets[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (b *memoryBackend) Delete(name string) (bool, error) {
+	_, ok := b.baskets[name]
+	delete(b.baskets, name)
+	return ok, nil
+}
+
+func (b *memoryBackend) List() ([]string, error) {
+	names := make([]string, 0, len(b.baskets))
+	for name := range b.baskets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// NewDirBackend returns a Backend keeping every basket in a <name>.json file
+// of the directory, which is created if needed. Baskets survive restarts, so
+// a fake started with pantry-cli serve-fake can be inspected with any editor.
+func NewDirBackend(dir string) (Backend, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create basket directory: %w", err)
+	}
+	return &dirBackend{dir: dir}, nil
+}
+
+type dirBackend struct {
+	dir string
+}
+
+func (b *dirBackend) path(name string) string {
+	return filepath.Join(b.dir, name+".json")
+}
+
+func (b *dirBackend) Get(name string) ([]byte, bool, error) {
+	data, err := os.ReadFile(b.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (b *dirBackend) Put(name string, data []byte) error {
+	tmp := b.path(name) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, b.path(name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (b *dirBackend) Delete(name string) (bool, error) {
+	err := os.Remove(b.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *dirBackend) List() ([]string, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,407 @@
+// Package pantrytest provides a fake Pantry server for tests and offline
+// development. It implements the part of the Pantry API used by the pantry
+// package: pantry details, listing baskets, and creating (POST), replacing
+// (POST), merging (PUT), reading and deleting baskets, with Pantry's size
+// limit, rate limiting and error responses.
+//
+// Example:
+//
+//	srv := pantrytest.NewServer()
+//	defer srv.Close()
+//	manager := pantry.NewBasketManager(pantry.Config{APIKey: pantrytest.DefaultKey},
+//	    pantry.WithBaseURL(srv.BaseURL()))
+package pantrytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BasePath is the path of the API below the server's URL
+const BasePath = "/apiv1/pantry"
+
+// DefaultKey is the only API key accepted unless WithKey is given
+const DefaultKey = "test-key"
+
+// DefaultMaxBasketSize is the largest basket Pantry accepts, in bytes of JSON
+const DefaultMaxBasketSize = 1_440_000
+
+// pantryCapacity is the storage of a pantry, used for percentFull
+const pantryCapacity = 100 << 20
+
+// basketTTL is the time to live reported for every basket, in seconds
+const basketTTL = 30 * 24 * 60 * 60
+
+// validName matches the basket names the fake accepts
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Request is a request received by the fake
+type Request struct {
+	// Method is the HTTP method
+	Method string
+	// Basket is the basket name, empty for requests on the pantry
+	Basket string
+	// Header holds the request headers
+	Header http.Header
+	// Body is the request body
+	Body []byte
+}
+
+// Option configures a Handler
+type Option func(*Handler)
+
+// WithKey sets the API key the fake accepts instead of DefaultKey
+func WithKey(key string) Option {
+	return func(h *Handler) {
+		h.key = key
+	}
+}
+
+// WithBackend sets where baskets are stored. The default is
+// NewMemoryBackend.
+func WithBackend(backend Backend) Option {
+	return func(h *Handler) {
+		h.backend = backend
+	}
+}
+
+// WithMaxBasketSize sets the largest basket accepted, in bytes of JSON.
+// The default is DefaultMaxBasketSize.
+func WithMaxBasketSize(size int) Option {
+	return func(h *Handler) {
+		h.maxSize = size
+	}
+}
+
+// WithRateLimit answers 429 Too Many Requests, with a Retry-After header,
+// to requests beyond rate per second. A rate of 0 (the default) disables
+// the limit.
+func WithRateLimit(rate int) Option {
+	return func(h *Handler) {
+		h.rate = rate
+	}
+}
+
+// Handler serves the fake Pantry API at BasePath. It is safe for concurrent
+// use.
+type Handler struct {
+	key     string
+	backend Backend
+	maxSize int
+	rate    int
+
+	mu       sync.Mutex
+	window   time.Time
+	count    int
+	failures []int
+	requests []Request
+}
+
+// NewHandler returns a fake Pantry API handler, e.g. to serve it on a fixed
+// address with http.ListenAndServe
+func NewHandler(opts ...Option) *Handler {
+	h := &Handler{key: DefaultKey, backend: NewMemoryBackend(), maxSize: DefaultMaxBasketSize}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Server is a Handler served by an httptest.Server
+type Server struct {
+	*httptest.Server
+	*Handler
+}
+
+// NewServer starts a fake Pantry server. Callers must Close it.
+func NewServer(opts ...Option) *Server {
+	h := NewHandler(opts...)
+	return &Server{Server: httptest.NewServer(h), Handler: h}
+}
+
+// BaseURL returns the URL to configure the pantry client with
+func (s *Server) BaseURL() string {
+	return s.URL + BasePath
+}
+
+// SetBasket creates or replaces a basket with data marshaled to JSON
+func (h *Handler) SetBasket(name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.backend.Put(name, payload)
+}
+
+// Basket returns the contents of a basket, and false if it does not exist
+func (h *Handler) Basket(name string) (json.RawMessage, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.backend.Get(name)
+}
+
+// Baskets returns the names of every basket, sorted
+func (h *Handler) Baskets() ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.backend.List()
+}
+
+// FailNext makes the next n requests fail with the given status code
+func (h *Handler) FailNext(n, status int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i := 0; i < n; i++ {
+		h.failures = append(h.failures, status)
+	}
+}
+
+// Requests returns the requests received so far
+func (h *Handler) Requests() []Request {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Request(nil), h.requests...)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest, ok := strings.CutPrefix(r.URL.Path, BasePath+"/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	key, resource, _ := strings.Cut(rest, "/")
+	basket, isBasket := strings.CutPrefix(resource, "basket/")
+	if isBasket && basket == "" || !isBasket && resource != "" && resource != "baskets" {
+		http.NotFound(w, r)
+		return
+	}
+	body := new(bytes.Buffer)
+	if _, err := body.ReadFrom(r.Body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests = append(h.requests, Request{Method: r.Method, Basket: basket, Header: r.Header.Clone(), Body: body.Bytes()})
+
+	if len(h.failures) > 0 {
+		status := h.failures[0]
+		h.failures = h.failures[1:]
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if h.limited(time.Now()) {
+		// The window ends within a second
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many requests, please try again later", http.StatusTooManyRequests)
+		return
+	}
+	if key != h.key {
+		http.Error(w, fmt.Sprintf("Could not find pantry with id: %s", key), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case isBasket:
+		h.basket(w, r, basket, body.Bytes())
+	case resource == "baskets":
+		h.list(w, r)
+	default:
+		h.details(w, r)
+	}
+}
+
+// limited counts the request in the current one-second window and reports
+// whether it exceeds the rate
+func (h *Handler) limited(now time.Time) bool {
+	if h.rate <= 0 {
+		return false
+	}
+	if now.Sub(h.window) >= time.Second {
+		h.window, h.count = now, 0
+	}
+	h.count++
+	return h.count > h.rate
+}
+
+// details answers GET /{key} with the pantry details
+func (h *Handler) details(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	names, err := h.backend.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type basketInfo struct {
+		Name string `json:"name"`
+		TTL  int    `json:"ttl"`
+	}
+	baskets := make([]basketInfo, 0, len(names))
+	size := 0
+	for _, name := range names {
+		data, _, err := h.backend.Get(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		size += len(data)
+		baskets = append(baskets, basketInfo{Name: name, TTL: basketTTL})
+	}
+	writeJSON(w, map[string]any{
+		"name":          "pantrytest",
+		"description":   "Fake pantry for tests and offline development",
+		"errors":        []string{},
+		"notifications": false,
+		"percentFull":   size * 100 / pantryCapacity,
+		"baskets":       baskets,
+	})
+}
+
+// list answers GET /{key}/baskets with the basket names
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	names, err := h.backend.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, names)
+}
+
+// basket answers the requests on /{key}/basket/{name}
+func (h *Handler) basket(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	if !validName.MatchString(name) {
+		http.Error(w, fmt.Sprintf("Invalid basket name: %s", name), http.StatusBadRequest)
+		return
+	}
+	current, exists, err := h.backend.Get(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists && r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("Could not get basket named %s", name), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(current)
+	case http.MethodDelete:
+		if _, err := h.backend.Delete(name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "%s was removed from your Pantry!", name)
+	case http.MethodPost:
+		if len(bytes.TrimSpace(body)) == 0 {
+			body = []byte("{}")
+		}
+		if _, ok := decodeObject(body); !ok {
+			http.Error(w, notObject, http.StatusBadRequest)
+			return
+		}
+		if !h.store(w, name, body) {
+			return
+		}
+		fmt.Fprintf(w, "Your Pantry was updated with basket: %s!", name)
+	case http.MethodPut:
+		update, ok := decodeObject(body)
+		if !ok {
+			http.Error(w, notObject, http.StatusBadRequest)
+			return
+		}
+		merged, ok := decodeObject(current)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Basket %s is not a JSON object", name), http.StatusInternalServerError)
+			return
+		}
+		deepMerge(merged, update)
+		data, err := json.Marshal(merged)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !h.store(w, name, data) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// store saves a basket, answering with an error and returning false if it
+// is too large or cannot be saved
+func (h *Handler) store(w http.ResponseWriter, name string, data []byte) bool {
+	if len(data) > h.maxSize {
+		http.Error(w, fmt.Sprintf("Basket size limit exceeded: %d bytes, the limit is %d", len(data), h.maxSize), http.StatusBadRequest)
+		return false
+	}
+	if err := h.backend.Put(name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// notObject is the error message of writes that are not a JSON object
+const notObject = "Basket contents must be a JSON object"
+
+// decodeObject decodes a JSON object, keeping numbers as written. It
+// returns false if data is not a JSON object.
+func decodeObject(data []byte) (map[string]any, bool) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var object map[string]any
+	if err := dec.Decode(&object); err != nil || object == nil {
+		return nil, false
+	}
+	return object, true
+}
+
+// deepMerge merges src into dst the way Pantry merges PUT requests: nested
+// objects are merged, arrays are appended to and other values overwritten
+func deepMerge(dst, src map[string]any) {
+	for k, v := range src {
+		switch v := v.(type) {
+		case map[string]any:
+			if d, ok := dst[k].(map[string]any); ok {
+				deepMerge(d, v)
+				continue
+			}
+		case []any:
+			if d, ok := dst[k].([]any); ok {
+				dst[k] = append(d, v...)
+				continue
+			}
+		}
+		dst[k] = v
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,127 @@
+package pantrytest
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// call sends a request to the path below the pantry of DefaultKey
+func call(t *testing.T, srv *Server, method, path, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.BaseURL()+"/"+DefaultKey+path, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, strings.TrimSpace(string(data))
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+	srv := NewServer(WithMaxBasketSize(100))
+	defer srv.Close()
+
+	status, body := call(t, srv, http.MethodGet, "/basket/notes", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Could not get basket named notes", body)
+
+	status, _ = call(t, srv, http.MethodPost, "/basket/notes", `{"a":1,"list":[1],"nested":{"x":1}}`)
+	assert.Equal(t, http.StatusOK, status)
+	status, body = call(t, srv, http.MethodPut, "/basket/notes", `{"b":2.50,"list":[2],"nested":{"y":2}}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"a":1,"b":2.50,"list":[1,2],"nested":{"x":1,"y":2}}`, body, "PUT deep-merges")
+
+	status, _ = call(t, srv, http.MethodPost, "/basket/notes", `{"c":3}`)
+	assert.Equal(t, http.StatusOK, status)
+	_, body = call(t, srv, http.MethodGet, "/basket/notes", "")
+	assert.JSONEq(t, `{"c":3}`, body, "POST replaces")
+
+	status, body = call(t, srv, http.MethodPut, "/basket/notes", `{"long":"`+strings.Repeat("x", 100)+`"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "size limit exceeded")
+	status, _ = call(t, srv, http.MethodPost, "/basket/notes", `[1]`)
+	assert.Equal(t, http.StatusBadRequest, status, "baskets are objects")
+	status, _ = call(t, srv, http.MethodPost, "/basket/no%20tes", `{}`)
+	assert.Equal(t, http.StatusBadRequest, status, "invalid name")
+
+	_, body = call(t, srv, http.MethodGet, "/baskets", "")
+	assert.JSONEq(t, `["notes"]`, body)
+	_, body = call(t, srv, http.MethodGet, "", "")
+	assert.Contains(t, body, `"baskets":[{"name":"notes","ttl":2592000}]`)
+
+	status, _ = call(t, srv, http.MethodDelete, "/basket/notes", "")
+	assert.Equal(t, http.StatusOK, status)
+	names, err := srv.Baskets()
+	require.NoError(t, err)
+	assert.Empty(t, names)
+	assert.Len(t, srv.Requests(), 11)
+}
+
+func TestServerErrors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Bad key", func(t *testing.T) {
+		t.Parallel()
+		srv := NewServer(WithKey("other"))
+		defer srv.Close()
+		status, body := call(t, srv, http.MethodGet, "/baskets", "")
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, "Could not find pantry with id: "+DefaultKey, body)
+	})
+
+	t.Run("Rate limit", func(t *testing.T) {
+		t.Parallel()
+		srv := NewServer(WithRateLimit(2))
+		defer srv.Close()
+		for range 2 {
+			status, _ := call(t, srv, http.MethodGet, "/baskets", "")
+			assert.Equal(t, http.StatusOK, status)
+		}
+		resp, err := http.Get(srv.BaseURL() + "/" + DefaultKey + "/baskets")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+	})
+
+	t.Run("FailNext", func(t *testing.T) {
+		t.Parallel()
+		srv := NewServer()
+		defer srv.Close()
+		srv.FailNext(1, http.StatusServiceUnavailable)
+		status, _ := call(t, srv, http.MethodGet, "/baskets", "")
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		status, _ = call(t, srv, http.MethodGet, "/baskets", "")
+		assert.Equal(t, http.StatusOK, status)
+	})
+}
+
+func TestDirBackend(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	backend, err := NewDirBackend(dir)
+	require.NoError(t, err)
+	srv := NewServer(WithBackend(backend))
+	status, _ := call(t, srv, http.MethodPost, "/basket/prices_2025_06_18", `{"date":"2025-06-18"}`)
+	require.Equal(t, http.StatusOK, status)
+	srv.Close()
+
+	// A new server on the same directory sees the basket
+	backend, err = NewDirBackend(dir)
+	require.NoError(t, err)
+	srv = NewServer(WithBackend(backend))
+	defer srv.Close()
+	_, body := call(t, srv, http.MethodGet, "/basket/prices_2025_06_18", "")
+	assert.JSONEq(t, `{"date":"2025-06-18"}`, body)
+	names, err := srv.Baskets()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prices_2025_06_18"}, names)
+}
@@ -0,0 +1,83 @@
+package pantry
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/aliasthewho/price_tracker/internal/retry"
+)
+
+// redactedKey replaces the API key in errors and logs
+const redactedKey = "REDACTED"
+
+// redact replaces every occurrence of the API key in s
+func (m *BasketManager) redact(s string) string {
+	if m.apiKey == "" {
+		return s
+	}
+	return strings.ReplaceAll(s, m.apiKey, redactedKey)
+}
+
+// redactError scrubs the API key from err. The key is part of every request
+// URL, which net/http errors quote, and Pantry repeats it in some error
+// messages (e.g. "Could not find pantry with id: ..."). The URL of a
+// *url.Error and the message of an *APIError are scrubbed in place, and any
+// other error still containing the key is wrapped in a *redactedError.
+func (m *BasketManager) redactError(err error) error {
+	if err == nil || m.apiKey == "" {
+		return err
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = m.redact(urlErr.URL)
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		apiErr.Op = m.redact(apiErr.Op)
+		apiErr.Message = m.redact(apiErr.Message)
+	}
+	if !strings.Contains(err.Error(), m.apiKey) {
+		return err
+	}
+	return &redactedError{err: err, key: m.apiKey}
+}
+
+// redactedError is an error whose message has the API key scrubbed. So has
+// the rest of its chain: Unwrap returns the wrapped error redacted in turn,
+// never the original. Is and As look through the original chain, so the
+// Err* errors and the types whose fields redactError scrubs are still found.
+type redactedError struct {
+	err error
+	key string
+}
+
+func (e *redactedError) Error() string {
+	return strings.ReplaceAll(e.err.Error(), e.key, redactedKey)
+}
+
+// Unwrap returns the error wrapped by the original one, redacted
+func (e *redactedError) Unwrap() error {
+	next := errors.Unwrap(e.err)
+	if next == nil {
+		return nil
+	}
+	return &redactedError{err: next, key: e.key}
+}
+
+// Is reports whether the original chain matches target, which only compares
+// errors and exposes none of them
+func (e *redactedError) Is(target error) bool {
+	return errors.Is(e.err, target)
+}
+
+// As finds an *APIError, *url.Error or transport failure in the original
+// chain. Their fields were scrubbed by redactError; other types are only
+// found if they are the redacted errors returned by Unwrap.
+func (e *redactedError) As(target any) bool {
+	switch target.(type) {
+	case **APIError, **url.Error, **retry.TransportError:
+		return errors.As(e.err, target)
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package pantry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry/pantrytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// secretKey is the API key that must never appear in errors or logs
+const secretKey = "9f1c2e4a-secret-pantry-key"
+
+// callEveryMethod calls every BasketManager method that can fail and returns
+// the errors by method name
+func callEveryMethod(m *BasketManager) map[string]error {
+	ctx := context.Background()
+	date := time.Date(2025, 6, 18, 0, 0, 0, 0, time.UTC)
+	name := BasketName(date)
+	data := map[string]any{"date": "2025-06-18"}
+	var target map[string]any
+
+	errs := map[string]error{
+		"CreateBasket":  m.CreateBasket(ctx, name),
+		"UpdateBasket":  m.UpdateBasket(ctx, name, data),
+		"ReplaceBasket": m.ReplaceBasket(ctx, name, data),
+		"MergeBasket":   m.MergeBasket(ctx, name, data),
+		"GetBasket":     m.GetBasket(ctx, name, &target),
+		"DeleteBasket":  m.DeleteBasket(ctx, name),
+		"PutSharded":    m.PutSharded(ctx, name, data, WriteReplace),
+		"GetSharded":    m.GetSharded(ctx, name, &target),
+		"DeleteSharded": m.DeleteSharded(ctx, name),
+		"SaveDay":       m.SaveDay(ctx, storage.DailyPrices{Date: "2025-06-18"}),
+		"DeleteDay":     m.DeleteDay(ctx, date),
+	}
+	_, errs["BasketExists"] = m.BasketExists(ctx, name)
+	_, errs["ListBaskets"] = m.ListBaskets(ctx)
+	_, errs["LoadDay"] = m.LoadDay(ctx, date)
+	_, errs["ListDays"] = m.ListDays(ctx)
+	return errs
+}
+
+// secretError is an error type whose message has the secret key
+type secretError struct{}
+
+func (*secretError) Error() string { return "pantry " + secretKey + " is gone" }
+
+// assertRedacted checks that no error of the chain of err has the secret key
+// in its message
+func assertRedacted(t *testing.T, err error, msgAndArgs ...any) {
+	t.Helper()
+	for ; err != nil; err = errors.Unwrap(err) {
+		assert.NotContains(t, err.Error(), secretKey, msgAndArgs...)
+	}
+}
+
+// Not parallel: it captures the output of the standard logger
+func TestRedactAPIKey(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	retry := WithRetryPolicy(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	newManager := func(baseURL string) *BasketManager {
+		return NewBasketManager(Config{APIKey: secretKey, BaseURL: baseURL}, retry, WithRateLimit(0, 0))
+	}
+
+	// Pantry repeats the key of an unknown pantry in its error message
+	unknown := pantrytest.NewServer()
+	defer unknown.Close()
+	// Failures to connect quote the request URL
+	closed := pantrytest.NewServer()
+	closed.Close()
+	// Building a request quotes the URL too
+	invalid := "http://127.0.0.1:1/apiv1/pantry\x7f"
+
+	for server, baseURL := range map[string]string{
+		"unknown pantry": unknown.BaseURL(),
+		"unreachable":    closed.BaseURL(),
+		"invalid URL":    invalid,
+	} {
+		for method, err := range callEveryMethod(newManager(baseURL)) {
+			require.Error(t, err, "%s: %s", server, method)
+			assertRedacted(t, err, "%s: %s", server, method)
+		}
+	}
+	assert.Contains(t, logs.String(), "retrying", "the unreachable server is retried")
+	assert.NotContains(t, logs.String(), secretKey)
+
+	t.Run("Errors keep their type", func(t *testing.T) {
+		err := newManager(unknown.BaseURL()).GetBasket(context.Background(), "notes", nil)
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+		assert.Equal(t, "Could not find pantry with id: "+redactedKey, apiErr.Message)
+
+		err = newManager(closed.BaseURL()).GetBasket(context.Background(), "notes", nil)
+		assert.True(t, isRetryable(err))
+		assert.False(t, errors.Is(err, ErrNotFound))
+	})
+
+	t.Run("Wrapped chains are redacted", func(t *testing.T) {
+		m := newManager(unknown.BaseURL())
+		keyErr := &secretError{}
+		err := m.redactError(fmt.Errorf("failed to list baskets: %w", fmt.Errorf("pantry %s: %w", secretKey,
+			&APIError{Op: "get pantry " + secretKey, StatusCode: http.StatusBadRequest, kind: ErrUnauthorized,
+				Message: "pantry " + secretKey + " is gone"})))
+
+		assertRedacted(t, err)
+		assert.Equal(t, "failed to list baskets: pantry REDACTED: failed to get pantry REDACTED: pantry REDACTED is gone", err.Error())
+		assert.ErrorIs(t, err, ErrUnauthorized)
+		var apiErr *APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, "get pantry "+redactedKey, apiErr.Op)
+
+		err = m.redactError(fmt.Errorf("decode: %w", keyErr))
+		assertRedacted(t, err)
+		assert.ErrorIs(t, err, keyErr, "errors.Is still matches the original errors")
+		var secret *secretError
+		assert.False(t, errors.As(err, &secret), "errors.As does not hand out errors that were not scrubbed")
+	})
+}
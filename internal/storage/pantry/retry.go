@@ -0,0 +1,142 @@
+package pantry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/retry"
+)
+
+// RetryPolicy controls how failed Pantry requests are retried.
+//
+// Only transient failures are retried: transport errors, timeouts, 429 and
+// 5xx responses. A Retry-After header replaces the computed delay, even if it
+// is over MaxBackoff.
+type RetryPolicy = retry.Policy
+
+// DefaultRetryPolicy returns the retry policy used by NewBasketManager
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// isRetryable reports whether a failed request may succeed if retried. An
+// attempt that hit the client timeout is retried; the caller giving up is
+// checked on its context by do.
+func isRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return retry.IsTransport(err)
+}
+
+// isRetryableRequest reports whether a failed request of the method may be
+// sent again. A PUT deep-merges and appends arrays, so sending it again after
+// Pantry applied it duplicates records; it is only retried after a 429,
+// which Pantry answers without applying the request.
+func isRetryableRequest(method string, err error) bool {
+	if method != http.MethodPut {
+		return isRetryable(err)
+	}
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an
+// HTTP date, returning 0 if it is absent or invalid
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
+
+// DefaultRateLimit and DefaultBurst are the client-side rate limit of
+// NewBasketManager, which keeps a backfill under Pantry's per-key limit
+const (
+	DefaultRateLimit = 2 // requests per second
+	DefaultBurst     = 4
+)
+
+// limiter is a token bucket shared by every request of a BasketManager
+type limiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	// paused delays every request until then, set when Pantry sends Retry-After
+	paused time.Time
+}
+
+// newLimiter returns a limiter of rate requests per second, or nil (no
+// limit) if rate is not positive
+func newLimiter(rate float64, burst int) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(max(burst, 1))
+	return &limiter{rate: rate, burst: b, tokens: b}
+}
+
+// wait blocks until a request may be sent
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		if !l.last.IsZero() {
+			l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		}
+		l.last = now
+
+		var delay time.Duration
+		switch {
+		case now.Before(l.paused):
+			delay = l.paused.Sub(now)
+		case l.tokens >= 1:
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		default:
+			delay = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+		l.mu.Unlock()
+
+		if err := retry.Sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// pause holds back every request for d, as asked by a Retry-After header
+func (l *limiter) pause(d time.Duration) {
+	if l == nil || d <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.paused) {
+		l.paused = until
+	}
+}
@@ -0,0 +1,246 @@
+package pantry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastRetries retries without waiting
+var fastRetries = WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+// newTestManager returns a manager sending requests to handler, counting them
+func newTestManager(t *testing.T, handler http.HandlerFunc, opts ...Option) (*BasketManager, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	opts = append([]Option{WithRateLimit(0, 0), WithBaseURL(server.URL + "/apiv1/pantry")}, opts...)
+	return NewBasketManager(Config{APIKey: "test-key"}, opts...), &requests
+}
+
+// respond returns a handler answering with the status and JSON message
+func respond(t *testing.T, status int, message string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if err := writeJSON(t, w, ErrorResponse{Message: message}); err != nil {
+			t.Errorf("Failed to write JSON response: %v", err)
+		}
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		status  int
+		message string
+		call    func(m *BasketManager) error
+		want    error
+	}{
+		{
+			name: "missing basket", status: http.StatusBadRequest, message: "Could not get basket named x",
+			call: func(m *BasketManager) error { return m.GetBasket(ctx, "x", &map[string]any{}) },
+			want: ErrNotFound,
+		},
+		{
+			name: "missing basket without message", status: http.StatusBadRequest,
+			call: func(m *BasketManager) error { return m.DeleteBasket(ctx, "x") },
+			want: storage.ErrNotFound,
+		},
+		{
+			name: "invalid key", status: http.StatusUnauthorized, message: "Unauthorized",
+			call: func(m *BasketManager) error { _, err := m.ListBaskets(ctx); return err },
+			want: ErrUnauthorized,
+		},
+		{
+			name: "missing pantry", status: http.StatusBadRequest, message: "Could not find pantry test-key",
+			call: func(m *BasketManager) error { _, err := m.BasketExists(ctx, "x"); return err },
+			want: ErrUnauthorized,
+		},
+		{
+			name: "too large", status: http.StatusBadRequest, message: "Basket size limit exceeded",
+			call: func(m *BasketManager) error { return m.UpdateBasket(ctx, "x", map[string]string{}) },
+			want: ErrBasketTooLarge,
+		},
+		{
+			name: "rate limited", status: http.StatusTooManyRequests, message: "Too many requests",
+			call: func(m *BasketManager) error { _, err := m.BasketExists(ctx, "x"); return err },
+			want: ErrRateLimited,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			m, _ := newTestManager(t, respond(t, tt.status, tt.message), fastRetries)
+			err := tt.call(m)
+			require.ErrorIs(t, err, tt.want)
+
+			var apiErr *APIError
+			require.ErrorAs(t, err, &apiErr)
+			assert.Equal(t, tt.status, apiErr.StatusCode)
+		})
+	}
+
+	t.Run("bad request on update", func(t *testing.T) {
+		t.Parallel()
+		m, _ := newTestManager(t, respond(t, http.StatusBadRequest, "invalid data"))
+		err := m.UpdateBasket(ctx, "x", map[string]string{})
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrNotFound)
+		assert.EqualError(t, err, "failed to update basket x: invalid data")
+	})
+}
+
+func TestBasketExistsErrors(t *testing.T) {
+	t.Parallel()
+
+	m, requests := newTestManager(t, respond(t, http.StatusInternalServerError, "boom"), fastRetries)
+	exists, err := m.BasketExists(context.Background(), "x")
+	assert.False(t, exists)
+	require.Error(t, err, "a server error is not a missing basket")
+	assert.Equal(t, int32(3), requests.Load(), "server errors are retried")
+}
+
+func TestRetries(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	t.Run("Transient failures", func(t *testing.T) {
+		t.Parallel()
+		var calls atomic.Int32
+		m, requests := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if err := writeJSON(t, w, []string{"prices_2025_06_18"}); err != nil {
+				t.Errorf("Failed to write JSON response: %v", err)
+			}
+		}, fastRetries)
+
+		baskets, err := m.ListBaskets(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"prices_2025_06_18"}, baskets)
+		assert.Equal(t, int32(3), requests.Load())
+	})
+
+	t.Run("Client errors are not retried", func(t *testing.T) {
+		t.Parallel()
+		m, requests := newTestManager(t, respond(t, http.StatusBadRequest, "invalid data"), fastRetries)
+		require.Error(t, m.UpdateBasket(ctx, "x", map[string]string{}))
+		assert.Equal(t, int32(1), requests.Load())
+	})
+
+	t.Run("Retry-After", func(t *testing.T) {
+		t.Parallel()
+		var calls atomic.Int32
+		m, _ := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}, fastRetries, WithRateLimit(100, 1))
+
+		start := time.Now()
+		require.NoError(t, m.CreateBasket(ctx, "x"))
+		assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond, "the retry waits for Retry-After")
+	})
+
+	t.Run("Timeouts", func(t *testing.T) {
+		t.Parallel()
+		release := make(chan struct{})
+		var calls atomic.Int32
+		m, requests := newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				<-release
+				return
+			}
+			if err := writeJSON(t, w, []string{"prices_2025_06_18"}); err != nil {
+				t.Errorf("Failed to write JSON response: %v", err)
+			}
+		}, fastRetries, WithHTTPClient(&http.Client{Timeout: 50 * time.Millisecond}))
+		t.Cleanup(func() { close(release) })
+
+		baskets, err := m.ListBaskets(ctx)
+		require.NoError(t, err, "the attempt that timed out is retried")
+		assert.Equal(t, []string{"prices_2025_06_18"}, baskets)
+		assert.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("Merges are retried only when rate limited", func(t *testing.T) {
+		t.Parallel()
+		m, requests := newTestManager(t, respond(t, http.StatusServiceUnavailable, "down"), fastRetries)
+		require.Error(t, m.MergeBasket(ctx, "x", map[string]any{"prices": []int{1}}))
+		assert.Equal(t, int32(1), requests.Load(), "a 5xx merge may have been applied")
+
+		m, requests = newTestManager(t, respond(t, http.StatusServiceUnavailable, "down"), fastRetries)
+		require.Error(t, m.ReplaceBasket(ctx, "x", map[string]any{"prices": []int{1}}))
+		assert.Equal(t, int32(3), requests.Load(), "replacing is idempotent")
+
+		var calls atomic.Int32
+		m, requests = newTestManager(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				respond(t, http.StatusTooManyRequests, "slow down")(w, r)
+			}
+		}, fastRetries)
+		require.NoError(t, m.MergeBasket(ctx, "x", map[string]any{"prices": []int{1}}))
+		assert.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		t.Parallel()
+		m, _ := newTestManager(t, respond(t, http.StatusServiceUnavailable, "down"),
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}))
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, m.CreateBasket(ctx, "x"), context.DeadlineExceeded)
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2025, 6, 18, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(t, 30*time.Second, parseRetryAfter("Wed, 18 Jun 2025 12:00:30 GMT", now))
+	assert.Zero(t, parseRetryAfter("Wed, 18 Jun 2025 11:00:00 GMT", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+	assert.Zero(t, parseRetryAfter("", now))
+}
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	l := newLimiter(50, 2)
+	start := time.Now()
+	for range 7 {
+		require.NoError(t, l.wait(ctx))
+	}
+	// 2 requests of burst, then 5 more at 50 per second
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	l.pause(time.Hour)
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.wait(ctx), context.DeadlineExceeded, "requests wait while paused")
+
+	assert.Nil(t, newLimiter(0, 5), "a rate of 0 disables the limit")
+	assert.NoError(t, (*limiter)(nil).wait(ctx))
+}
@@ -0,0 +1,313 @@
+package pantry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxBasketSize is the largest basket, in bytes of JSON, written
+// without sharding. Pantry rejects baskets over 1.44 MB; the default keeps a
+// margin under it.
+const DefaultMaxBasketSize = 1_400_000
+
+// nearLimitRatio is the share of the size limit from which writes are logged
+// as close to the limit
+const nearLimitRatio = 0.8
+
+// shardOverhead is reserved in every part basket for the JSON around the data
+const shardOverhead = 64
+
+// Manifest replaces the content of a basket whose payload is split across
+// part baskets named by PartName
+type Manifest struct {
+	// Parts is the number of part baskets
+	Parts int `json:"parts"`
+	// Size is the length of the reassembled JSON payload
+	Size int `json:"size"`
+	// SHA256 is the hex-encoded checksum of the reassembled payload
+	SHA256 string `json:"sha256"`
+}
+
+// manifestBasket is a basket holding a manifest
+type manifestBasket struct {
+	Shards *Manifest `json:"shards"`
+}
+
+// partBasket is a basket holding a chunk of a sharded payload
+type partBasket struct {
+	Shard struct {
+		Index int    `json:"index"`
+		Data  string `json:"data"`
+	} `json:"shard"`
+}
+
+// PartName returns the name of the nth part (1-based) of a sharded basket,
+// e.g. "prices_2025_06_18_part2"
+func PartName(basketName string, n int) string {
+	return fmt.Sprintf("%s_part%d", basketName, n)
+}
+
+// SizeEstimate describes how a payload fits in a basket
+type SizeEstimate struct {
+	// Bytes is the length of the JSON payload
+	Bytes int
+	// Limit is the largest basket written without sharding
+	Limit int
+	// Shards is the number of part baskets needed, 0 if the payload fits in
+	// a single basket
+	Shards int
+}
+
+// NearLimit reports whether the payload uses most of the size limit, or
+// needs sharding
+func (e SizeEstimate) NearLimit() bool {
+	return float64(e.Bytes) >= float64(e.Limit)*nearLimitRatio
+}
+
+// EstimateSize returns the size data takes in a basket, and how many part
+// baskets PutSharded would split it into.
+//
+// Example:
+//
+//	estimate, err := manager.EstimateSize(day)
+//	if err == nil && estimate.NearLimit() {
+//	    log.Printf("day uses %d of %d bytes", estimate.Bytes, estimate.Limit)
+//	}
+func (m *BasketManager) EstimateSize(data any) (SizeEstimate, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return SizeEstimate{}, fmt.Errorf("failed to marshal data: %w", err)
+	}
+	return m.estimate(payload), nil
+}
+
+func (m *BasketManager) estimate(payload []byte) SizeEstimate {
+	e := SizeEstimate{Bytes: len(payload), Limit: m.maxBasketSize}
+	if e.Bytes > e.Limit {
+		e.Shards = len(splitPayload(payload, e.Limit-shardOverhead))
+	}
+	return e
+}
+
+// PutSharded writes data to a basket, splitting it across part baskets and
+// writing a Manifest in its place if it exceeds the size limit.
+//
+// With WriteReplace the basket is created or replaced, and parts left over
+// from a larger previous payload are deleted. With WriteMerge the payload is
+// merged like MergeBasket does, creating the basket first if needed; sharded
+// baskets cannot be merged into, and neither can payloads that need sharding.
+//
+// Example:
+//
+//	if err := manager.PutSharded(ctx, "prices_2025_06_18", day, WriteReplace); err != nil {
+//	    return fmt.Errorf("failed to store day: %w", err)
+//	}
+func (m *BasketManager) PutSharded(ctx context.Context, basketName string, data any, mode WriteMode) error {
+	if mode != WriteReplace && mode != WriteMerge {
+		return fmt.Errorf("unknown write mode %q", mode)
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %w", err)
+	}
+	estimate := m.estimate(payload)
+
+	old, exists, err := m.manifest(ctx, basketName)
+	if err != nil {
+		return err
+	}
+	if mode == WriteMerge && (old != nil || estimate.Shards > 0) {
+		return fmt.Errorf("cannot merge into basket %s: it is sharded or would be, replace it instead", basketName)
+	}
+
+	if estimate.Shards == 0 {
+		if estimate.NearLimit() {
+			log.Printf("Basket %s uses %d of %d bytes", basketName, estimate.Bytes, estimate.Limit)
+		}
+		if mode == WriteMerge {
+			if !exists {
+				if err := m.CreateBasket(ctx, basketName); err != nil {
+					return err
+				}
+			}
+			return m.MergeBasket(ctx, basketName, json.RawMessage(payload))
+		}
+		if err := m.replaceBasket(ctx, basketName, payload); err != nil {
+			return err
+		}
+		if old != nil {
+			return m.deleteParts(ctx, basketName, 1, old.Parts)
+		}
+		return nil
+	}
+
+	parts := splitPayload(payload, estimate.Limit-shardOverhead)
+	log.Printf("Basket %s is %d bytes, over the %d byte limit: storing it in %d parts",
+		basketName, estimate.Bytes, estimate.Limit, len(parts))
+	for i, chunk := range parts {
+		var part partBasket
+		part.Shard.Index, part.Shard.Data = i+1, chunk
+		body, err := json.Marshal(part)
+		if err != nil {
+			return fmt.Errorf("failed to marshal part %d: %w", i+1, err)
+		}
+		if err := m.replaceBasket(ctx, PartName(basketName, i+1), body); err != nil {
+			return err
+		}
+	}
+
+	// The manifest goes last, so readers never see one without its parts
+	sum := sha256.Sum256(payload)
+	manifest := Manifest{Parts: len(parts), Size: len(payload), SHA256: hex.EncodeToString(sum[:])}
+	body, err := json.Marshal(manifestBasket{Shards: &manifest})
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := m.replaceBasket(ctx, basketName, body); err != nil {
+		return err
+	}
+	if old != nil && old.Parts > len(parts) {
+		return m.deleteParts(ctx, basketName, len(parts)+1, old.Parts)
+	}
+	return nil
+}
+
+// GetSharded reads a basket written by PutSharded into the target,
+// reassembling and verifying its parts if it holds a Manifest. Baskets
+// without a manifest are read like GetBasket does.
+func (m *BasketManager) GetSharded(ctx context.Context, basketName string, target any) error {
+	var raw json.RawMessage
+	if err := m.GetBasket(ctx, basketName, &raw); err != nil {
+		return err
+	}
+	manifest, err := parseManifest(raw)
+	if err != nil {
+		return fmt.Errorf("failed to decode basket %s: %w", basketName, err)
+	}
+	if manifest == nil {
+		if err := json.Unmarshal(raw, target); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	}
+
+	var payload strings.Builder
+	payload.Grow(manifest.Size)
+	for n := 1; n <= manifest.Parts; n++ {
+		var part partBasket
+		if err := m.GetBasket(ctx, PartName(basketName, n), &part); err != nil {
+			return fmt.Errorf("failed to read part %d of %s: %w", n, basketName, err)
+		}
+		if part.Shard.Index != n {
+			return fmt.Errorf("basket %s holds part %d instead of %d", PartName(basketName, n), part.Shard.Index, n)
+		}
+		payload.WriteString(part.Shard.Data)
+	}
+
+	sum := sha256.Sum256([]byte(payload.String()))
+	if payload.Len() != manifest.Size || hex.EncodeToString(sum[:]) != manifest.SHA256 {
+		return fmt.Errorf("parts of basket %s do not match its manifest, it may be being rewritten", basketName)
+	}
+	if err := json.Unmarshal([]byte(payload.String()), target); err != nil {
+		return fmt.Errorf("failed to decode basket %s: %w", basketName, err)
+	}
+	return nil
+}
+
+// DeleteSharded deletes a basket and, if it holds a Manifest, its parts
+func (m *BasketManager) DeleteSharded(ctx context.Context, basketName string) error {
+	manifest, _, err := m.manifest(ctx, basketName)
+	if err != nil {
+		return err
+	}
+	// A missing basket fails here with ErrNotFound
+	if err := m.DeleteBasket(ctx, basketName); err != nil {
+		return err
+	}
+	if manifest != nil {
+		return m.deleteParts(ctx, basketName, 1, manifest.Parts)
+	}
+	return nil
+}
+
+// manifest returns the manifest of a basket, nil if it holds a plain
+// payload, and whether the basket exists
+func (m *BasketManager) manifest(ctx context.Context, basketName string) (*Manifest, bool, error) {
+	var raw json.RawMessage
+	err := m.GetBasket(ctx, basketName, &raw)
+	if errors.Is(err, ErrNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	manifest, err := parseManifest(raw)
+	if err != nil {
+		return nil, true, fmt.Errorf("failed to decode basket %s: %w", basketName, err)
+	}
+	return manifest, true, nil
+}
+
+// parseManifest returns the manifest of a basket's content, or nil if it
+// holds a plain payload
+func parseManifest(raw json.RawMessage) (*Manifest, error) {
+	// Only objects can hold a manifest
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, nil
+	}
+	var basket manifestBasket
+	if err := json.Unmarshal(raw, &basket); err != nil {
+		return nil, err
+	}
+	if basket.Shards != nil && basket.Shards.Parts < 1 {
+		return nil, fmt.Errorf("manifest with %d parts", basket.Shards.Parts)
+	}
+	return basket.Shards, nil
+}
+
+// deleteParts deletes the parts from..to of a basket, ignoring missing ones
+func (m *BasketManager) deleteParts(ctx context.Context, basketName string, from, to int) error {
+	for n := from; n <= to; n++ {
+		if err := m.DeleteBasket(ctx, PartName(basketName, n)); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitPayload splits a JSON payload into chunks whose JSON string encoding
+// fits in budget bytes, cutting between UTF-8 characters
+func splitPayload(payload []byte, budget int) []string {
+	budget = max(budget, 16)
+	var chunks []string
+	start, size := 0, 2 // the quotes around the string
+	for i := 0; i < len(payload); {
+		r, width := utf8.DecodeRune(payload[i:])
+		cost := width
+		switch {
+		case r == '"' || r == '\\':
+			cost = 2
+		case r < 0x20 || r == '<' || r == '>' || r == '&' || r == '\u2028' || r == '\u2029':
+			// \u00XX escapes, including the HTML escaping of json.Marshal
+			cost = 6
+		}
+		if size+cost > budget && i > start {
+			chunks = append(chunks, string(payload[start:i]))
+			start, size = i, 2
+		}
+		size += cost
+		i += width
+	}
+	if start < len(payload) {
+		chunks = append(chunks, string(payload[start:]))
+	}
+	return chunks
+}
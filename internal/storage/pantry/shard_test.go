@@ -0,0 +1,130 @@
+package pantry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry/pantrytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeManager returns a manager using a pantrytest server
+func newFakeManager(t *testing.T, fakeOpts []pantrytest.Option, opts ...Option) (*BasketManager, *pantrytest.Server) {
+	t.Helper()
+	srv := pantrytest.NewServer(fakeOpts...)
+	t.Cleanup(srv.Close)
+	cfg := Config{APIKey: pantrytest.DefaultKey, BaseURL: srv.BaseURL()}
+	return NewBasketManager(cfg, append([]Option{WithRateLimit(0, 0)}, opts...)...), srv
+}
+
+// baskets returns the names of the baskets of the fake
+func baskets(t *testing.T, srv *pantrytest.Server) []string {
+	t.Helper()
+	names, err := srv.Baskets()
+	require.NoError(t, err)
+	return names
+}
+
+// bigDay returns a day whose JSON takes at least size bytes, with characters
+// json.Marshal escapes
+func bigDay(date string, size int) storage.DailyPrices {
+	day := storage.DailyPrices{Date: date, Fetched: date + "T08:00:00Z"}
+	for i := 0; day.Prices == nil || i*60 < size; i++ {
+		day.Prices = append(day.Prices, source.PriceRecord{
+			Market:  "Mercado <Santa Anita> & \"Lima\"",
+			Product: fmt.Sprintf("Papa amarilla ñ %d", i),
+		})
+	}
+	return day
+}
+
+// envelope returns the envelope SaveDay stores for the day
+func envelope(t *testing.T, day storage.DailyPrices) Envelope {
+	t.Helper()
+	env, err := NewEnvelope(day, "")
+	require.NoError(t, err)
+	return env
+}
+
+func TestSharding(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	date := time.Date(2025, 6, 18, 0, 0, 0, 0, time.UTC)
+	name := BasketName(date)
+
+	m, fake := newFakeManager(t, []pantrytest.Option{pantrytest.WithMaxBasketSize(2_000)}, WithMaxBasketSize(1_000))
+
+	small := bigDay("2025-06-18", 0)
+	estimate, err := m.EstimateSize(envelope(t, small))
+	require.NoError(t, err)
+	assert.Zero(t, estimate.Shards)
+	assert.False(t, estimate.NearLimit())
+
+	large := bigDay("2025-06-18", 5_000)
+	estimate, err = m.EstimateSize(envelope(t, large))
+	require.NoError(t, err)
+	assert.Greater(t, estimate.Shards, 4)
+	assert.True(t, estimate.NearLimit())
+
+	t.Run("Round trip", func(t *testing.T) {
+		require.NoError(t, m.SaveDay(ctx, large))
+		assert.Len(t, baskets(t, fake), estimate.Shards+1, "the manifest and its parts")
+
+		day, err := m.LoadDay(ctx, date)
+		require.NoError(t, err)
+		assert.Equal(t, large, day)
+
+		days, err := m.ListDays(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{date}, days, "parts are not listed as days")
+	})
+
+	t.Run("Shrinking removes parts", func(t *testing.T) {
+		smaller := bigDay("2025-06-18", 2_500)
+		require.NoError(t, m.SaveDay(ctx, smaller))
+		estimate, err := m.EstimateSize(envelope(t, smaller))
+		require.NoError(t, err)
+		assert.Len(t, baskets(t, fake), estimate.Shards+1)
+
+		require.NoError(t, m.SaveDay(ctx, small))
+		assert.Equal(t, []string{name}, baskets(t, fake))
+		day, err := m.LoadDay(ctx, date)
+		require.NoError(t, err)
+		assert.Equal(t, small, day)
+	})
+
+	t.Run("Corrupted part", func(t *testing.T) {
+		require.NoError(t, m.SaveDay(ctx, large))
+		require.NoError(t, fake.SetBasket(PartName(name, 2), map[string]any{"shard": map[string]any{"index": 2, "data": "x"}}))
+
+		_, err := m.LoadDay(ctx, date)
+		assert.ErrorContains(t, err, "do not match its manifest")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, m.SaveDay(ctx, large))
+		require.NoError(t, m.DeleteDay(ctx, date))
+		assert.Empty(t, baskets(t, fake))
+		assert.ErrorIs(t, m.DeleteDay(ctx, date), storage.ErrNotFound)
+	})
+}
+
+func TestSplitPayload(t *testing.T) {
+	t.Parallel()
+
+	payload := []byte(`{"a":"<ñ>\"€` + "\u2028\t" + strings.Repeat("x", 100) + `"}`)
+	chunks := splitPayload(payload, 20)
+	assert.Equal(t, string(payload), strings.Join(chunks, ""))
+	for _, chunk := range chunks {
+		encoded, err := json.Marshal(chunk)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(encoded), 20, "chunk %q", chunk)
+	}
+}
@@ -0,0 +1,145 @@
+package pantry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+)
+
+// BasketManager stores one basket per day, named by DayBasket
+var _ storage.Store = (*BasketManager)(nil)
+
+// SaveDay stores the day in the basket named after its date, wrapped in an
+// Envelope of the current SchemaVersion. The basket is replaced, or, with
+// WriteMerge (see WithWriteMode), the day's records are merged into those of
+// the stored day, see mergeDay. Days over the basket size limit are
+// split into part baskets, see PutSharded.
+func (m *BasketManager) SaveDay(ctx context.Context, day storage.DailyPrices) error {
+	switch m.writeMode {
+	case WriteReplace:
+		env, err := NewEnvelope(day, m.scraperVersion)
+		if err != nil {
+			return err
+		}
+		return m.SaveEnvelope(ctx, env)
+	case WriteMerge:
+		// Merging in Pantry would leave the record count and checksum of
+		// the envelope stale, so the day is merged here
+		date, err := day.Day()
+		if err != nil {
+			return err
+		}
+		if err := Update(ctx, m, m.DayBasket(date), m.mergeDay(day)); err != nil {
+			return fmt.Errorf("error merging basket: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown write mode %q", m.writeMode)
+	}
+}
+
+// mergeDay returns the Update function merging the records of the day into
+// those of the stored one, of any schema version. Records are matched by
+// source, product and variety: a record of the day replaces the stored one it
+// matches and the others are appended, so merging the same day twice stores
+// it once. The other fields are overwritten, as Pantry merges do.
+func (m *BasketManager) mergeDay(day storage.DailyPrices) func(*json.RawMessage) error {
+	return func(raw *json.RawMessage) error {
+		merged := day
+		if *raw != nil {
+			stored, _, err := DecodeEnvelope(*raw)
+			if err != nil {
+				return err
+			}
+			merged.Prices = mergeRecords(stored.Data.Prices, day.Prices, func(p source.PriceRecord) recordKey {
+				return recordKey{p.Source, p.Product, p.Variety}
+			})
+			merged.Volumes = mergeRecords(stored.Data.Volumes, day.Volumes, func(v source.VolumeRecord) recordKey {
+				return recordKey{v.Source, v.Product, v.Variety}
+			})
+		}
+		env, err := NewEnvelope(merged, m.scraperVersion)
+		if err != nil {
+			return err
+		}
+		*raw, err = json.Marshal(env)
+		return err
+	}
+}
+
+// recordKey identifies a record of a day for mergeDay
+type recordKey struct {
+	source, product, variety string
+}
+
+// mergeRecords returns the stored records with those of the same key
+// replaced by the incoming ones, in place, followed by the incoming records
+// of new keys
+func mergeRecords[T any](stored, incoming []T, key func(T) recordKey) []T {
+	merged := make([]T, 0, len(stored)+len(incoming))
+	index := make(map[recordKey]int, len(stored)+len(incoming))
+	for _, records := range [][]T{stored, incoming} {
+		for _, r := range records {
+			k := key(r)
+			if i, ok := index[k]; ok {
+				merged[i] = r
+				continue
+			}
+			index[k] = len(merged)
+			merged = append(merged, r)
+		}
+	}
+	return merged
+}
+
+// LoadDay reads the basket of the given date, reassembling it if it is
+// sharded and upgrading it if it was written with an older SchemaVersion. A
+// missing basket returns ErrNotFound, which matches storage.ErrNotFound.
+func (m *BasketManager) LoadDay(ctx context.Context, date time.Time) (storage.DailyPrices, error) {
+	env, _, err := m.LoadEnvelope(ctx, date)
+	if err != nil {
+		return storage.DailyPrices{}, err
+	}
+	return env.Data, nil
+}
+
+// ListDays returns the dates of every basket named by DayBasket, ignoring
+// any other basket in the pantry, including the days of other prefixes.
+func (m *BasketManager) ListDays(ctx context.Context) ([]time.Time, error) {
+	baskets, err := m.ListBaskets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []time.Time
+	for _, name := range baskets {
+		name, ok := strings.CutPrefix(name, m.basketPrefix)
+		if !ok {
+			continue
+		}
+		if date, ok := storage.ParseDayKey(name); ok {
+			days = append(days, date)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, nil
+}
+
+// DeleteDay deletes the basket of the given date and its parts, if it is
+// sharded. A missing basket returns
+// ErrNotFound, which matches storage.ErrNotFound.
+func (m *BasketManager) DeleteDay(ctx context.Context, date time.Time) error {
+	return m.DeleteSharded(ctx, m.DayBasket(date))
+}
+
+// Close releases any resources used by the manager
+func (m *BasketManager) Close() error {
+	// No resources to close with HTTP client
+	return nil
+}
@@ -0,0 +1,158 @@
+package pantry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry/pantrytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBasketManagerStore(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apiv1/pantry/test-key/baskets":
+			if err := writeJSON(t, w, []string{"prices_2025_06_18", "notes", "prices_2025_06_17"}); err != nil {
+				t.Errorf("Failed to write JSON response: %v", err)
+			}
+		case "/apiv1/pantry/test-key/basket/prices_2025_06_18":
+			if err := writeJSON(t, w, storage.DailyPrices{Date: "2025-06-18", Fetched: "2025-06-18T08:00:00Z"}); err != nil {
+				t.Errorf("Failed to write JSON response: %v", err)
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	manager := NewBasketManager(Config{APIKey: "test-key"})
+	manager.baseURL = server.URL + "/apiv1/pantry"
+	ctx := context.Background()
+
+	t.Run("ListDays", func(t *testing.T) {
+		days, err := manager.ListDays(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{
+			time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC),
+			time.Date(2025, 6, 18, 0, 0, 0, 0, time.UTC),
+		}, days)
+	})
+
+	t.Run("LoadDay", func(t *testing.T) {
+		day, err := manager.LoadDay(ctx, time.Date(2025, 6, 18, 0, 0, 0, 0, time.UTC))
+		require.NoError(t, err)
+		assert.Equal(t, "2025-06-18", day.Date)
+	})
+
+	t.Run("LoadDay missing", func(t *testing.T) {
+		_, err := manager.LoadDay(ctx, time.Date(2025, 6, 19, 0, 0, 0, 0, time.UTC))
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+}
+
+func TestWriteModes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	date := time.Date(2025, 6, 18, 0, 0, 0, 0, time.UTC)
+	name := BasketName(date)
+
+	first := storage.DailyPrices{Date: "2025-06-18", Fetched: "2025-06-18T08:00:00Z",
+		Prices: []source.PriceRecord{{Product: "PAPA", Avg: 1.5}}}
+	second := storage.DailyPrices{Date: "2025-06-18", Fetched: "2025-06-18T09:00:00Z",
+		Prices: []source.PriceRecord{{Product: "CEBOLLA", Avg: 2}}}
+
+	t.Run("ReplaceBasket and MergeBasket", func(t *testing.T) {
+		t.Parallel()
+		m, fake := newFakeManager(t, nil)
+		basketJSON := func(name string) string {
+			data, ok, err := fake.Basket(name)
+			require.NoError(t, err)
+			require.True(t, ok)
+			return string(data)
+		}
+
+		require.ErrorIs(t, m.MergeBasket(ctx, "notes", map[string]any{"a": 1}), ErrNotFound)
+		require.NoError(t, m.ReplaceBasket(ctx, "notes", map[string]any{"a": 1, "list": []int{1}}))
+		require.NoError(t, m.MergeBasket(ctx, "notes", map[string]any{"b": 2, "list": []int{2}}))
+		assert.JSONEq(t, `{"a":1,"b":2,"list":[1,2]}`, basketJSON("notes"))
+
+		require.NoError(t, m.ReplaceBasket(ctx, "notes", map[string]any{"b": 3}))
+		assert.JSONEq(t, `{"b":3}`, basketJSON("notes"))
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		t.Parallel()
+		m, _ := newFakeManager(t, nil)
+
+		require.NoError(t, m.SaveDay(ctx, first))
+		require.NoError(t, m.SaveDay(ctx, second))
+		day, err := m.LoadDay(ctx, date)
+		require.NoError(t, err)
+		assert.Equal(t, second, day, "the second run replaces the first one")
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		t.Parallel()
+		m, _ := newFakeManager(t, nil, WithWriteMode(WriteMerge))
+
+		require.NoError(t, m.SaveDay(ctx, first))
+		require.NoError(t, m.SaveDay(ctx, second))
+		day, err := m.LoadDay(ctx, date)
+		require.NoError(t, err)
+		assert.Equal(t, second.Fetched, day.Fetched)
+		assert.Equal(t, append(first.Prices, second.Prices...), day.Prices, "new records are appended")
+
+		// Merging the same day again replaces its records instead of
+		// duplicating them
+		rerun := second
+		rerun.Prices = []source.PriceRecord{{Product: "CEBOLLA", Avg: 2.5}}
+		rerun.Volumes = []source.VolumeRecord{{Product: "CEBOLLA", Volume: 40}}
+		require.NoError(t, m.SaveDay(ctx, rerun))
+		require.NoError(t, m.SaveDay(ctx, rerun))
+		day, err = m.LoadDay(ctx, date)
+		require.NoError(t, err)
+		assert.Equal(t, []source.PriceRecord{first.Prices[0], rerun.Prices[0]}, day.Prices)
+		assert.Equal(t, rerun.Volumes, day.Volumes)
+	})
+
+	t.Run("Merge matches source, product and variety", func(t *testing.T) {
+		t.Parallel()
+		m, _ := newFakeManager(t, nil, WithWriteMode(WriteMerge))
+		stored := storage.DailyPrices{Date: "2025-06-18", Prices: []source.PriceRecord{
+			{Source: "emmsa", Product: "PAPA", Variety: "PAPA BLANCA", Avg: 1.2},
+			{Source: "emmsa", Product: "PAPA", Variety: "PAPA AMARILLA", Avg: 3},
+			{Source: "agro", Product: "PAPA", Variety: "PAPA BLANCA", Avg: 1.1},
+		}}
+		incoming := storage.DailyPrices{Date: "2025-06-18", Prices: []source.PriceRecord{
+			{Source: "emmsa", Product: "PAPA", Variety: "PAPA BLANCA", Avg: 1.4},
+			{Source: "emmsa", Product: "PAPA", Variety: "PAPA YUNGAY", Avg: 1.3},
+		}}
+
+		require.NoError(t, m.SaveDay(ctx, stored))
+		require.NoError(t, m.SaveDay(ctx, incoming))
+		day, err := m.LoadDay(ctx, date)
+		require.NoError(t, err)
+		assert.Equal(t, []source.PriceRecord{incoming.Prices[0], stored.Prices[1], stored.Prices[2], incoming.Prices[1]}, day.Prices)
+	})
+
+	t.Run("Merge into sharded basket", func(t *testing.T) {
+		t.Parallel()
+		m, fake := newFakeManager(t, []pantrytest.Option{pantrytest.WithMaxBasketSize(2_000)}, WithMaxBasketSize(1_000))
+
+		require.NoError(t, m.SaveDay(ctx, bigDay("2025-06-18", 3_000)))
+		err := m.PutSharded(ctx, name, first, WriteMerge)
+		require.ErrorContains(t, err, "replace it instead")
+		require.Error(t, m.PutSharded(ctx, name, first, "append"))
+
+		require.NoError(t, m.SaveDay(ctx, first))
+		assert.Equal(t, []string{name}, baskets(t, fake), "replacing removes the parts")
+	})
+}
@@ -0,0 +1,109 @@
+package pantry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrConflict means the basket changed while Update was modifying it, on
+// every attempt
+var ErrConflict = errors.New("pantry: basket changed concurrently")
+
+// updateAttempts is how many times Update reads and modifies a basket that
+// keeps changing before giving up with ErrConflict
+const updateAttempts = 3
+
+// Get reads a basket into a value of type T, reassembling it if it is
+// sharded (see GetSharded). A missing basket returns ErrNotFound.
+//
+// Example:
+//
+//	day, err := pantry.Get[storage.DailyPrices](ctx, manager, "prices_2025_06_18")
+func Get[T any](ctx context.Context, m *BasketManager, basketName string) (T, error) {
+	var value T
+	if err := m.GetSharded(ctx, basketName, &value); err != nil {
+		var zero T
+		return zero, err
+	}
+	return value, nil
+}
+
+// Put replaces a basket with value, which must marshal to a JSON object,
+// sharding it if it is over the size limit (see PutSharded)
+//
+// Example:
+//
+//	err := pantry.Put(ctx, manager, "prices_2025_06_18", day)
+func Put[T any](ctx context.Context, m *BasketManager, basketName string, value T) error {
+	return m.PutSharded(ctx, basketName, value, WriteReplace)
+}
+
+// Update reads a basket into a value of type T, lets fn modify it and
+// replaces the basket with the result. A missing basket is created, fn
+// getting the zero value of T. An error of fn aborts the update and is
+// returned as is.
+//
+// Pantry has no conditional writes, so Update detects conflicts by hashing
+// the content: right before writing, the basket is read again and, if it
+// changed since fn saw it, fn is run again on the new content. A basket that
+// keeps changing returns ErrConflict. A writer slipping in between the
+// check and the write still goes undetected.
+//
+// Example:
+//
+//	err := pantry.Update(ctx, manager, name, func(day *storage.DailyPrices) error {
+//	    day.Prices = append(day.Prices, record)
+//	    return nil
+//	})
+func Update[T any](ctx context.Context, m *BasketManager, basketName string, fn func(*T) error) error {
+	for range updateAttempts {
+		before, err := m.contentHash(ctx, basketName)
+		if err != nil {
+			return err
+		}
+		var value T
+		if before.exists {
+			if err := json.Unmarshal(before.data, &value); err != nil {
+				return fmt.Errorf("failed to decode basket %s: %w", basketName, err)
+			}
+		}
+		if err := fn(&value); err != nil {
+			return err
+		}
+
+		after, err := m.contentHash(ctx, basketName)
+		if err != nil {
+			return err
+		}
+		if after.exists != before.exists || after.sum != before.sum {
+			continue
+		}
+		return Put(ctx, m, basketName, value)
+	}
+	return fmt.Errorf("failed to update basket %s: %w", basketName, ErrConflict)
+}
+
+// content is the content of a basket read by Update
+type content struct {
+	data   json.RawMessage
+	sum    [sha256.Size]byte
+	exists bool
+}
+
+// contentHash reads the content of a basket, reassembled if it is sharded,
+// and hashes it. A missing basket is not an error.
+func (m *BasketManager) contentHash(ctx context.Context, basketName string) (content, error) {
+	var raw json.RawMessage
+	err := m.GetSharded(ctx, basketName, &raw)
+	if errors.Is(err, ErrNotFound) {
+		return content{}, nil
+	}
+	if err != nil {
+		return content{}, err
+	}
+	return content{data: raw, sum: sha256.Sum256(bytes.TrimSpace(raw)), exists: true}, nil
+}
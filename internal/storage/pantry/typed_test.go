@@ -0,0 +1,117 @@
+package pantry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/aliasthewho/price_tracker/internal/storage/pantry/pantrytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPut(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	m, _ := newFakeManager(t, []pantrytest.Option{pantrytest.WithMaxBasketSize(2_000)}, WithMaxBasketSize(1_000))
+
+	_, err := Get[storage.DailyPrices](ctx, m, "notes")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	for _, day := range []storage.DailyPrices{testDay, bigDay("2025-06-18", 3_000)} {
+		require.NoError(t, Put(ctx, m, "notes", day))
+		got, err := Get[storage.DailyPrices](ctx, m, "notes")
+		require.NoError(t, err)
+		assert.Equal(t, day, got)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	record := source.PriceRecord{Source: "emmsa", Product: "CAMOTE", Avg: 0.8}
+	addRecord := func(day *storage.DailyPrices) error {
+		day.Date = "2025-06-18"
+		day.Prices = append(day.Prices, record)
+		return nil
+	}
+
+	t.Run("Create and modify", func(t *testing.T) {
+		t.Parallel()
+		m, _ := newFakeManager(t, nil)
+
+		require.NoError(t, Update(ctx, m, "notes", addRecord))
+		require.NoError(t, Update(ctx, m, "notes", addRecord))
+		day, err := Get[storage.DailyPrices](ctx, m, "notes")
+		require.NoError(t, err)
+		assert.Equal(t, []source.PriceRecord{record, record}, day.Prices)
+	})
+
+	t.Run("Error aborts", func(t *testing.T) {
+		t.Parallel()
+		m, fake := newFakeManager(t, nil)
+		boom := errors.New("boom")
+
+		err := Update(ctx, m, "notes", func(*storage.DailyPrices) error { return boom })
+		assert.Same(t, boom, err)
+		assert.Empty(t, baskets(t, fake), "nothing is written")
+	})
+
+	t.Run("Conflict is retried", func(t *testing.T) {
+		t.Parallel()
+		m, fake := newFakeManager(t, nil)
+		require.NoError(t, fake.SetBasket("notes", testDay))
+
+		calls := 0
+		err := Update(ctx, m, "notes", func(day *storage.DailyPrices) error {
+			calls++
+			if calls == 1 {
+				// Another writer replaces the basket while it is modified
+				require.NoError(t, fake.SetBasket("notes", storage.DailyPrices{Date: "2025-06-18"}))
+			}
+			return addRecord(day)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+		day, err := Get[storage.DailyPrices](ctx, m, "notes")
+		require.NoError(t, err)
+		assert.Equal(t, []source.PriceRecord{record}, day.Prices, "the update applies to the other writer's content")
+	})
+
+	t.Run("Persistent conflict", func(t *testing.T) {
+		t.Parallel()
+		m, fake := newFakeManager(t, nil)
+
+		calls := 0
+		err := Update(ctx, m, "notes", func(day *storage.DailyPrices) error {
+			calls++
+			require.NoError(t, fake.SetBasket("notes", map[string]any{"writer": calls}))
+			return addRecord(day)
+		})
+		assert.ErrorIs(t, err, ErrConflict)
+		assert.Equal(t, updateAttempts, calls)
+	})
+}
+
+func TestMergeDayKeepsEnvelopeValid(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	date := time.Date(2025, 6, 18, 0, 0, 0, 0, time.UTC)
+	m, fake := newFakeManager(t, nil, WithWriteMode(WriteMerge))
+
+	// A day stored before envelopes were introduced
+	require.NoError(t, fake.SetBasket(BasketName(date), testDay))
+	extra := storage.DailyPrices{Date: "2025-06-18", Fetched: "2025-06-18T09:00:00Z",
+		Prices: []source.PriceRecord{{Source: "emmsa", Product: "CAMOTE"}}}
+	require.NoError(t, m.SaveDay(ctx, extra))
+
+	env, stored, err := m.LoadEnvelope(ctx, date)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion, stored)
+	assert.Equal(t, 5, env.RecordCount)
+	assert.Equal(t, extra.Fetched, env.FetchedAt)
+	assert.Equal(t, append(testDay.Prices, extra.Prices...), env.Data.Prices)
+}
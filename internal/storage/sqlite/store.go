@@ -0,0 +1,325 @@
+// Package sqlite implements storage.Store on an embedded SQLite database
+// with one row per day and normalized prices and volumes tables that can be
+// queried directly with SQL.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+
+	// Register the pure Go "sqlite" database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+// schema creates the tables on first use
+const schema = `
+CREATE TABLE IF NOT EXISTS days (
+	date    TEXT PRIMARY KEY,
+	fetched TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS prices (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	date     TEXT NOT NULL REFERENCES days(date),
+	source   TEXT NOT NULL,
+	market   TEXT NOT NULL,
+	product  TEXT NOT NULL,
+	variety  TEXT NOT NULL,
+	unit     TEXT NOT NULL,
+	currency TEXT NOT NULL,
+	min      REAL NOT NULL,
+	max      REAL NOT NULL,
+	avg      REAL NOT NULL,
+	missing  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS prices_date ON prices(date);
+CREATE INDEX IF NOT EXISTS prices_product ON prices(product, variety, date);
+
+CREATE TABLE IF NOT EXISTS volumes (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	date    TEXT NOT NULL REFERENCES days(date),
+	source  TEXT NOT NULL,
+	market  TEXT NOT NULL,
+	product TEXT NOT NULL,
+	variety TEXT NOT NULL,
+	unit    TEXT NOT NULL,
+	volume  REAL NOT NULL,
+	missing TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS volumes_date ON volumes(date);
+CREATE INDEX IF NOT EXISTS volumes_product ON volumes(product, variety, date);
+`
+
+// addedColumns are the columns added after the tables were first released,
+// which CREATE TABLE IF NOT EXISTS does not add to existing databases
+var addedColumns = []struct{ table, column, definition string }{
+	{"prices", "missing", "TEXT NOT NULL DEFAULT ''"},
+	{"volumes", "missing", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// Store persists days in an SQLite database.
+//
+// The zero value is not usable, use Open instead.
+type Store struct {
+	db *sql.DB
+}
+
+var _ storage.Store = (*Store)(nil)
+
+// Open opens (or creates) the SQLite database at path and applies the schema
+func Open(path string) (*Store, error) {
+	if path == "" {
+		return nil, errors.New("database path not set")
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	// SQLite allows a single writer; serializing access through one
+	// connection avoids "database is locked" errors on concurrent saves
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply schema: %w", err)
+	}
+	if err := addColumns(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to apply schema: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// addColumns adds the addedColumns missing from a database created by an
+// older version
+func addColumns(db *sql.DB) error {
+	for _, c := range addedColumns {
+		var exists bool
+		err := db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, c.table, c.column, c.definition)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// joinMissing and splitMissing convert the Missing field of a record to and
+// from the comma-separated missing column
+func joinMissing(missing []string) string {
+	return strings.Join(missing, ",")
+}
+
+func splitMissing(missing string) []string {
+	if missing == "" {
+		return nil
+	}
+	return strings.Split(missing, ",")
+}
+
+// SaveDay replaces the day and all of its prices and volumes in a single transaction
+func (s *Store) SaveDay(ctx context.Context, day storage.DailyPrices) error {
+	if _, err := day.Day(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM prices WHERE date = ?`, day.Date); err != nil {
+		return fmt.Errorf("failed to delete previous prices: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM volumes WHERE date = ?`, day.Date); err != nil {
+		return fmt.Errorf("failed to delete previous volumes: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO days (date, fetched) VALUES (?, ?)
+		 ON CONFLICT(date) DO UPDATE SET fetched = excluded.fetched`,
+		day.Date, day.Fetched); err != nil {
+		return fmt.Errorf("failed to save day: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx,
+		`INSERT INTO prices (date, source, market, product, variety, unit, currency, min, max, avg, missing)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, p := range day.Prices {
+		if _, err := stmt.ExecContext(ctx, day.Date, p.Source, p.Market, p.Product, p.Variety,
+			p.Unit, p.Currency, p.Min, p.Max, p.Avg, joinMissing(p.Missing)); err != nil {
+			return fmt.Errorf("failed to save price: %w", err)
+		}
+	}
+
+	if len(day.Volumes) > 0 {
+		volumeStmt, err := tx.PrepareContext(ctx,
+			`INSERT INTO volumes (date, source, market, product, variety, unit, volume, missing)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare insert: %w", err)
+		}
+		defer volumeStmt.Close()
+
+		for _, v := range day.Volumes {
+			if _, err := volumeStmt.ExecContext(ctx, day.Date, v.Source, v.Market, v.Product, v.Variety,
+				v.Unit, v.Volume, joinMissing(v.Missing)); err != nil {
+				return fmt.Errorf("failed to save volume: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// LoadDay reads the day and its prices and volumes in insertion order
+func (s *Store) LoadDay(ctx context.Context, date time.Time) (storage.DailyPrices, error) {
+	day := storage.DailyPrices{Date: date.Format(storage.DateLayout)}
+
+	err := s.db.QueryRowContext(ctx, `SELECT fetched FROM days WHERE date = ?`, day.Date).Scan(&day.Fetched)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.DailyPrices{}, fmt.Errorf("%s: %w", day.Date, storage.ErrNotFound)
+	}
+	if err != nil {
+		return storage.DailyPrices{}, fmt.Errorf("failed to load day: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT date, source, market, product, variety, unit, currency, min, max, avg, missing
+		 FROM prices WHERE date = ? ORDER BY id`, day.Date)
+	if err != nil {
+		return storage.DailyPrices{}, fmt.Errorf("failed to load prices: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p source.PriceRecord
+		var missing string
+		if err := rows.Scan(&p.Date, &p.Source, &p.Market, &p.Product, &p.Variety,
+			&p.Unit, &p.Currency, &p.Min, &p.Max, &p.Avg, &missing); err != nil {
+			return storage.DailyPrices{}, fmt.Errorf("failed to scan price: %w", err)
+		}
+		p.Missing = splitMissing(missing)
+		day.Prices = append(day.Prices, p)
+	}
+	if err := rows.Err(); err != nil {
+		return storage.DailyPrices{}, fmt.Errorf("failed to load prices: %w", err)
+	}
+
+	day.Volumes, err = s.loadVolumes(ctx, day.Date)
+	if err != nil {
+		return storage.DailyPrices{}, err
+	}
+	return day, nil
+}
+
+// loadVolumes reads the volumes of a day in insertion order
+func (s *Store) loadVolumes(ctx context.Context, date string) ([]source.VolumeRecord, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT date, source, market, product, variety, unit, volume, missing
+		 FROM volumes WHERE date = ? ORDER BY id`, date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load volumes: %w", err)
+	}
+	defer rows.Close()
+
+	var volumes []source.VolumeRecord
+	for rows.Next() {
+		var v source.VolumeRecord
+		var missing string
+		if err := rows.Scan(&v.Date, &v.Source, &v.Market, &v.Product, &v.Variety,
+			&v.Unit, &v.Volume, &missing); err != nil {
+			return nil, fmt.Errorf("failed to scan volume: %w", err)
+		}
+		v.Missing = splitMissing(missing)
+		volumes = append(volumes, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load volumes: %w", err)
+	}
+	return volumes, nil
+}
+
+// ListDays returns the dates of every stored day
+func (s *Store) ListDays(ctx context.Context) ([]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT date FROM days ORDER BY date`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list days: %w", err)
+	}
+	defer rows.Close()
+
+	var days []time.Time
+	for rows.Next() {
+		var dateStr string
+		if err := rows.Scan(&dateStr); err != nil {
+			return nil, fmt.Errorf("failed to scan day: %w", err)
+		}
+		date, err := time.Parse(storage.DateLayout, dateStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stored date %q: %w", dateStr, err)
+		}
+		days = append(days, date)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list days: %w", err)
+	}
+	return days, nil
+}
+
+// DeleteDay removes the day and its prices and volumes
+func (s *Store) DeleteDay(ctx context.Context, date time.Time) error {
+	dateStr := date.Format(storage.DateLayout)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM prices WHERE date = ?`, dateStr); err != nil {
+		return fmt.Errorf("failed to delete prices: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM volumes WHERE date = ?`, dateStr); err != nil {
+		return fmt.Errorf("failed to delete volumes: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM days WHERE date = ?`, dateStr)
+	if err != nil {
+		return fmt.Errorf("failed to delete day: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%s: %w", dateStr, storage.ErrNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,120 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+	"github.com/aliasthewho/price_tracker/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store, err := Open(filepath.Join(t.TempDir(), "prices.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	june17 := time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC)
+	june18 := time.Date(2025, 6, 18, 0, 0, 0, 0, time.UTC)
+	day := storage.NewDailyPrices(june18, []source.PriceRecord{
+		{Date: "2025-06-18", Source: "emmsa", Product: "PAPA", Variety: "PAPA BLANCA", Avg: 1.35},
+		{Date: "2025-06-18", Source: "emmsa", Product: "HABA", Variety: "HABA VERDE", Max: 2, Missing: []string{"min", "avg"}},
+	})
+
+	t.Run("LoadDay missing", func(t *testing.T) {
+		_, err := store.LoadDay(ctx, june17)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+
+	t.Run("SaveDay and LoadDay", func(t *testing.T) {
+		require.NoError(t, store.SaveDay(ctx, day))
+
+		got, err := store.LoadDay(ctx, june18)
+		require.NoError(t, err)
+		assert.Equal(t, day, got)
+	})
+
+	t.Run("SaveDay replaces prices", func(t *testing.T) {
+		replaced := day
+		replaced.Prices = []source.PriceRecord{{Date: "2025-06-18", Source: "emmsa", Product: "CEBOLLA", Avg: 2}}
+		require.NoError(t, store.SaveDay(ctx, replaced))
+
+		got, err := store.LoadDay(ctx, june18)
+		require.NoError(t, err)
+		assert.Equal(t, replaced, got)
+	})
+
+	t.Run("SaveDay with volumes", func(t *testing.T) {
+		withVolumes := day
+		withVolumes.Volumes = []source.VolumeRecord{
+			{Date: "2025-06-18", Source: "emmsa", Product: "PAPA", Variety: "PAPA BLANCA", Unit: "t", Volume: 1250.5},
+		}
+		require.NoError(t, store.SaveDay(ctx, withVolumes))
+
+		got, err := store.LoadDay(ctx, june18)
+		require.NoError(t, err)
+		assert.Equal(t, withVolumes, got)
+
+		// Saving the day again without volumes removes them
+		require.NoError(t, store.SaveDay(ctx, day))
+		got, err = store.LoadDay(ctx, june18)
+		require.NoError(t, err)
+		assert.Empty(t, got.Volumes)
+	})
+
+	t.Run("ListDays", func(t *testing.T) {
+		require.NoError(t, store.SaveDay(ctx, storage.NewDailyPrices(june17, nil)))
+
+		days, err := store.ListDays(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []time.Time{june17, june18}, days)
+	})
+
+	t.Run("DeleteDay", func(t *testing.T) {
+		require.NoError(t, store.DeleteDay(ctx, june17))
+		assert.ErrorIs(t, store.DeleteDay(ctx, june17), storage.ErrNotFound)
+	})
+
+	t.Run("SaveDay invalid date", func(t *testing.T) {
+		err := store.SaveDay(ctx, storage.DailyPrices{Date: "18/06/2025"})
+		assert.Error(t, err)
+	})
+}
+
+func TestOpenAddsColumns(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "prices.db")
+
+	// A database created before the missing column existed
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE days (date TEXT PRIMARY KEY, fetched TEXT NOT NULL);
+		CREATE TABLE prices (
+			id INTEGER PRIMARY KEY AUTOINCREMENT, date TEXT NOT NULL REFERENCES days(date),
+			source TEXT NOT NULL, market TEXT NOT NULL, product TEXT NOT NULL, variety TEXT NOT NULL,
+			unit TEXT NOT NULL, currency TEXT NOT NULL, min REAL NOT NULL, max REAL NOT NULL, avg REAL NOT NULL
+		);
+		INSERT INTO days VALUES ('2025-06-17', '2025-06-17T08:00:00Z');
+		INSERT INTO prices (date, source, market, product, variety, unit, currency, min, max, avg)
+		VALUES ('2025-06-17', 'emmsa', 'GMML', 'PAPA', 'PAPA BLANCA', 'kg', 'PEN', 1.2, 1.5, 1.35);
+	`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	store, err := Open(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	got, err := store.LoadDay(context.Background(), time.Date(2025, 6, 17, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, got.Prices, 1)
+	assert.Nil(t, got.Prices[0].Missing)
+	assert.Equal(t, 1.35, got.Prices[0].Avg)
+}
@@ -0,0 +1,96 @@
+// Package storage defines the Store interface implemented by every backend
+// that persists daily prices, and the document stored for each day.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aliasthewho/price_tracker/internal/source"
+)
+
+// DateLayout is the layout of the Date field of DailyPrices
+const DateLayout = "2006-01-02"
+
+// dayKeyPrefix is the prefix of every day key
+const dayKeyPrefix = "prices_"
+
+// ErrNotFound is returned by Store.LoadDay and Store.DeleteDay when the
+// requested day is not stored.
+var ErrNotFound = errors.New("day not found")
+
+// DailyPrices is the document stored for a single day of prices
+type DailyPrices struct {
+	// Date is the trading day in YYYY-MM-DD format
+	Date string `json:"date"`
+	// Prices holds the normalized prices of every source fetched for the day
+	Prices []source.PriceRecord `json:"prices"`
+	// Volumes holds the market volumes, when the daily-volumes report was fetched
+	Volumes []source.VolumeRecord `json:"volumes,omitempty"`
+	// Fetched is the RFC 3339 timestamp of when the prices were fetched
+	Fetched string `json:"fetched"`
+}
+
+// NewDailyPrices creates the document for the given day, stamped with the current time
+func NewDailyPrices(date time.Time, prices []source.PriceRecord) DailyPrices {
+	return DailyPrices{
+		Date:    date.Format(DateLayout),
+		Prices:  prices,
+		Fetched: time.Now().Format(time.RFC3339),
+	}
+}
+
+// IsEmpty reports whether the day holds neither prices nor volumes
+func (d DailyPrices) IsEmpty() bool {
+	return len(d.Prices) == 0 && len(d.Volumes) == 0
+}
+
+// Day parses the Date field
+func (d DailyPrices) Day() (time.Time, error) {
+	day, err := time.Parse(DateLayout, d.Date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: %w", d.Date, err)
+	}
+	return day, nil
+}
+
+// Store persists one DailyPrices document per day.
+//
+// Implementations must be safe for concurrent use by multiple goroutines.
+type Store interface {
+	// SaveDay stores the day, replacing any document previously stored for
+	// the same date.
+	SaveDay(ctx context.Context, day DailyPrices) error
+	// LoadDay returns the document stored for the given date, or an error
+	// wrapping ErrNotFound if there is none.
+	LoadDay(ctx context.Context, date time.Time) (DailyPrices, error)
+	// ListDays returns the dates of every stored day in ascending order
+	ListDays(ctx context.Context) ([]time.Time, error)
+	// DeleteDay removes the document stored for the given date, or returns
+	// an error wrapping ErrNotFound if there is none.
+	DeleteDay(ctx context.Context, date time.Time) error
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// DayKey returns the name a day is stored under in key-based backends.
+// The format is "prices_YYYY_MM_DD".
+func DayKey(date time.Time) string {
+	return dayKeyPrefix + date.Format("2006_01_02")
+}
+
+// ParseDayKey is the inverse of DayKey. It reports false if the key was not
+// produced by DayKey.
+func ParseDayKey(key string) (time.Time, bool) {
+	if !strings.HasPrefix(key, dayKeyPrefix) {
+		return time.Time{}, false
+	}
+	date, err := time.Parse("2006_01_02", strings.TrimPrefix(key, dayKeyPrefix))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}